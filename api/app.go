@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"github.com/cloudfauj/cloudfauj/deployment"
 	"github.com/cloudfauj/cloudfauj/server"
+	"github.com/gorilla/websocket"
+	"io"
 	"net/http"
 )
 
@@ -16,22 +18,132 @@ func (a *API) Deploy(spec *deployment.Spec) (<-chan *server.Event, error) {
 	return a.makeWebsocketRequest(a.constructWsURL("/app/deploy"), m)
 }
 
-func (a *API) DestroyApp(app, env string) error {
-	u := a.constructHttpURL("/app/"+app, qp{"env": env})
+// AppLogs requests the server to fetch the logs of an application.
+// It streams the log events, following new ones if requested.
+func (a *API) AppLogs(req *server.AppLogsRequest) (<-chan *server.Event, error) {
+	m, _ := json.Marshal(req)
+	return a.makeWebsocketRequest(a.constructWsURL("/app/logs"), m)
+}
+
+// ExecApp runs a command interactively in an application's container.
+// The command's input is read from in and its output written to out, while
+// messages from the server about the session are written to msgs.
+func (a *API) ExecApp(req *server.AppExecRequest, in io.Reader, out, msgs io.Writer) error {
+	conn, _, err := a.WsDialer.Dial(a.constructWsURL("/app/exec"), nil)
+	if err != nil {
+		return fmt.Errorf("failed to establish websocket connection with server: %v", err)
+	}
+	defer conn.Close()
+
+	m, _ := json.Marshal(req)
+	if err := conn.WriteMessage(websocket.BinaryMessage, m); err != nil {
+		return fmt.Errorf("failed to send data to server: %v", err)
+	}
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := in.Read(buf)
+			if n > 0 {
+				if err := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		t, msg, err := conn.ReadMessage()
+		if err != nil {
+			// unless an error has occurred due to normal connection closure
+			// from server, it needs to propagate.
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure) {
+				return err
+			}
+			return nil
+		}
+		if t == websocket.BinaryMessage {
+			_, _ = out.Write(msg)
+		} else {
+			_, _ = msgs.Write(msg)
+		}
+	}
+}
+
+func (a *API) App(name, env string) (*server.AppInfo, error) {
+	var result server.AppInfo
+
+	res, err := a.HttpClient.Get(a.constructHttpURL("/app/"+name, qp{"env": env}))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errors.New("the app does not exist in the environment")
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %d: %v", res.StatusCode, err)
+	}
+	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode server response: %v", err)
+	}
+	return &result, nil
+}
+
+// AppStatus returns the live state of an application deployed in an environment
+func (a *API) AppStatus(name, env string) (*server.AppStatus, error) {
+	var result server.AppStatus
+
+	res, err := a.HttpClient.Get(a.constructHttpURL("/app/"+name+"/status", qp{"env": env}))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errors.New("the app is not deployed in the environment")
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %d: %v", res.StatusCode, err)
+	}
+	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode server response: %v", err)
+	}
+	return &result, nil
+}
+
+// DestroyApp requests the server to destroy an application. Its databases,
+// volumes & buckets are only deleted along with their data if deleteData is set,
+// otherwise they're retained and returned.
+func (a *API) DestroyApp(app, env string, deleteData bool) (*server.AppDestroyResult, error) {
+	var result server.AppDestroyResult
+
+	params := qp{"env": env}
+	if deleteData {
+		params["delete_data"] = "true"
+	}
+	u := a.constructHttpURL("/app/"+app, params)
 	req, _ := http.NewRequest(http.MethodDelete, u, nil)
 
 	res, err := a.HttpClient.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer res.Body.Close()
 
 	switch res.StatusCode {
 	case http.StatusNotFound:
-		return errors.New("the target app or environment does not exist")
+		return nil, errors.New("the target app or environment does not exist")
 	case http.StatusOK:
-		return nil
+		if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode server response: %v", err)
+		}
+		return &result, nil
 	}
 
-	return fmt.Errorf("server returned %d: %v", res.StatusCode, err)
+	return nil, fmt.Errorf("server returned %d: %v", res.StatusCode, err)
 }
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/cloudfauj/cloudfauj/domain"
 	"github.com/cloudfauj/cloudfauj/server"
@@ -17,6 +18,27 @@ func (a *API) DeleteDomain(name string) (<-chan *server.Event, error) {
 	return a.makeWebsocketRequest(a.constructWsURL("/domain/"+name+"/delete"), nil)
 }
 
+func (a *API) Domain(name string) (*server.DomainInfo, error) {
+	var result server.DomainInfo
+
+	res, err := a.HttpClient.Get(a.constructHttpURL("/domain/"+name, nil))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errors.New("domain does not exist")
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %d: %v", res.StatusCode, err)
+	}
+	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode server response: %v", err)
+	}
+	return &result, nil
+}
+
 func (a *API) ListDomains() ([]string, error) {
 	var result []string
 
@@ -2,9 +2,11 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/cloudfauj/cloudfauj/environment"
 	"github.com/cloudfauj/cloudfauj/server"
+	"io"
 	"net/http"
 )
 
@@ -13,10 +15,63 @@ func (a *API) CreateEnvironment(env *environment.Environment) (<-chan *server.Ev
 	return a.makeWebsocketRequest(a.constructWsURL("/environment/create"), m)
 }
 
+func (a *API) ImportEnvironment(env *environment.Environment) (<-chan *server.Event, error) {
+	m, _ := json.Marshal(env)
+	return a.makeWebsocketRequest(a.constructWsURL("/environment/import"), m)
+}
+
 func (a *API) DestroyEnvironment(name string) (<-chan *server.Event, error) {
 	return a.makeWebsocketRequest(a.constructWsURL("/environment/"+name+"/destroy"), nil)
 }
 
+func (a *API) UpdateEnvironment(name string, u *server.EnvUpdate) (<-chan *server.Event, error) {
+	m, _ := json.Marshal(u)
+	return a.makeWebsocketRequest(a.constructWsURL("/environment/"+name+"/update"), m)
+}
+
+func (a *API) Environment(name string) (*server.EnvInfo, error) {
+	var result server.EnvInfo
+
+	res, err := a.HttpClient.Get(a.constructHttpURL("/environment/"+name, nil))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errors.New("environment does not exist")
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %d: %v", res.StatusCode, err)
+	}
+	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode server response: %v", err)
+	}
+	return &result, nil
+}
+
+// ListEnvApps returns the details of all applications in an environment
+func (a *API) ListEnvApps(name string) ([]*server.AppInfo, error) {
+	var result []*server.AppInfo
+
+	res, err := a.HttpClient.Get(a.constructHttpURL("/environment/"+name+"/apps", nil))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errors.New("environment does not exist")
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %d: %v", res.StatusCode, err)
+	}
+	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode server response: %v", err)
+	}
+	return result, nil
+}
+
 func (a *API) ListEnvironments() ([]string, error) {
 	var result []string
 
@@ -42,3 +97,74 @@ func (a *API) TFPlanEnv(name string) (<-chan *server.Event, error) {
 func (a *API) TFApplyEnv(name string) (<-chan *server.Event, error) {
 	return a.makeWebsocketRequest(a.constructWsURL("/environment/"+name+"/apply"), nil)
 }
+
+func (a *API) AddEnvOverlay(env string, o *environment.Overlay) (<-chan *server.Event, error) {
+	m, _ := json.Marshal(o)
+	return a.makeWebsocketRequest(a.constructWsURL("/environment/"+env+"/overlay/add"), m)
+}
+
+func (a *API) ListEnvOverlays(env string) ([]*environment.Overlay, error) {
+	var result []*environment.Overlay
+
+	res, err := a.HttpClient.Get(a.constructHttpURL("/environment/"+env+"/overlays", nil))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errors.New("environment does not exist")
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %d: %v", res.StatusCode, err)
+	}
+	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode server response: %v", err)
+	}
+	return result, nil
+}
+
+func (a *API) DeleteEnvOverlay(env, name, scope string) error {
+	u := a.constructHttpURL("/environment/"+env+"/overlay/"+name, qp{"scope": scope})
+	req, _ := http.NewRequest(http.MethodDelete, u, nil)
+
+	res, err := a.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return errors.New("the target overlay or environment does not exist")
+	case http.StatusBadRequest:
+		return errors.New("the overlay name is invalid")
+	case http.StatusOK:
+		return nil
+	}
+
+	return fmt.Errorf("server returned %d: %v", res.StatusCode, err)
+}
+
+// EjectEnvironment requests the server to eject an environment.
+// It returns a gzipped tarball containing the environment's Terraform project.
+// The caller must close the returned reader.
+func (a *API) EjectEnvironment(name string) (io.ReadCloser, error) {
+	res, err := a.HttpClient.Post(a.constructHttpURL("/environment/"+name+"/eject", nil), "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Body, nil
+	case http.StatusNotFound:
+		err = errors.New("environment does not exist")
+	case http.StatusConflict:
+		err = errors.New("environment is neither provisioned nor ejected")
+	default:
+		err = fmt.Errorf("server returned %d", res.StatusCode)
+	}
+	res.Body.Close()
+	return nil, err
+}
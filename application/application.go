@@ -2,6 +2,8 @@ package application
 
 import (
 	"errors"
+	"fmt"
+	"regexp"
 	"strings"
 )
 
@@ -9,22 +11,91 @@ const TypeServer = "server"
 
 const VisibilityPublic = "public"
 
+var matcherRegex = regexp.MustCompile(`^\d{1,3}(-\d{1,3}|(,\d{1,3})*)$`)
+
 type Application struct {
 	Name        string       `json:"name"`
 	Type        string       `json:"type"`
 	Visibility  string       `json:"visibility"`
 	HealthCheck *HealthCheck `json:"healthcheck"`
 	Resources   *Resources   `json:"resources"`
+	Routing     *Routing     `json:"routing,omitempty"`
+	TargetGroup *TargetGroup `json:"target_group,omitempty" mapstructure:"target_group"`
+	IAM         *IAM         `json:"iam,omitempty"`
+	Databases   []*Database  `json:"databases,omitempty"`
+	Buckets     []*Bucket    `json:"buckets,omitempty"`
+	Queues      []*Queue     `json:"queues,omitempty"`
+	Volumes     []*Volume    `json:"volumes,omitempty"`
+	Sidecars    []*Sidecar   `json:"sidecars,omitempty"`
+
+	ContainerHealthCheck *ContainerHealthCheck `json:"container_healthcheck,omitempty" mapstructure:"container_healthcheck"`
 }
 
+// Seconds between load balancer health checks & after which one is considered
+// failed, if not specified by the application
+const (
+	DefaultHealthCheckInterval = 30
+	DefaultHealthCheckTimeout  = 5
+)
+
+const (
+	ProtocolHTTP  = "HTTP"
+	ProtocolHTTPS = "HTTPS"
+	ProtocolGRPC  = "GRPC"
+)
+
+// HealthCheck describes how the load balancer determines whether the
+// application is healthy. All fields except path are optional and fall
+// back to the load balancer's defaults.
 type HealthCheck struct {
 	Path string `json:"path"`
+	// Protocol the load balancer uses to talk to the app, one of HTTP, HTTPS or GRPC
+	Protocol string `json:"protocol,omitempty"`
+	// Seconds between health checks
+	Interval int `json:"interval,omitempty"`
+	// Seconds after which a health check is considered failed
+	Timeout            int `json:"timeout,omitempty"`
+	HealthyThreshold   int `json:"healthy_threshold,omitempty" mapstructure:"healthy_threshold"`
+	UnhealthyThreshold int `json:"unhealthy_threshold,omitempty" mapstructure:"unhealthy_threshold"`
+	// HTTP status codes (or gRPC codes) of a healthy response, eg- 200,202 or 200-299
+	Matcher string `json:"matcher,omitempty"`
+	// Seconds to ignore failing health checks for after a task starts
+	GracePeriod int `json:"grace_period,omitempty" mapstructure:"grace_period"`
+}
+
+// ContainerHealthCheck describes a health check ECS runs inside the application's
+// container. Unlike the load balancer health check, it also applies to apps that
+// don't receive traffic via a load balancer.
+type ContainerHealthCheck struct {
+	// Shell command to run inside the container. Exiting with 0 means healthy.
+	Command string `json:"command"`
+	// Seconds between health checks, 5 to 300. Defaults to 30.
+	Interval int `json:"interval,omitempty"`
+	// Seconds to wait for the command to succeed, 2 to 60. Defaults to 5.
+	Timeout int `json:"timeout,omitempty"`
+	// Consecutive failures after which the container is unhealthy, 1 to 10. Defaults to 3.
+	Retries int `json:"retries,omitempty"`
+	// Seconds to ignore failures for after the container starts, 0 to 300.
+	StartPeriod int `json:"start_period,omitempty" mapstructure:"start_period"`
+}
+
+// TargetGroup describes how the load balancer distributes traffic among the
+// application's tasks.
+type TargetGroup struct {
+	// Seconds to wait for in-flight requests to complete before deregistering a task
+	DeregistrationDelay *int `json:"deregistration_delay,omitempty" mapstructure:"deregistration_delay"`
+	// Whether requests from a client are always routed to the same task
+	Stickiness bool `json:"stickiness,omitempty"`
+	// Seconds a client sticks to a task
+	StickinessDuration int `json:"stickiness_duration,omitempty" mapstructure:"stickiness_duration"`
 }
 
 type Resources struct {
 	Cpu     int      `json:"cpu"`
 	Memory  int      `json:"memory"`
 	Network *Network `json:"network"`
+	// Ephemeral storage of each task in GB, 21 to 200. Defaults to DefaultEphemeralStorage.
+	EphemeralStorage int `json:"ephemeral_storage,omitempty" mapstructure:"ephemeral_storage"`
 }
 
 type Network struct {
@@ -35,11 +106,123 @@ func (a *Application) CheckIsValid() error {
 	if len(strings.TrimSpace(a.Name)) == 0 {
 		return errors.New("name cannot be empty")
 	}
+	// names starting with underscore are reserved for internal use
+	if strings.HasPrefix(a.Name, "_") {
+		return errors.New("name cannot start with an underscore")
+	}
 	if a.Type != TypeServer {
 		return errors.New("only " + TypeServer + " type is supported")
 	}
 	if a.Visibility != VisibilityPublic {
 		return errors.New("only " + VisibilityPublic + " visibility is supported")
 	}
+	if a.HealthCheck == nil {
+		return errors.New("healthcheck must be specified")
+	}
+	if err := a.HealthCheck.CheckIsValid(); err != nil {
+		return fmt.Errorf("invalid healthcheck: %v", err)
+	}
+	if a.ContainerHealthCheck != nil {
+		if err := a.ContainerHealthCheck.CheckIsValid(); err != nil {
+			return fmt.Errorf("invalid container healthcheck: %v", err)
+		}
+	}
+	if a.TargetGroup != nil {
+		if err := a.TargetGroup.CheckIsValid(); err != nil {
+			return fmt.Errorf("invalid target group: %v", err)
+		}
+	}
+	if a.Routing != nil {
+		if err := a.Routing.CheckIsValid(); err != nil {
+			return fmt.Errorf("invalid routing: %v", err)
+		}
+	}
+	if a.IAM != nil {
+		if err := a.IAM.CheckIsValid(); err != nil {
+			return fmt.Errorf("invalid iam: %v", err)
+		}
+	}
+	if err := checkDatabases(a.Databases); err != nil {
+		return err
+	}
+	if err := checkVolumes(a.Volumes); err != nil {
+		return err
+	}
+	if err := checkSidecars(a); err != nil {
+		return err
+	}
+	if err := checkResources(a); err != nil {
+		return fmt.Errorf("invalid resources: %v", err)
+	}
+	return checkStorage(a)
+}
+
+func (h *HealthCheck) CheckIsValid() error {
+	switch h.Protocol {
+	case "", ProtocolHTTP, ProtocolHTTPS, ProtocolGRPC:
+	default:
+		return errors.New("protocol must be one of " + ProtocolHTTP + ", " + ProtocolHTTPS + " or " + ProtocolGRPC)
+	}
+	if h.Interval != 0 && (h.Interval < 5 || h.Interval > 300) {
+		return errors.New("interval must be between 5 and 300 seconds")
+	}
+	if h.Timeout != 0 && (h.Timeout < 2 || h.Timeout > 120) {
+		return errors.New("timeout must be between 2 and 120 seconds")
+	}
+	// unspecified values fall back to the load balancer's defaults
+	interval, timeout := h.Interval, h.Timeout
+	if interval == 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	if timeout == 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	if timeout >= interval {
+		return fmt.Errorf("timeout (%ds) must be less than interval (%ds)", timeout, interval)
+	}
+	if h.HealthyThreshold != 0 && (h.HealthyThreshold < 2 || h.HealthyThreshold > 10) {
+		return errors.New("healthy threshold must be between 2 and 10")
+	}
+	if h.UnhealthyThreshold != 0 && (h.UnhealthyThreshold < 2 || h.UnhealthyThreshold > 10) {
+		return errors.New("unhealthy threshold must be between 2 and 10")
+	}
+	if h.Matcher != "" && !matcherRegex.MatchString(h.Matcher) {
+		return errors.New("matcher must be a list or range of status codes, eg- 200,202 or 200-299")
+	}
+	if h.GracePeriod < 0 {
+		return errors.New("grace period cannot be negative")
+	}
+	return nil
+}
+
+func (c *ContainerHealthCheck) CheckIsValid() error {
+	if len(strings.TrimSpace(c.Command)) == 0 {
+		return errors.New("command cannot be empty")
+	}
+	if c.Interval != 0 && (c.Interval < 5 || c.Interval > 300) {
+		return errors.New("interval must be between 5 and 300 seconds")
+	}
+	if c.Timeout != 0 && (c.Timeout < 2 || c.Timeout > 60) {
+		return errors.New("timeout must be between 2 and 60 seconds")
+	}
+	if c.Retries != 0 && (c.Retries < 1 || c.Retries > 10) {
+		return errors.New("retries must be between 1 and 10")
+	}
+	if c.StartPeriod < 0 || c.StartPeriod > 300 {
+		return errors.New("start period must be between 0 and 300 seconds")
+	}
+	return nil
+}
+
+func (t *TargetGroup) CheckIsValid() error {
+	if t.DeregistrationDelay != nil && (*t.DeregistrationDelay < 0 || *t.DeregistrationDelay > 3600) {
+		return errors.New("deregistration delay must be between 0 and 3600 seconds")
+	}
+	if t.StickinessDuration != 0 && (t.StickinessDuration < 1 || t.StickinessDuration > 604800) {
+		return errors.New("stickiness duration must be between 1 and 604800 seconds")
+	}
+	if t.StickinessDuration != 0 && !t.Stickiness {
+		return errors.New("stickiness duration requires stickiness to be enabled")
+	}
 	return nil
 }
@@ -0,0 +1,31 @@
+package application
+
+import "testing"
+
+func TestCheckIsValidHealthCheck(t *testing.T) {
+	cases := []struct {
+		name        string
+		healthCheck *HealthCheck
+		valid       bool
+	}{
+		{"path only", &HealthCheck{Path: "/ping"}, true},
+		{"grpc", &HealthCheck{Path: "/grpc.health.v1.Health/Check", Protocol: ProtocolGRPC}, true},
+		{"missing", nil, false},
+		{"invalid protocol", &HealthCheck{Path: "/ping", Protocol: "TCP"}, false},
+		{"timeout not less than interval", &HealthCheck{Path: "/ping", Interval: 10, Timeout: 10}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := &Application{
+				Name:        "api",
+				Type:        TypeServer,
+				Visibility:  VisibilityPublic,
+				HealthCheck: c.healthCheck,
+				Resources:   &Resources{Cpu: 256, Memory: 512, Network: &Network{BindPort: 80}},
+			}
+			if err := a.CheckIsValid(); (err == nil) != c.valid {
+				t.Errorf("CheckIsValid() = %v, want valid = %v", err, c.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+const (
+	DatabaseEnginePostgres = "postgres"
+	DatabaseEngineMySQL    = "mysql"
+
+	DefaultDatabaseSize    = "db.t3.micro"
+	DefaultDatabaseStorage = 20
+	DefaultDatabaseEnvVar  = "DATABASE_URL"
+)
+
+var (
+	databaseNameRegex    = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+	databaseSizeRegex    = regexp.MustCompile(`^db\.[a-z0-9]+\.[a-z0-9]+$`)
+	databaseVersionRegex = regexp.MustCompile(`^\d+(\.\d+)*$`)
+	envVarRegex          = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Database describes an RDS database instance provisioned for an application.
+// Its connection URL is supplied to the app's container as an environment variable.
+type Database struct {
+	// Name identifies the database among the app's databases and is also
+	// the name of the database created inside the instance.
+	Name string `json:"name"`
+	// Database engine, postgres or mysql
+	Engine string `json:"engine"`
+	// Engine version, eg- 13.4. Defaults to the version chosen by RDS.
+	Version string `json:"version,omitempty"`
+	// RDS instance class. Defaults to DefaultDatabaseSize.
+	Size string `json:"size,omitempty"`
+	// Allocated storage in GB, 20 to 65536. Defaults to DefaultDatabaseStorage.
+	Storage int `json:"storage,omitempty"`
+	// Environment variable containing the connection URL. Defaults to DefaultDatabaseEnvVar.
+	EnvVar string `json:"env_var,omitempty" mapstructure:"env_var"`
+}
+
+func (d *Database) CheckIsValid() error {
+	if !databaseNameRegex.MatchString(d.Name) {
+		return errors.New("name must start with a lowercase letter and only contain lowercase alphanumeric characters & underscores, max 32")
+	}
+	if d.Engine != DatabaseEnginePostgres && d.Engine != DatabaseEngineMySQL {
+		return errors.New("engine must be " + DatabaseEnginePostgres + " or " + DatabaseEngineMySQL)
+	}
+	if d.Version != "" && !databaseVersionRegex.MatchString(d.Version) {
+		return errors.New("invalid version " + d.Version)
+	}
+	if d.Size != "" && !databaseSizeRegex.MatchString(d.Size) {
+		return errors.New("size must be an RDS instance class, eg- " + DefaultDatabaseSize)
+	}
+	if d.Storage != 0 && (d.Storage < 20 || d.Storage > 65536) {
+		return errors.New("storage must be between 20 and 65536 GB")
+	}
+	if d.EnvVar != "" && !envVarRegex.MatchString(d.EnvVar) {
+		return errors.New("invalid environment variable name " + d.EnvVar)
+	}
+	return nil
+}
+
+// ConnectionEnvVar returns the environment variable containing the database's connection URL
+func (d *Database) ConnectionEnvVar() string {
+	if d.EnvVar == "" {
+		return DefaultDatabaseEnvVar
+	}
+	return d.EnvVar
+}
+
+// checkDatabases ensures that an application's databases can be told apart
+func checkDatabases(dbs []*Database) error {
+	names, envVars := make(map[string]bool), make(map[string]bool)
+	for _, d := range dbs {
+		if err := d.CheckIsValid(); err != nil {
+			return fmt.Errorf("invalid database %s: %v", d.Name, err)
+		}
+		if names[d.Name] {
+			return errors.New("database " + d.Name + " is specified more than once")
+		}
+		if envVars[d.ConnectionEnvVar()] {
+			return errors.New("databases must use distinct env vars, " + d.ConnectionEnvVar() + " is used more than once")
+		}
+		names[d.Name], envVars[d.ConnectionEnvVar()] = true, true
+	}
+	return nil
+}
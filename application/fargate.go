@@ -0,0 +1,95 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// Ephemeral storage in GB Fargate provides to a task if none is specified
+	DefaultEphemeralStorage = 20
+	MaxEphemeralStorage     = 200
+)
+
+// fargateTaskSize describes a CPU value supported by Fargate and the
+// memory values in MB it can be combined with.
+type fargateTaskSize struct {
+	cpu    int
+	memory []int
+}
+
+// fargateTaskSizes lists all task sizes supported by Fargate in ascending order of CPU
+var fargateTaskSizes = []fargateTaskSize{
+	{256, []int{512, 1024, 2048}},
+	{512, memRange(1024, 4096, 1024)},
+	{1024, memRange(2048, 8192, 1024)},
+	{2048, memRange(4096, 16384, 1024)},
+	{4096, memRange(8192, 30720, 1024)},
+	{8192, memRange(16384, 61440, 4096)},
+	{16384, memRange(32768, 122880, 8192)},
+}
+
+// memRange returns discrete memory values (MB) from start to end at increments of inc
+func memRange(start, end, inc int) []int {
+	var res []int
+	for i := start; i <= end; i += inc {
+		res = append(res, i)
+	}
+	return res
+}
+
+// TaskSize returns the CPU units & memory in MB of the smallest task size supported
+// by Fargate that fits all containers of the application's tasks. This is the size
+// the app is billed for. If CPU isn't enough to fit the memory, a larger CPU is chosen.
+func (a *Application) TaskSize() (int, int, error) {
+	cpu, memory := a.TotalCpu(), a.TotalMemory()
+	largest := fargateTaskSizes[len(fargateTaskSizes)-1]
+
+	if cpu > largest.cpu {
+		return 0, 0, fmt.Errorf(
+			"tasks require %d CPU units but Fargate supports at most %d (%d vCPU)",
+			cpu, largest.cpu, largest.cpu/1024,
+		)
+	}
+	if max := largest.memory[len(largest.memory)-1]; memory > max {
+		return 0, 0, fmt.Errorf(
+			"tasks require %d MB memory but Fargate supports at most %d MB (%d GB)",
+			memory, max, max/1024,
+		)
+	}
+
+	for _, s := range fargateTaskSizes {
+		if cpu > s.cpu {
+			continue
+		}
+		for _, m := range s.memory {
+			if memory <= m {
+				return s.cpu, m, nil
+			}
+		}
+	}
+	// unreachable since the largest size fits any valid value
+	return largest.cpu, largest.memory[len(largest.memory)-1], nil
+}
+
+// checkResources ensures that the resources of an application's tasks can be
+// provided by Fargate.
+func checkResources(a *Application) error {
+	r := a.Resources
+	if r == nil {
+		return errors.New("resources must be specified")
+	}
+	if r.Cpu < 0 || r.Memory < 0 {
+		return errors.New("cpu & memory cannot be negative")
+	}
+	if r.EphemeralStorage != 0 && (r.EphemeralStorage <= DefaultEphemeralStorage || r.EphemeralStorage > MaxEphemeralStorage) {
+		return fmt.Errorf(
+			"ephemeral storage must be between %d and %d GB",
+			DefaultEphemeralStorage+1, MaxEphemeralStorage,
+		)
+	}
+	if _, _, err := a.TaskSize(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package application
+
+import "testing"
+
+func TestTaskSize(t *testing.T) {
+	cases := []struct {
+		name        string
+		cpu, memory int
+		sidecars    []*Sidecar
+		wantCpu     int
+		wantMemory  int
+		wantErr     bool
+	}{
+		{"smallest", 0, 0, nil, 256, 512, false},
+		{"exact size", 256, 512, nil, 256, 512, false},
+		{"memory rounded up", 256, 600, nil, 256, 1024, false},
+		{"cpu rounded up", 300, 512, nil, 512, 1024, false},
+		{"memory needs larger cpu", 256, 3072, nil, 512, 3072, false},
+		{"memory between increments", 1024, 2500, nil, 1024, 3072, false},
+		{"cpu needs more memory", 2048, 1024, nil, 2048, 4096, false},
+		{"4 vCPU", 4096, 30000, nil, 4096, 30720, false},
+		{"memory beyond 4 vCPU", 4096, 30721, nil, 8192, 32768, false},
+		{"8 vCPU increments of 4 GB", 8192, 20000, nil, 8192, 20480, false},
+		{"16 vCPU increments of 8 GB", 16384, 40000, nil, 16384, 40960, false},
+		{"largest", 16384, 122880, nil, 16384, 122880, false},
+		{
+			"sidecars added",
+			256, 512,
+			[]*Sidecar{{Cpu: 256, Memory: 512}, {Memory: 256}},
+			512, 2048, false,
+		},
+		{"too much cpu", 16385, 512, nil, 0, 0, true},
+		{"too much memory", 16384, 122881, nil, 0, 0, true},
+		{"sidecars exceed cpu", 16384, 512, []*Sidecar{{Cpu: 1}}, 0, 0, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := &Application{Resources: &Resources{Cpu: c.cpu, Memory: c.memory}, Sidecars: c.sidecars}
+			cpu, memory, err := a.TaskSize()
+			if (err != nil) != c.wantErr {
+				t.Fatalf("TaskSize() error = %v, want error = %v", err, c.wantErr)
+			}
+			if cpu != c.wantCpu || memory != c.wantMemory {
+				t.Errorf("TaskSize() = %d CPU & %d MB, want %d CPU & %d MB", cpu, memory, c.wantCpu, c.wantMemory)
+			}
+		})
+	}
+}
+
+func TestCheckResources(t *testing.T) {
+	cases := []struct {
+		name      string
+		resources *Resources
+		valid     bool
+	}{
+		{"none", nil, false},
+		{"valid", &Resources{Cpu: 256, Memory: 512}, true},
+		{"negative cpu", &Resources{Cpu: -1, Memory: 512}, false},
+		{"negative memory", &Resources{Cpu: 256, Memory: -1}, false},
+		{"too large", &Resources{Cpu: 32768, Memory: 512}, false},
+		{"ephemeral storage", &Resources{Cpu: 256, Memory: 512, EphemeralStorage: 50}, true},
+		{"max ephemeral storage", &Resources{Cpu: 256, Memory: 512, EphemeralStorage: MaxEphemeralStorage}, true},
+		{"default ephemeral storage", &Resources{Cpu: 256, Memory: 512, EphemeralStorage: DefaultEphemeralStorage}, false},
+		{"too much ephemeral storage", &Resources{Cpu: 256, Memory: 512, EphemeralStorage: MaxEphemeralStorage + 1}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := checkResources(&Application{Resources: c.resources}); (err == nil) != c.valid {
+				t.Errorf("checkResources() = %v, want valid = %v", err, c.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	IAMEffectAllow = "Allow"
+	IAMEffectDeny  = "Deny"
+
+	// maxManagedPolicies is the number of managed policies an IAM role can have attached by default
+	maxManagedPolicies = 10
+)
+
+var (
+	iamActionRegex    = regexp.MustCompile(`^([a-z0-9-]+:[A-Za-z0-9*?]+|\*)$`)
+	iamPolicyARNRegex = regexp.MustCompile(`^arn:aws[a-z-]*:iam::(aws|\d{12}):policy/[\w+=,.@/-]+$`)
+)
+
+// IAM describes the permissions granted to an application's tasks via its task role.
+// The actions an app can be granted are restricted by the server's allowlist.
+type IAM struct {
+	// ARNs of managed IAM policies to attach to the task role
+	Policies []string `json:"policies,omitempty"`
+	// Statements of an inline policy added to the task role
+	Statements []*IAMStatement `json:"statements,omitempty"`
+}
+
+type IAMStatement struct {
+	// Allow or Deny, defaults to Allow
+	Effect string `json:"effect,omitempty"`
+	// Actions the statement applies to, eg- s3:GetObject. Wildcards are allowed.
+	Actions []string `json:"actions"`
+	// ARNs of resources the statement applies to
+	Resources []string `json:"resources"`
+}
+
+func (i *IAM) CheckIsValid() error {
+	if len(i.Policies) == 0 && len(i.Statements) == 0 {
+		return errors.New("at least 1 policy or statement must be specified")
+	}
+	if len(i.Policies) > maxManagedPolicies {
+		return fmt.Errorf("at most %d policies can be specified", maxManagedPolicies)
+	}
+	for _, p := range i.Policies {
+		if !iamPolicyARNRegex.MatchString(p) {
+			return errors.New("invalid policy ARN " + p)
+		}
+	}
+	for _, s := range i.Statements {
+		if err := s.CheckIsValid(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *IAMStatement) CheckIsValid() error {
+	switch s.Effect {
+	case "", IAMEffectAllow, IAMEffectDeny:
+	default:
+		return errors.New("statement effect must be " + IAMEffectAllow + " or " + IAMEffectDeny)
+	}
+	if len(s.Actions) == 0 {
+		return errors.New("statement must specify at least 1 action")
+	}
+	for _, a := range s.Actions {
+		if !iamActionRegex.MatchString(a) {
+			return errors.New("invalid action " + a + ", actions must be of the form service:action")
+		}
+	}
+	if len(s.Resources) == 0 {
+		return errors.New("statement must specify at least 1 resource")
+	}
+	for _, r := range s.Resources {
+		if r != "*" && !strings.HasPrefix(r, "arn:") {
+			return errors.New("invalid resource " + r + ", resources must be ARNs or *")
+		}
+	}
+	return nil
+}
+
+// Allows returns true if the statement grants its actions rather than denying them
+func (s *IAMStatement) Allows() bool {
+	return s.Effect != IAMEffectDeny
+}
@@ -0,0 +1,63 @@
+package application
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestIAMCheckIsValid(t *testing.T) {
+	statement := func(effect string, actions, resources []string) *IAMStatement {
+		return &IAMStatement{Effect: effect, Actions: actions, Resources: resources}
+	}
+	bucket := []string{"arn:aws:s3:::uploads/*"}
+	var tooManyPolicies []string
+	for i := 0; i <= maxManagedPolicies; i++ {
+		tooManyPolicies = append(tooManyPolicies, "arn:aws:iam::aws:policy/Policy"+strconv.Itoa(i))
+	}
+
+	cases := []struct {
+		name  string
+		iam   *IAM
+		valid bool
+	}{
+		{"empty", &IAM{}, false},
+		{"aws managed policy", &IAM{Policies: []string{"arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess"}}, true},
+		{"customer managed policy", &IAM{Policies: []string{"arn:aws:iam::123456789012:policy/team/uploads"}}, true},
+		{"gov cloud policy", &IAM{Policies: []string{"arn:aws-us-gov:iam::aws:policy/ReadOnlyAccess"}}, true},
+		{"role instead of policy", &IAM{Policies: []string{"arn:aws:iam::123456789012:role/uploads"}}, false},
+		{"policy name", &IAM{Policies: []string{"AmazonS3ReadOnlyAccess"}}, false},
+		{"too many policies", &IAM{Policies: tooManyPolicies}, false},
+		{"statement", &IAM{Statements: []*IAMStatement{statement("", []string{"s3:GetObject"}, bucket)}}, true},
+		{"deny statement", &IAM{Statements: []*IAMStatement{statement(IAMEffectDeny, []string{"s3:Delete*"}, bucket)}}, true},
+		{"any action & resource", &IAM{Statements: []*IAMStatement{statement(IAMEffectAllow, []string{"*"}, []string{"*"})}}, true},
+		{"unknown effect", &IAM{Statements: []*IAMStatement{statement("allow", []string{"s3:GetObject"}, bucket)}}, false},
+		{"no actions", &IAM{Statements: []*IAMStatement{statement("", nil, bucket)}}, false},
+		{"action without service", &IAM{Statements: []*IAMStatement{statement("", []string{"GetObject"}, bucket)}}, false},
+		{"action with spaces", &IAM{Statements: []*IAMStatement{statement("", []string{"s3:Get Object"}, bucket)}}, false},
+		{"no resources", &IAM{Statements: []*IAMStatement{statement("", []string{"s3:GetObject"}, nil)}}, false},
+		{"resource name", &IAM{Statements: []*IAMStatement{statement("", []string{"s3:GetObject"}, []string{"uploads"})}}, false},
+		{
+			"one invalid statement",
+			&IAM{Statements: []*IAMStatement{
+				statement("", []string{"s3:GetObject"}, bucket),
+				statement("", []string{"s3:PutObject"}, nil),
+			}},
+			false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.iam.CheckIsValid(); (err == nil) != c.valid {
+				t.Errorf("CheckIsValid() = %v, want valid = %v", err, c.valid)
+			}
+		})
+	}
+}
+
+func TestIAMStatementAllows(t *testing.T) {
+	for effect, allows := range map[string]bool{"": true, IAMEffectAllow: true, IAMEffectDeny: false} {
+		if got := (&IAMStatement{Effect: effect}).Allows(); got != allows {
+			t.Errorf("statement with effect %q allows = %v, want %v", effect, got, allows)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxHostnames is the number of names a single ACM certificate can cover by default
+	maxHostnames = 10
+	// maxRulePriority is the largest priority an ALB listener rule can have
+	maxRulePriority = 50000
+)
+
+var (
+	hostnameRegex = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+	pathRegex     = regexp.MustCompile(`^/[A-Za-z0-9._~!$&'()+,;=:@%/-]*$`)
+)
+
+// Routing describes how the load balancer routes requests to an application,
+// in addition to the app's default URL.
+type Routing struct {
+	// Hostnames the app is reachable at. These must belong to domains
+	// registered with Cloudfauj.
+	Hostnames []string `json:"hostnames,omitempty"`
+	// Path prefixes routed to the app. If hostnames are specified, only
+	// these paths on the hostnames are routed to the app.
+	Paths []string `json:"paths,omitempty"`
+	// Priority of the first listener rule created for the app. Each subsequent
+	// rule receives the next priority. If not specified, the load balancer
+	// assigns priorities automatically.
+	Priority int `json:"priority,omitempty"`
+}
+
+// Route is a combination of host & path prefix that the load balancer routes
+// to an application. An empty Host or Path matches any host or path respectively.
+type Route struct {
+	Host string
+	Path string
+}
+
+func (r *Routing) CheckIsValid() error {
+	if len(r.Hostnames) == 0 && len(r.Paths) == 0 {
+		return errors.New("at least 1 hostname or path must be specified")
+	}
+	if len(r.Hostnames) > maxHostnames {
+		return fmt.Errorf("at most %d hostnames can be specified", maxHostnames)
+	}
+	for _, h := range r.Hostnames {
+		if !hostnameRegex.MatchString(h) {
+			return errors.New("invalid hostname " + h + ", only lowercase fully qualified names are allowed")
+		}
+	}
+	for _, p := range r.Paths {
+		if !pathRegex.MatchString(p) {
+			return errors.New("invalid path " + p + ", paths must start with / and cannot contain wildcards")
+		}
+	}
+	if r.Priority < 0 || r.Priority+len(r.Routes())-1 > maxRulePriority {
+		return fmt.Errorf("priority must be between 1 and %d for all routes", maxRulePriority)
+	}
+	return nil
+}
+
+// Routes returns every host & path combination routed to the app.
+// Each route gets its own listener rule.
+func (r *Routing) Routes() []Route {
+	var res []Route
+
+	hosts, paths := r.Hostnames, r.Paths
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	for _, h := range hosts {
+		for _, p := range paths {
+			res = append(res, Route{Host: h, Path: normalizePath(p)})
+		}
+	}
+	return res
+}
+
+// PathPatterns returns the ALB path patterns matching the route's path prefix
+func (r Route) PathPatterns() []string {
+	if r.Path == "/" {
+		return []string{"/*"}
+	}
+	return []string{r.Path, r.Path + "/*"}
+}
+
+// Conflicts returns true if both routes claim requests to the same host & path.
+// Since paths are prefixes, routes on the same host conflict if either path is
+// nested under the other, eg- /api & /api/v1, as both rules would match /api/v1
+// and the load balancer would pick one of them by priority alone.
+func (r Route) Conflicts(o Route) bool {
+	if r.Host != o.Host {
+		return false
+	}
+	return r.anyPath() || o.anyPath() || isPathPrefix(r.Path, o.Path) || isPathPrefix(o.Path, r.Path)
+}
+
+// isPathPrefix returns true if p is the same as prefix or nested under it
+func isPathPrefix(prefix, p string) bool {
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+func (r Route) anyPath() bool {
+	return r.Path == "" || r.Path == "/"
+}
+
+func (r Route) String() string {
+	if r.Path == "" {
+		return r.Host
+	}
+	return r.Host + r.Path
+}
+
+func normalizePath(p string) string {
+	if p == "" || p == "/" {
+		return p
+	}
+	return strings.TrimSuffix(p, "/")
+}
@@ -0,0 +1,169 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Conditions a container can wait for on another container before starting
+const (
+	ContainerConditionStart    = "START"
+	ContainerConditionComplete = "COMPLETE"
+	ContainerConditionSuccess  = "SUCCESS"
+	ContainerConditionHealthy  = "HEALTHY"
+)
+
+var containerNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,255}$`)
+
+// Sidecar describes an additional container that runs alongside the
+// application's container in every task, eg- a log router or a proxy.
+type Sidecar struct {
+	// Name identifies the container among the task's containers
+	Name string `json:"name"`
+	// Container image, eg- datadog/agent:7
+	Image string `json:"image"`
+	// CPU units reserved for the container, added to the task's CPU
+	Cpu int `json:"cpu,omitempty"`
+	// Memory limit of the container in MB, added to the task's memory
+	Memory int `json:"memory,omitempty"`
+	// Whether the task is stopped if the container exits
+	Essential bool `json:"essential,omitempty"`
+	// Environment variables supplied to the container
+	Env map[string]string `json:"env,omitempty"`
+	// Containers that must reach a condition before this one starts
+	DependsOn []*ContainerDependency `json:"depends_on,omitempty" mapstructure:"depends_on"`
+}
+
+// ContainerDependency describes a condition a container waits for
+// on another container of the task before starting.
+type ContainerDependency struct {
+	// Name of the sidecar or the application the container depends on
+	Container string `json:"container"`
+	// One of START, COMPLETE, SUCCESS or HEALTHY. Defaults to START.
+	Condition string `json:"condition,omitempty"`
+}
+
+func (s *Sidecar) CheckIsValid() error {
+	if !containerNameRegex.MatchString(s.Name) {
+		return errors.New("name must only contain alphanumeric characters, hyphens & underscores, max 255")
+	}
+	if len(strings.TrimSpace(s.Image)) == 0 {
+		return errors.New("image cannot be empty")
+	}
+	if s.Cpu < 0 || s.Memory < 0 {
+		return errors.New("cpu & memory cannot be negative")
+	}
+	for k := range s.Env {
+		if !envVarRegex.MatchString(k) {
+			return errors.New("invalid environment variable name " + k)
+		}
+	}
+	return nil
+}
+
+// DependencyCondition returns the condition the container waits for on its dependency
+func (d *ContainerDependency) DependencyCondition() string {
+	if d.Condition == "" {
+		return ContainerConditionStart
+	}
+	return d.Condition
+}
+
+// TotalCpu returns the CPU units required by all containers of the application's tasks
+func (a *Application) TotalCpu() int {
+	res := a.Resources.Cpu
+	for _, s := range a.Sidecars {
+		res += s.Cpu
+	}
+	return res
+}
+
+// TotalMemory returns the memory in MB required by all containers of the application's tasks
+func (a *Application) TotalMemory() int {
+	res := a.Resources.Memory
+	for _, s := range a.Sidecars {
+		res += s.Memory
+	}
+	return res
+}
+
+// checkSidecars ensures that an application's sidecars can be told apart from
+// each other & the app, and that their dependencies can be satisfied by ECS.
+func checkSidecars(a *Application) error {
+	// the app's container is always essential
+	essential := map[string]bool{a.Name: true}
+	for _, s := range a.Sidecars {
+		if err := s.CheckIsValid(); err != nil {
+			return fmt.Errorf("invalid sidecar %s: %v", s.Name, err)
+		}
+		if _, ok := essential[s.Name]; ok {
+			return errors.New("sidecar " + s.Name + " is specified more than once or has the same name as the app")
+		}
+		essential[s.Name] = s.Essential
+	}
+
+	deps := make(map[string][]string)
+	for _, s := range a.Sidecars {
+		for _, d := range s.DependsOn {
+			isEssential, ok := essential[d.Container]
+			if !ok {
+				return fmt.Errorf("sidecar %s depends on unknown container %s", s.Name, d.Container)
+			}
+			if d.Container == s.Name {
+				return errors.New("sidecar " + s.Name + " cannot depend on itself")
+			}
+			switch d.DependencyCondition() {
+			case ContainerConditionStart:
+			case ContainerConditionComplete, ContainerConditionSuccess:
+				if isEssential {
+					return fmt.Errorf("sidecar %s cannot wait for essential container %s to exit", s.Name, d.Container)
+				}
+			case ContainerConditionHealthy:
+				// only the app's container can have a health check
+				if d.Container != a.Name || a.ContainerHealthCheck == nil {
+					return fmt.Errorf("sidecar %s can only wait for the app to be healthy if it has a container health check", s.Name)
+				}
+			default:
+				return errors.New("dependency condition must be one of START, COMPLETE, SUCCESS or HEALTHY")
+			}
+			deps[s.Name] = append(deps[s.Name], d.Container)
+		}
+	}
+	return checkDependencyCycles(deps)
+}
+
+// checkDependencyCycles returns an error if containers depend on each other in a cycle
+func checkDependencyCycles(deps map[string][]string) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+
+	var visit func(c string) error
+	visit = func(c string) error {
+		switch state[c] {
+		case visiting:
+			return errors.New("sidecar " + c + " depends on itself through other containers")
+		case visited:
+			return nil
+		}
+		state[c] = visiting
+		for _, d := range deps[c] {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		state[c] = visited
+		return nil
+	}
+
+	for c := range deps {
+		if err := visit(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package application
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckSidecars(t *testing.T) {
+	sidecar := func(name string, deps ...*ContainerDependency) *Sidecar {
+		return &Sidecar{Name: name, Image: "busybox", DependsOn: deps}
+	}
+	dep := func(container, condition string) *ContainerDependency {
+		return &ContainerDependency{Container: container, Condition: condition}
+	}
+
+	cases := []struct {
+		name     string
+		sidecars []*Sidecar
+		// whether the app has a container health check
+		healthCheck bool
+		valid       bool
+	}{
+		{"none", nil, false, true},
+		{
+			"sidecars",
+			[]*Sidecar{
+				{Name: "log_router", Image: "amazon/aws-for-fluent-bit", Cpu: 64, Memory: 128, Essential: true},
+				{Name: "agent", Image: "datadog/agent:7", Env: map[string]string{"DD_SITE": "datadoghq.eu"}},
+			},
+			false,
+			true,
+		},
+		{"empty name", []*Sidecar{{Image: "busybox"}}, false, false},
+		{"name with spaces", []*Sidecar{{Name: "log router", Image: "busybox"}}, false, false},
+		{"name too long", []*Sidecar{{Name: strings.Repeat("a", 256), Image: "busybox"}}, false, false},
+		{"no image", []*Sidecar{{Name: "agent", Image: " "}}, false, false},
+		{"negative cpu", []*Sidecar{{Name: "agent", Image: "busybox", Cpu: -1}}, false, false},
+		{"negative memory", []*Sidecar{{Name: "agent", Image: "busybox", Memory: -1}}, false, false},
+		{"invalid env var", []*Sidecar{{Name: "agent", Image: "busybox", Env: map[string]string{"1VAR": "x"}}}, false, false},
+		{"duplicate name", []*Sidecar{sidecar("agent"), sidecar("agent")}, false, false},
+		{"named after the app", []*Sidecar{sidecar("api")}, false, false},
+		{"depends on the app", []*Sidecar{sidecar("agent", dep("api", ""))}, false, true},
+		{"depends on a sidecar", []*Sidecar{sidecar("agent", dep("proxy", ContainerConditionStart)), sidecar("proxy")}, false, true},
+		{"depends on an unknown container", []*Sidecar{sidecar("agent", dep("proxy", ""))}, false, false},
+		{"depends on itself", []*Sidecar{sidecar("agent", dep("agent", ""))}, false, false},
+		{"unknown condition", []*Sidecar{sidecar("agent", dep("api", "READY"))}, false, false},
+		{
+			"waits for a non-essential sidecar to complete",
+			[]*Sidecar{sidecar("app_init"), sidecar("agent", dep("app_init", ContainerConditionComplete))},
+			false,
+			true,
+		},
+		{
+			"waits for a non-essential sidecar to succeed",
+			[]*Sidecar{sidecar("app_init"), sidecar("agent", dep("app_init", ContainerConditionSuccess))},
+			false,
+			true,
+		},
+		{
+			"waits for an essential sidecar to exit",
+			[]*Sidecar{{Name: "proxy", Image: "envoy", Essential: true}, sidecar("agent", dep("proxy", ContainerConditionSuccess))},
+			false,
+			false,
+		},
+		{"waits for the app to exit", []*Sidecar{sidecar("agent", dep("api", ContainerConditionComplete))}, false, false},
+		{"waits for the app to be healthy", []*Sidecar{sidecar("agent", dep("api", ContainerConditionHealthy))}, true, true},
+		{
+			"waits for the app to be healthy without a health check",
+			[]*Sidecar{sidecar("agent", dep("api", ContainerConditionHealthy))},
+			false,
+			false,
+		},
+		{
+			"waits for a sidecar to be healthy",
+			[]*Sidecar{sidecar("proxy"), sidecar("agent", dep("proxy", ContainerConditionHealthy))},
+			true,
+			false,
+		},
+		{
+			"dependency cycle",
+			[]*Sidecar{sidecar("a", dep("b", "")), sidecar("b", dep("a", ""))},
+			false,
+			false,
+		},
+		{
+			"long dependency cycle",
+			[]*Sidecar{sidecar("a", dep("b", "")), sidecar("b", dep("c", "")), sidecar("c", dep("a", ""))},
+			false,
+			false,
+		},
+		{
+			"shared dependency",
+			[]*Sidecar{sidecar("a", dep("b", ""), dep("c", "")), sidecar("b", dep("c", "")), sidecar("c", dep("api", ""))},
+			false,
+			true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := &Application{Name: "api", Sidecars: c.sidecars}
+			if c.healthCheck {
+				a.ContainerHealthCheck = &ContainerHealthCheck{Command: "curl -f localhost"}
+			}
+			if err := checkSidecars(a); (err == nil) != c.valid {
+				t.Errorf("checkSidecars() = %v, want valid = %v", err, c.valid)
+			}
+		})
+	}
+}
+
+func TestCheckDependencyCycles(t *testing.T) {
+	cases := []struct {
+		name  string
+		deps  map[string][]string
+		cycle bool
+	}{
+		{"none", nil, false},
+		{"chain", map[string][]string{"a": {"b"}, "b": {"c"}}, false},
+		{"diamond", map[string][]string{"a": {"b", "c"}, "b": {"d"}, "c": {"d"}}, false},
+		{"self", map[string][]string{"a": {"a"}}, true},
+		{"pair", map[string][]string{"a": {"b"}, "b": {"a"}}, true},
+		{"cycle after a chain", map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"d"}, "d": {"b"}}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := checkDependencyCycles(c.deps); (err != nil) != c.cycle {
+				t.Errorf("checkDependencyCycles() = %v, want cycle = %v", err, c.cycle)
+			}
+		})
+	}
+}
+
+func TestSidecarTotals(t *testing.T) {
+	a := &Application{
+		Resources: &Resources{Cpu: 256, Memory: 512},
+		Sidecars:  []*Sidecar{{Cpu: 64, Memory: 128}, {Memory: 64}},
+	}
+	if a.TotalCpu() != 320 || a.TotalMemory() != 704 {
+		t.Errorf("got total cpu %d & memory %d, want 320 & 704", a.TotalCpu(), a.TotalMemory())
+	}
+	if d := (&ContainerDependency{Container: "api"}).DependencyCondition(); d != ContainerConditionStart {
+		t.Errorf("got default condition %s, want %s", d, ContainerConditionStart)
+	}
+}
@@ -0,0 +1,113 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// storageNameRegex matches names of buckets & queues. Together with the env & app
+// names, they must fit within the limits AWS imposes on the names of the resources.
+var storageNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_]{0,19}$`)
+
+// Bucket describes an S3 bucket provisioned for an application.
+// The app's tasks can read, write & delete objects in it.
+type Bucket struct {
+	// Name identifies the bucket among the app's buckets
+	Name string `json:"name"`
+	// Whether all versions of objects are retained
+	Versioning bool `json:"versioning,omitempty"`
+	// Environment variable containing the bucket's name. Defaults to <NAME>_BUCKET.
+	EnvVar string `json:"env_var,omitempty" mapstructure:"env_var"`
+}
+
+// Queue describes an SQS queue provisioned for an application.
+// The app's tasks can send, receive & delete messages in it.
+type Queue struct {
+	// Name identifies the queue among the app's queues
+	Name string `json:"name"`
+	// Whether the queue is a FIFO queue
+	Fifo bool `json:"fifo,omitempty"`
+	// Seconds a received message is hidden from other consumers, up to 43200. Defaults to 30.
+	VisibilityTimeout int `json:"visibility_timeout,omitempty" mapstructure:"visibility_timeout"`
+	// Environment variable containing the queue's URL. Defaults to <NAME>_QUEUE_URL.
+	EnvVar string `json:"env_var,omitempty" mapstructure:"env_var"`
+}
+
+func (b *Bucket) CheckIsValid() error {
+	if !storageNameRegex.MatchString(b.Name) {
+		return errors.New("name must start with a lowercase letter and only contain lowercase alphanumeric characters & underscores, max 20")
+	}
+	if b.EnvVar != "" && !envVarRegex.MatchString(b.EnvVar) {
+		return errors.New("invalid environment variable name " + b.EnvVar)
+	}
+	return nil
+}
+
+// NameEnvVar returns the environment variable containing the bucket's name
+func (b *Bucket) NameEnvVar() string {
+	if b.EnvVar == "" {
+		return strings.ToUpper(b.Name) + "_BUCKET"
+	}
+	return b.EnvVar
+}
+
+func (q *Queue) CheckIsValid() error {
+	if !storageNameRegex.MatchString(q.Name) {
+		return errors.New("name must start with a lowercase letter and only contain lowercase alphanumeric characters & underscores, max 20")
+	}
+	if q.VisibilityTimeout < 0 || q.VisibilityTimeout > 43200 {
+		return errors.New("visibility timeout must be between 0 and 43200 seconds")
+	}
+	if q.EnvVar != "" && !envVarRegex.MatchString(q.EnvVar) {
+		return errors.New("invalid environment variable name " + q.EnvVar)
+	}
+	return nil
+}
+
+// URLEnvVar returns the environment variable containing the queue's URL
+func (q *Queue) URLEnvVar() string {
+	if q.EnvVar == "" {
+		return strings.ToUpper(q.Name) + "_QUEUE_URL"
+	}
+	return q.EnvVar
+}
+
+// checkStorage ensures that an application's buckets & queues can be told apart
+// and that no two resources, including databases, share an environment variable.
+func checkStorage(a *Application) error {
+	envVars := make(map[string]bool)
+	for _, d := range a.Databases {
+		envVars[d.ConnectionEnvVar()] = true
+	}
+
+	names := make(map[string]bool)
+	for _, b := range a.Buckets {
+		if err := b.CheckIsValid(); err != nil {
+			return fmt.Errorf("invalid bucket %s: %v", b.Name, err)
+		}
+		if names[b.Name] {
+			return errors.New("bucket " + b.Name + " is specified more than once")
+		}
+		if envVars[b.NameEnvVar()] {
+			return errors.New("env var " + b.NameEnvVar() + " of bucket " + b.Name + " is used more than once")
+		}
+		names[b.Name], envVars[b.NameEnvVar()] = true, true
+	}
+
+	names = make(map[string]bool)
+	for _, q := range a.Queues {
+		if err := q.CheckIsValid(); err != nil {
+			return fmt.Errorf("invalid queue %s: %v", q.Name, err)
+		}
+		if names[q.Name] {
+			return errors.New("queue " + q.Name + " is specified more than once")
+		}
+		if envVars[q.URLEnvVar()] {
+			return errors.New("env var " + q.URLEnvVar() + " of queue " + q.Name + " is used more than once")
+		}
+		names[q.Name], envVars[q.URLEnvVar()] = true, true
+	}
+	return nil
+}
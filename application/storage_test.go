@@ -0,0 +1,84 @@
+package application
+
+import "testing"
+
+func TestCheckStorage(t *testing.T) {
+	cases := []struct {
+		name      string
+		databases []*Database
+		buckets   []*Bucket
+		queues    []*Queue
+		valid     bool
+	}{
+		{"none", nil, nil, nil, true},
+		{
+			"buckets & queues",
+			nil,
+			[]*Bucket{{Name: "uploads", Versioning: true}, {Name: "reports", EnvVar: "REPORTS"}},
+			[]*Queue{{Name: "jobs"}, {Name: "events", Fifo: true, VisibilityTimeout: 60}},
+			true,
+		},
+		{"bucket & queue with the same name", nil, []*Bucket{{Name: "jobs"}}, []*Queue{{Name: "jobs"}}, true},
+		{"uppercase bucket name", nil, []*Bucket{{Name: "Uploads"}}, nil, false},
+		{"bucket name starting with a digit", nil, []*Bucket{{Name: "1uploads"}}, nil, false},
+		{"bucket name with a hyphen", nil, []*Bucket{{Name: "user-uploads"}}, nil, false},
+		{"bucket name too long", nil, []*Bucket{{Name: "abcdefghijklmnopqrstu"}}, nil, false},
+		{"invalid bucket env var", nil, []*Bucket{{Name: "uploads", EnvVar: "1BUCKET"}}, nil, false},
+		{"duplicate bucket", nil, []*Bucket{{Name: "uploads"}, {Name: "uploads", EnvVar: "OTHER"}}, nil, false},
+		{"duplicate queue", nil, nil, []*Queue{{Name: "jobs"}, {Name: "jobs", EnvVar: "OTHER"}}, false},
+		{"invalid queue name", nil, nil, []*Queue{{Name: "_jobs"}}, false},
+		{"negative visibility timeout", nil, nil, []*Queue{{Name: "jobs", VisibilityTimeout: -1}}, false},
+		{"visibility timeout too long", nil, nil, []*Queue{{Name: "jobs", VisibilityTimeout: 43201}}, false},
+		{
+			"buckets sharing an env var",
+			nil,
+			[]*Bucket{{Name: "uploads", EnvVar: "BUCKET"}, {Name: "reports", EnvVar: "BUCKET"}},
+			nil,
+			false,
+		},
+		{
+			"bucket & queue sharing an env var",
+			nil,
+			[]*Bucket{{Name: "uploads", EnvVar: "STORAGE"}},
+			[]*Queue{{Name: "jobs", EnvVar: "STORAGE"}},
+			false,
+		},
+		{
+			"queue's default env var used by a bucket",
+			nil,
+			[]*Bucket{{Name: "uploads", EnvVar: "JOBS_QUEUE_URL"}},
+			[]*Queue{{Name: "jobs"}},
+			false,
+		},
+		{
+			"bucket sharing an env var with a database",
+			[]*Database{{Name: "main"}},
+			[]*Bucket{{Name: "uploads", EnvVar: DefaultDatabaseEnvVar}},
+			nil,
+			false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := &Application{Databases: c.databases, Buckets: c.buckets, Queues: c.queues}
+			if err := checkStorage(a); (err == nil) != c.valid {
+				t.Errorf("checkStorage() = %v, want valid = %v", err, c.valid)
+			}
+		})
+	}
+}
+
+func TestStorageEnvVars(t *testing.T) {
+	if v := (&Bucket{Name: "user_uploads"}).NameEnvVar(); v != "USER_UPLOADS_BUCKET" {
+		t.Errorf("got bucket env var %s, want USER_UPLOADS_BUCKET", v)
+	}
+	if v := (&Bucket{Name: "uploads", EnvVar: "UPLOADS"}).NameEnvVar(); v != "UPLOADS" {
+		t.Errorf("got bucket env var %s, want UPLOADS", v)
+	}
+	if v := (&Queue{Name: "jobs"}).URLEnvVar(); v != "JOBS_QUEUE_URL" {
+		t.Errorf("got queue env var %s, want JOBS_QUEUE_URL", v)
+	}
+	if v := (&Queue{Name: "jobs", EnvVar: "JOBS"}).URLEnvVar(); v != "JOBS" {
+		t.Errorf("got queue env var %s, want JOBS", v)
+	}
+}
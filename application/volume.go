@@ -0,0 +1,58 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+)
+
+var mountPathRegex = regexp.MustCompile(`^/[A-Za-z0-9._/-]*$`)
+
+// Volume describes a persistent volume backed by EFS that is mounted into the
+// application's container. Its data survives deployments & task replacements.
+type Volume struct {
+	// Name identifies the volume among the app's volumes
+	Name string `json:"name"`
+	// Absolute path the volume is mounted at inside the container
+	MountPath string `json:"mount_path" mapstructure:"mount_path"`
+	// Whether the container can only read from the volume
+	ReadOnly bool `json:"read_only,omitempty" mapstructure:"read_only"`
+	// POSIX user & group all file operations on the volume are performed as.
+	// Default to 0 (root).
+	Uid int `json:"uid,omitempty"`
+	Gid int `json:"gid,omitempty"`
+}
+
+func (v *Volume) CheckIsValid() error {
+	if !storageNameRegex.MatchString(v.Name) {
+		return errors.New("name must start with a lowercase letter and only contain lowercase alphanumeric characters & underscores, max 20")
+	}
+	// paths must be clean so that the same path can't be specified in different ways
+	if !mountPathRegex.MatchString(v.MountPath) || v.MountPath == "/" || path.Clean(v.MountPath) != v.MountPath {
+		return errors.New("mount path must be a clean absolute path other than /")
+	}
+	if v.Uid < 0 || v.Gid < 0 {
+		return errors.New("uid & gid cannot be negative")
+	}
+	return nil
+}
+
+// checkVolumes ensures that an application's volumes can be told apart
+// and don't share mount paths.
+func checkVolumes(vols []*Volume) error {
+	names, paths := make(map[string]bool), make(map[string]bool)
+	for _, v := range vols {
+		if err := v.CheckIsValid(); err != nil {
+			return fmt.Errorf("invalid volume %s: %v", v.Name, err)
+		}
+		if names[v.Name] {
+			return errors.New("volume " + v.Name + " is specified more than once")
+		}
+		if paths[v.MountPath] {
+			return errors.New("mount path " + v.MountPath + " is used by more than one volume")
+		}
+		names[v.Name], paths[v.MountPath] = true, true
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package application
+
+import "testing"
+
+func TestCheckVolumes(t *testing.T) {
+	cases := []struct {
+		name  string
+		vols  []*Volume
+		valid bool
+	}{
+		{"none", nil, true},
+		{
+			"volumes",
+			[]*Volume{
+				{Name: "data", MountPath: "/data"},
+				{Name: "cache", MountPath: "/var/cache/app", ReadOnly: true, Uid: 1000, Gid: 1000},
+			},
+			true,
+		},
+		{"nested mount paths", []*Volume{{Name: "data", MountPath: "/data"}, {Name: "cache", MountPath: "/data/cache"}}, true},
+		{"empty name", []*Volume{{MountPath: "/data"}}, false},
+		{"uppercase name", []*Volume{{Name: "Data", MountPath: "/data"}}, false},
+		{"name too long", []*Volume{{Name: "abcdefghijklmnopqrstu", MountPath: "/data"}}, false},
+		{"no mount path", []*Volume{{Name: "data"}}, false},
+		{"relative mount path", []*Volume{{Name: "data", MountPath: "data"}}, false},
+		{"root mount path", []*Volume{{Name: "data", MountPath: "/"}}, false},
+		{"mount path with spaces", []*Volume{{Name: "data", MountPath: "/my data"}}, false},
+		{"mount path with trailing slash", []*Volume{{Name: "data", MountPath: "/data/"}}, false},
+		{"mount path with dot segments", []*Volume{{Name: "data", MountPath: "/app/../data"}}, false},
+		{"negative uid", []*Volume{{Name: "data", MountPath: "/data", Uid: -1}}, false},
+		{"negative gid", []*Volume{{Name: "data", MountPath: "/data", Gid: -1}}, false},
+		{"duplicate name", []*Volume{{Name: "data", MountPath: "/data"}, {Name: "data", MountPath: "/other"}}, false},
+		{"shared mount path", []*Volume{{Name: "data", MountPath: "/data"}, {Name: "other", MountPath: "/data"}}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := checkVolumes(c.vols); (err == nil) != c.valid {
+				t.Errorf("checkVolumes() = %v, want valid = %v", err, c.valid)
+			}
+		})
+	}
+}
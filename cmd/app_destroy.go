@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/cloudfauj/cloudfauj/api"
 	"github.com/spf13/cobra"
+	"strings"
 )
 
 var appDestroyCmd = &cobra.Command{
@@ -12,26 +13,58 @@ var appDestroyCmd = &cobra.Command{
 	Short: "Destroy an application",
 	Long: `
     This command lets you stop an application and destroy all infrastructure
-    that was provisioned for it in a specific environment.`,
+    that was provisioned for it in a specific environment.
+
+    Databases, volumes & buckets of the app are retained along with their data,
+    unless --delete-data is passed. Deploying the app again reattaches them.`,
 	RunE:    runAppDestroyCmd,
 	Example: "cloudfauj app destroy --env staging demo-server",
 }
 
 func init() {
 	appDestroyCmd.Flags().String("env", "", "The environment to destroy the app from")
+	appDestroyCmd.Flags().Bool("delete-data", false, "Also delete the app's databases, volumes & buckets along with all their data")
+	appDestroyCmd.Flags().Bool("auto-approve", false, "Delete data without asking for confirmation")
 	_ = appDestroyCmd.MarkFlagRequired("env")
 }
 
 func runAppDestroyCmd(cmd *cobra.Command, args []string) error {
 	env, _ := cmd.Flags().GetString("env")
+	deleteData, _ := cmd.Flags().GetBool("delete-data")
+	autoApprove, _ := cmd.Flags().GetBool("auto-approve")
+
+	question := "All databases, volumes & buckets of " + args[0] + " and their data will be permanently deleted. Continue?"
+	if deleteData && !autoApprove && !confirm(question) {
+		return nil
+	}
+
 	apiClient, err := api.NewClient(serverAddr)
 	if err != nil {
 		return err
 	}
 	fmt.Printf("Destroying %s from %s\n", args[0], env)
-	if err := apiClient.DestroyApp(args[0], env); err != nil {
+	res, err := apiClient.DestroyApp(args[0], env, deleteData)
+	if err != nil {
 		return err
 	}
+	if len(res.RetainedDatabases) > 0 {
+		fmt.Printf(
+			"Retained databases: %s\nDeploy the app again to reattach them, then destroy it with --delete-data to delete them\n",
+			strings.Join(res.RetainedDatabases, ", "),
+		)
+	}
+	if len(res.RetainedVolumes) > 0 {
+		fmt.Printf(
+			"Retained volumes: %s\nDeploy the app again to reattach them, then destroy it with --delete-data to delete them\n",
+			strings.Join(res.RetainedVolumes, ", "),
+		)
+	}
+	if len(res.RetainedBuckets) > 0 {
+		fmt.Printf(
+			"Retained buckets: %s\nDeploy the app again to reattach them, then destroy it with --delete-data to delete them\n",
+			strings.Join(res.RetainedBuckets, ", "),
+		)
+	}
 	fmt.Println("Done")
 	return nil
 }
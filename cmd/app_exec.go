@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/api"
+	"github.com/cloudfauj/cloudfauj/server"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Command run in the app's container if none is specified
+const defaultExecCommand = "/bin/sh"
+
+var appExecCmd = &cobra.Command{
+	Use:   "exec --env ENV [flags] APP [-- COMMAND [ARGS...]]",
+	Short: "Run a command in an Application's container",
+	Long: `
+    This command runs a command interactively in the container of a running task of
+    an application, eg- to open a shell while debugging an issue. The session is
+    relayed via the Cloudfauj server using ECS Exec, so no AWS credentials are needed.
+
+    If no command is specified, a shell is started.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runAppExecCmd,
+	Example: `cloudfauj app exec --env staging demo-server
+cloudfauj app exec --env staging demo-server -- ls -la /app`,
+}
+
+func init() {
+	appExecCmd.Flags().String("env", "", "The environment the app is deployed in")
+	_ = appExecCmd.MarkFlagRequired("env")
+}
+
+func runAppExecCmd(cmd *cobra.Command, args []string) error {
+	apiClient, err := api.NewClient(serverAddr)
+	if err != nil {
+		return err
+	}
+	if dash := cmd.ArgsLenAtDash(); dash > 1 || (dash == -1 && len(args) > 1) {
+		return fmt.Errorf("the command to run must be specified after --")
+	}
+
+	req := &server.AppExecRequest{App: args[0], Command: defaultExecCommand}
+	req.Env, _ = cmd.Flags().GetString("env")
+	if len(args) > 1 {
+		// the command is sent as a single string, so each argument is quoted
+		// to preserve its boundaries, eg- for `-- sh -c "echo hi"`
+		quoted := make([]string, len(args)-1)
+		for i, a := range args[1:] {
+			quoted[i] = shellQuote(a)
+		}
+		req.Command = strings.Join(quoted, " ")
+	}
+
+	// In a terminal, keystrokes are sent to the container as they're typed
+	// and the container's terminal handles echoing them.
+	var msgs io.Writer = os.Stderr
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		req.Cols, req.Rows, _ = term.GetSize(fd)
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("failed to configure terminal: %v", err)
+		}
+		defer term.Restore(fd, state)
+		msgs = &crlfWriter{w: os.Stderr}
+	}
+	return apiClient.ExecApp(req, os.Stdin, os.Stdout, msgs)
+}
+
+var shellSafeRegex = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote returns s as a single shell word
+func shellQuote(s string) string {
+	if shellSafeRegex.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// crlfWriter writes each message on its own line while the terminal is in raw mode
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	_, err := fmt.Fprintf(c.w, "%s\r\n", p)
+	return len(p), err
+}
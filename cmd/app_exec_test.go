@@ -0,0 +1,23 @@
+package cmd
+
+import "testing"
+
+func TestShellQuote(t *testing.T) {
+	cases := []struct {
+		arg, want string
+	}{
+		{"ls", "ls"},
+		{"/app/bin/server", "/app/bin/server"},
+		{"--level=debug", "--level=debug"},
+		{"", "''"},
+		{"echo hi", "'echo hi'"},
+		{"$HOME", "'$HOME'"},
+		{"it's", `'it'"'"'s'`},
+		{"a;b", "'a;b'"},
+	}
+	for _, c := range cases {
+		if got := shellQuote(c.arg); got != c.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", c.arg, got, c.want)
+		}
+	}
+}
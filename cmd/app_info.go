@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/api"
+	"github.com/spf13/cobra"
+	"sort"
+	"strings"
+)
+
+var appInfoCmd = &cobra.Command{
+	Use:   "info --env ENV [flags] APP",
+	Short: "Get information about an Application",
+	Long: `
+    This command displays information about an application in an environment.
+    Among other things, it returns the artifact currently deployed, its last
+    deployment, the URL it is reachable at, its buckets & queues and its
+    configuration.`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runAppInfoCmd,
+	Example: "cloudfauj app info --env staging demo-server",
+}
+
+func init() {
+	appInfoCmd.Flags().String("env", "", "The environment the app is deployed in")
+	_ = appInfoCmd.MarkFlagRequired("env")
+}
+
+func runAppInfoCmd(cmd *cobra.Command, args []string) error {
+	env, _ := cmd.Flags().GetString("env")
+	apiClient, err := api.NewClient(serverAddr)
+	if err != nil {
+		return err
+	}
+	a, err := apiClient.App(args[0], env)
+	if err != nil {
+		return err
+	}
+
+	lastDeployment := "-"
+	if d := a.LastDeployment; d != nil {
+		lastDeployment = d.Id + " (" + d.Status + ")"
+	}
+	desc := `
+    Name:            %s
+    Environment:     %s
+    Artifact:        %s
+    Last Deployment: %s
+    URL:             %s
+`
+	fmt.Printf(desc, a.Name, a.Environment, orNone(a.Artifact), lastDeployment, orNone(a.URL))
+
+	if len(a.Buckets) > 0 {
+		fmt.Println("    Buckets:")
+		printSorted(a.Buckets)
+	}
+	if len(a.Queues) > 0 {
+		fmt.Println("    Queues:")
+		printSorted(a.Queues)
+	}
+
+	config, _ := json.MarshalIndent(a.Application, "    ", "  ")
+	fmt.Printf("    Config:\n    %s\n\n", strings.TrimSpace(string(config)))
+	return nil
+}
+
+// printSorted prints the entries of a map as an indented list, sorted by key
+func printSorted(m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("      %s: %s\n", k, m[k])
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/api"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+)
+
+var appListCmd = &cobra.Command{
+	Use:     "ls --env ENV",
+	Aliases: []string{"list"},
+	Short:   "List all Applications in an Environment",
+	Long: `
+    This command returns a list of all applications in an environment along with
+    the artifact currently deployed, the status of their last deployment and URL.`,
+	RunE:    runAppListCmd,
+	Example: "cloudfauj app ls --env staging",
+}
+
+func init() {
+	appListCmd.Flags().String("env", "", "The environment to list apps of")
+	_ = appListCmd.MarkFlagRequired("env")
+}
+
+func runAppListCmd(cmd *cobra.Command, args []string) error {
+	env, _ := cmd.Flags().GetString("env")
+	apiClient, err := api.NewClient(serverAddr)
+	if err != nil {
+		return err
+	}
+	apps, err := apiClient.ListEnvApps(env)
+	if err != nil {
+		return err
+	}
+	if len(apps) == 0 {
+		fmt.Println("No apps deployed in " + env + " yet")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tARTIFACT\tLAST DEPLOYMENT\tURL")
+	for _, a := range apps {
+		lastDeployment := "-"
+		if d := a.LastDeployment; d != nil {
+			lastDeployment = d.Id + " (" + d.Status + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.Name, orNone(a.Artifact), lastDeployment, orNone(a.URL))
+	}
+	return w.Flush()
+}
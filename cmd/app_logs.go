@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/api"
+	"github.com/cloudfauj/cloudfauj/server"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+var appLogsCmd = &cobra.Command{
+	Use:   "logs --env ENV [flags] APP",
+	Short: "Display the logs of an Application",
+	Long: `
+    This command displays the logs produced by an application's containers in an
+    environment, fetched from CloudWatch Logs.
+
+    Use --follow to keep streaming new logs as they're produced and --filter to only
+    display the lines matching a CloudWatch Logs filter pattern.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runAppLogsCmd,
+	Example: `cloudfauj app logs --env staging demo-server
+cloudfauj app logs --env staging --since 30m --filter ERROR --follow demo-server`,
+}
+
+func init() {
+	f := appLogsCmd.Flags()
+
+	f.String("env", "", "The environment the app is deployed in")
+	f.BoolP("follow", "f", false, "Keep streaming new logs")
+	f.Duration("since", time.Hour, "Only display logs newer than a relative duration like 5m or 2h")
+	f.String("filter", "", "CloudWatch Logs filter pattern lines must match")
+
+	_ = appLogsCmd.MarkFlagRequired("env")
+}
+
+func runAppLogsCmd(cmd *cobra.Command, args []string) error {
+	apiClient, err := api.NewClient(serverAddr)
+	if err != nil {
+		return err
+	}
+
+	req := &server.AppLogsRequest{App: args[0]}
+	req.Env, _ = cmd.Flags().GetString("env")
+	req.Follow, _ = cmd.Flags().GetBool("follow")
+	req.Since, _ = cmd.Flags().GetDuration("since")
+	req.Filter, _ = cmd.Flags().GetString("filter")
+
+	eventsCh, err := apiClient.AppLogs(req)
+	if err != nil {
+		return err
+	}
+	for e := range eventsCh {
+		if e.Err != nil {
+			return e.Err
+		}
+		fmt.Println(e.Msg)
+	}
+	return nil
+}
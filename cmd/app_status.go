@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/api"
+	"github.com/spf13/cobra"
+	"sort"
+	"time"
+)
+
+var appStatusCmd = &cobra.Command{
+	Use:   "status --env ENV [flags] APP",
+	Short: "Get the live status of an Application",
+	Long: `
+    This command displays the current state of an application as reported by ECS
+    and the load balancer. It returns the number of running, pending & desired tasks,
+    the task definition & images in use, recent events of the app's ECS service,
+    reasons of recently stopped tasks and the health of the app's load balancer targets.`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runAppStatusCmd,
+	Example: "cloudfauj app status --env staging demo-server",
+}
+
+func init() {
+	appStatusCmd.Flags().String("env", "", "The environment the app is deployed in")
+	_ = appStatusCmd.MarkFlagRequired("env")
+}
+
+func runAppStatusCmd(cmd *cobra.Command, args []string) error {
+	env, _ := cmd.Flags().GetString("env")
+	apiClient, err := api.NewClient(serverAddr)
+	if err != nil {
+		return err
+	}
+	s, err := apiClient.AppStatus(args[0], env)
+	if err != nil {
+		return err
+	}
+	desc := `
+    App:             %s
+    Environment:     %s
+    Service Status:  %s
+    Tasks:           %d running, %d pending, %d desired
+    Task Definition: %s
+`
+	fmt.Printf(desc, s.App, s.Environment, s.Status, s.RunningCount, s.PendingCount, s.DesiredCount, s.TaskDefinition)
+
+	containers := make([]string, 0, len(s.Images))
+	for c := range s.Images {
+		containers = append(containers, c)
+	}
+	sort.Strings(containers)
+	fmt.Println("    Images:")
+	for _, c := range containers {
+		fmt.Printf("      %s: %s\n", c, s.Images[c])
+	}
+
+	if s.Targets != nil {
+		fmt.Println("\n    Load Balancer Targets:")
+		if len(s.Targets) == 0 {
+			fmt.Println("      No targets registered")
+		}
+		for _, t := range s.Targets {
+			fmt.Printf("      %s:%d  %s", t.Id, t.Port, t.State)
+			if t.Description != "" {
+				fmt.Printf(" (%s)", t.Description)
+			}
+			fmt.Println()
+		}
+	}
+
+	if len(s.StoppedTasks) > 0 {
+		fmt.Println("\n    Recently Stopped Tasks:")
+		for _, t := range s.StoppedTasks {
+			fmt.Printf("      %s  %s  %s\n", t.StoppedAt.Local().Format(time.RFC1123), t.Id, t.Reason)
+		}
+	}
+
+	fmt.Println("\n    Recent Events:")
+	if len(s.Events) == 0 {
+		fmt.Println("      No events")
+	}
+	for _, e := range s.Events {
+		fmt.Printf("      %s  %s\n", e.CreatedAt.Local().Format(time.RFC1123), e.Message)
+	}
+	fmt.Println()
+	return nil
+}
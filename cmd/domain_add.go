@@ -6,6 +6,7 @@ import (
 	"github.com/cloudfauj/cloudfauj/domain"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"os"
 )
 
 var domainAddCmd = &cobra.Command{
@@ -16,13 +17,27 @@ var domainAddCmd = &cobra.Command{
 
     Adding a domain is necessary before you can start using it to assign URLs to apps.
     Upon adding, Cloudfauj creates some AWS infrastructure like ACM Certificates and
-    Route53 Hosted Zone to manage URLs.
+    Route53 Hosted Zone to manage URLs. Domains hosted on Cloudflare use their
+    existing Cloudflare zone instead.
 
     This command outputs NS records of the hosted zone that need to be configured for
-    your domain in your domain provider's dashboard.`,
+    your domain in your domain provider's dashboard.
+
+    To use a certificate obtained outside of Cloudfauj, set the certificate authority
+    to custom and either import it from PEM files or reference an existing ACM certificate.
+    Imported certificates are not renewed automatically.`,
 	Args:    cobra.ExactArgs(1),
 	RunE:    runDomainAddCmd,
-	Example: "cloudfauj domain add example.com",
+	Example: "cloudfauj domain add example.com.yml --cert ./cert.pem --cert-chain ./chain.pem --private-key ./key.pem",
+}
+
+func init() {
+	f := domainAddCmd.Flags()
+
+	f.String("cert", "", "PEM file containing the certificate to import into ACM")
+	f.String("cert-chain", "", "PEM file containing the intermediate chain of the certificate to import")
+	f.String("private-key", "", "PEM file containing the unencrypted private key of the certificate to import")
+	f.String("cert-arn", "", "ARN of an existing ACM certificate to use")
 }
 
 func runDomainAddCmd(cmd *cobra.Command, args []string) error {
@@ -36,6 +51,14 @@ func runDomainAddCmd(cmd *cobra.Command, args []string) error {
 	initConfig(args[0])
 	_ = viper.Unmarshal(&d)
 
+	c, err := certificateFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		d.Certificate = c
+	}
+
 	eventsCh, err := apiClient.AddDomain(d)
 	if err != nil {
 		return err
@@ -48,3 +71,32 @@ func runDomainAddCmd(cmd *cobra.Command, args []string) error {
 	}
 	return nil
 }
+
+// certificateFromFlags returns the custom certificate specified via flags,
+// or nil if none was specified.
+func certificateFromFlags(cmd *cobra.Command) (*domain.Certificate, error) {
+	c := &domain.Certificate{}
+	c.Arn, _ = cmd.Flags().GetString("cert-arn")
+
+	files := map[string]*string{
+		"cert":        &c.Body,
+		"cert-chain":  &c.Chain,
+		"private-key": &c.PrivateKey,
+	}
+	for flag, dest := range files {
+		f, _ := cmd.Flags().GetString(flag)
+		if f == "" {
+			continue
+		}
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", flag, err)
+		}
+		*dest = string(content)
+	}
+
+	if *c == (domain.Certificate{}) {
+		return nil, nil
+	}
+	return c, nil
+}
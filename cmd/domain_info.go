@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/api"
+	"github.com/spf13/cobra"
+	"math"
+	"strings"
+	"time"
+)
+
+// Number of days before expiry from which a certificate that isn't renewed
+// automatically is reported as expiring.
+const certExpiryWarningDays = 30
+
+var domainInfoCmd = &cobra.Command{
+	Use:   "info [flags] DOMAIN",
+	Short: "Get information about a Domain",
+	Long: `
+    This command displays information about a domain added to Cloudfauj.
+    Among other things, it returns the NS records of the domain's hosted zone,
+    whether the domain is delegated to them and the status & expiry of the
+    domain's TLS certificate.
+
+    ACM can only validate & issue a certificate after the domain is delegated.`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runDomainInfoCmd,
+	Example: "cloudfauj domain info example.com",
+}
+
+func runDomainInfoCmd(cmd *cobra.Command, args []string) error {
+	apiClient, err := api.NewClient(serverAddr)
+	if err != nil {
+		return err
+	}
+	d, err := apiClient.Domain(args[0])
+	if err != nil {
+		return err
+	}
+	desc := `
+    Name:                  %s
+    DNS Service:           %s
+    Certificate Authority: %s
+    Hosted Zone ID:        %s
+    NS Records:            %s
+`
+	fmt.Printf(desc, d.Name, d.DNSService, d.CertificateAuthority, d.ZoneId, strings.Join(d.NameServers, ", "))
+
+	switch dl := d.Delegation; {
+	case dl == nil:
+	case dl.Error != "":
+		fmt.Printf("    Delegation:            unknown, failed to resolve NS records: %s\n", dl.Error)
+	case dl.Delegated:
+		fmt.Println("    Delegation:            OK")
+	default:
+		fmt.Printf(
+			"    Delegation:            NS records resolve to %s, configure the above with your domain provider\n",
+			strings.Join(dl.NameServers, ", "),
+		)
+	}
+
+	if c := d.CertificateStatus; c != nil {
+		desc := `    Certificate ARN:       %s
+    Certificate Status:    %s
+`
+		fmt.Printf(desc, c.Arn, c.Status)
+
+		if !c.NotAfter.IsZero() {
+			days := int(math.Floor(time.Until(c.NotAfter).Hours() / 24))
+			fmt.Printf("    Certificate Expiry:    %s (%d days)\n", c.NotAfter.Format(time.RFC1123), days)
+
+			if c.Imported && days < certExpiryWarningDays {
+				fmt.Println("\n    WARNING: Certificate is not renewed automatically, replace it before it expires")
+			}
+		}
+	}
+	fmt.Println()
+	return nil
+}
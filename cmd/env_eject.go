@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/api"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var envEjectCmd = &cobra.Command{
+	Use:   "eject --out DIR [flags] ENV",
+	Short: "Eject an Environment as a standalone Terraform project",
+	Long: `
+    This command exports the Terraform configuration and state of an environment,
+    its domain and all its applications into a self-contained Terraform project.
+
+    Every application receives a variables file containing the values it was last
+    deployed with. Remote state paths are rewritten to be relative to the project.
+
+    Once ejected, the environment is marked as unmanaged and Cloudfauj no longer
+    makes any changes to it. Running env destroy over an unmanaged environment only
+    removes it from Cloudfauj, without destroying its infrastructure. Until then,
+    an unmanaged environment can be ejected again.
+
+    The output directory must not already exist.`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runEnvEjectCmd,
+	Example: "cloudfauj env eject --out ./staging-infra staging",
+}
+
+func init() {
+	envEjectCmd.Flags().String("out", "", "Directory to write the Terraform project to")
+	_ = envEjectCmd.MarkFlagRequired("out")
+}
+
+func runEnvEjectCmd(cmd *cobra.Command, args []string) error {
+	apiClient, err := api.NewClient(serverAddr)
+	if err != nil {
+		return err
+	}
+
+	out, _ := cmd.Flags().GetString("out")
+	if _, err := os.Stat(out); err == nil {
+		return fmt.Errorf("%s already exists", out)
+	}
+
+	fmt.Printf("Ejecting %s\n", args[0])
+	archive, err := apiClient.EjectEnvironment(args[0])
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	if err := extractTarball(archive, out); err != nil {
+		return fmt.Errorf(
+			"failed to write terraform project: %v\nThe environment is unmanaged now, eject it again to retry", err,
+		)
+	}
+	fmt.Printf("Terraform project written to %s\n", out)
+	return nil
+}
+
+// extractTarball extracts a gzipped tar archive into the given directory
+func extractTarball(r io.Reader, dir string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// never write outside the target directory
+		p := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(p, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return errors.New("archive contains an invalid path: " + hdr.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/api"
+	"github.com/cloudfauj/cloudfauj/environment"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var envImportCmd = &cobra.Command{
+	Use:   "import --config PATH --vpc ID --subnets IDS",
+	Short: "Create an Environment from existing infrastructure",
+	Long: `
+    This command lets you create a new environment upon AWS resources that
+    already exist in your account.
+
+    The environment uses the specified VPC & subnets instead of provisioning its
+    own network. Optionally, an existing ECS cluster and Application Load Balancer
+    can be used as well. Cloudfauj only reads these resources and never modifies
+    or destroys them.
+
+    The config is the same as the one used to create a new environment.`,
+	RunE:    runEnvImportCmd,
+	Example: "cloudfauj env import --config ./cloudfauj-env.yml --vpc vpc-0a1b2c --subnets subnet-01,subnet-02 --ecs-cluster main",
+}
+
+func init() {
+	f := envImportCmd.Flags()
+
+	f.String("config", "", "Configuration file to create an environment from")
+	f.String("vpc", "", "ID of the existing VPC")
+	f.StringSlice("subnets", nil, "Comma-separated IDs of existing subnets in the VPC to run applications in")
+	f.String("ecs-cluster", "", "Name of the existing ECS cluster to run applications in")
+	f.String("alb", "", "Name of the existing Application Load Balancer to route traffic through")
+
+	_ = envImportCmd.MarkFlagRequired("config")
+	_ = envImportCmd.MarkFlagRequired("vpc")
+	_ = envImportCmd.MarkFlagRequired("subnets")
+}
+
+func runEnvImportCmd(cmd *cobra.Command, args []string) error {
+	apiClient, err := api.NewClient(serverAddr)
+	if err != nil {
+		return err
+	}
+	configFile, _ := cmd.Flags().GetString("config")
+	initConfig(configFile)
+
+	var env environment.Environment
+	_ = viper.Unmarshal(&env)
+
+	existing := &environment.ExistingResources{}
+	existing.VpcId, _ = cmd.Flags().GetString("vpc")
+	existing.SubnetIds, _ = cmd.Flags().GetStringSlice("subnets")
+	existing.EcsCluster, _ = cmd.Flags().GetString("ecs-cluster")
+	existing.Alb, _ = cmd.Flags().GetString("alb")
+	env.Existing = existing
+
+	fmt.Printf("Requesting import of %s\n\n", env.Name)
+	eventsCh, err := apiClient.ImportEnvironment(&env)
+	if err != nil {
+		return err
+	}
+	for e := range eventsCh {
+		if e.Err != nil {
+			return e.Err
+		}
+		fmt.Println(e.Msg)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/api"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+var envInfoCmd = &cobra.Command{
+	Use:   "info [flags] ENV",
+	Short: "Get information about an Environment",
+	Long: `
+    This command displays information about an environment.
+    Among other things, it returns its status, configuration, the DNS name
+    of its load balancer and the applications deployed in it.`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runEnvInfoCmd,
+	Example: "cloudfauj env info staging",
+}
+
+func runEnvInfoCmd(cmd *cobra.Command, args []string) error {
+	apiClient, err := api.NewClient(serverAddr)
+	if err != nil {
+		return err
+	}
+	e, err := apiClient.Environment(args[0])
+	if err != nil {
+		return err
+	}
+	desc := `
+    Name:          %s
+    Status:        %s
+    Network:       %s
+    Orchestrator:  %s
+    VPC CIDR:      %s
+    Network Mode:  %s
+    NAT Gateways:  %s
+    Domain:        %s
+    Load Balancer: %s
+    ALB DNS Name:  %s
+`
+	fmt.Printf(
+		desc,
+		e.Name,
+		e.Status,
+		e.Network,
+		e.Orchestrator,
+		orNone(e.VpcCidr),
+		orNone(e.NetworkMode),
+		orNone(e.NatGateways),
+		orNone(e.Domain),
+		orNone(e.LoadBalancer),
+		orNone(e.AlbDNSName),
+	)
+
+	if ex := e.Existing; ex != nil {
+		desc := `    Existing VPC:     %s
+    Existing Subnets: %s
+    Existing Cluster: %s
+    Existing ALB:     %s
+`
+		fmt.Printf(desc, ex.VpcId, strings.Join(ex.SubnetIds, ", "), orNone(ex.EcsCluster), orNone(ex.Alb))
+	}
+
+	if len(e.Apps) == 0 {
+		fmt.Println("    Apps:          none")
+	} else {
+		fmt.Printf("    Apps:          %s\n", strings.Join(e.Apps, ", "))
+	}
+	fmt.Println()
+	return nil
+}
+
+// orNone returns the given value, or "-" if it is empty
+func orNone(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
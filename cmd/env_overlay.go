@@ -0,0 +1,18 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+var envOverlayCmd = &cobra.Command{
+	Use:   "overlay",
+	Short: "Manage Terraform overlays of an Environment",
+	Long: `
+    This command lets Ops add their own Terraform configuration files to an
+    environment, alongside the configuration generated by Cloudfauj.
+
+    An overlay is a .tf file that can add new resources or override the ones
+    generated by Cloudfauj (see Terraform's override files). Overlays are
+    preserved whenever Cloudfauj regenerates the configuration.
+
+    Overlays can either apply to the environment itself or to all the
+    applications deployed in it.`,
+}
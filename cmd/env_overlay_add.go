@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/api"
+	"github.com/cloudfauj/cloudfauj/environment"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+var envOverlayAddCmd = &cobra.Command{
+	Use:   "add --env ENV [flags] FILE",
+	Short: "Add a Terraform overlay to an Environment",
+	Long: `
+    This command adds a Terraform configuration file as an overlay to an
+    environment. If an overlay with the same name already exists, it is replaced.
+
+    The overlay is validated with terraform validate before it is accepted.
+    Environment overlays are applied by running tf apply over the environment.
+
+    With --apps, the overlay is added to every application in the environment
+    instead and is applied to each app on its next deployment.`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runEnvOverlayAddCmd,
+	Example: "cloudfauj env overlay add --env staging ./alb_override.tf",
+}
+
+func init() {
+	f := envOverlayAddCmd.Flags()
+	f.String("env", "", "The environment to add the overlay to")
+	f.String("name", "", "Name of the overlay file, defaults to the name of FILE")
+	f.Bool("apps", false, "Add the overlay to all applications in the environment")
+	_ = envOverlayAddCmd.MarkFlagRequired("env")
+}
+
+func runEnvOverlayAddCmd(cmd *cobra.Command, args []string) error {
+	apiClient, err := api.NewClient(serverAddr)
+	if err != nil {
+		return err
+	}
+
+	f := cmd.Flags()
+	env, _ := f.GetString("env")
+	name, _ := f.GetString("name")
+	apps, _ := f.GetBool("apps")
+
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read overlay file: %v", err)
+	}
+	if name == "" {
+		name = filepath.Base(args[0])
+	}
+	o := &environment.Overlay{Name: name, Scope: environment.OverlayScopeEnv, Content: string(content)}
+	if apps {
+		o.Scope = environment.OverlayScopeApps
+	}
+
+	eventsCh, err := apiClient.AddEnvOverlay(env, o)
+	if err != nil {
+		return err
+	}
+	for e := range eventsCh {
+		if e.Err != nil {
+			return e.Err
+		}
+		fmt.Println(e.Msg)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/api"
+	"github.com/cloudfauj/cloudfauj/environment"
+	"github.com/spf13/cobra"
+)
+
+var envOverlayDeleteCmd = &cobra.Command{
+	Use:   "delete --env ENV [flags] NAME",
+	Short: "Delete a Terraform overlay from an Environment",
+	Long: `
+    This command removes an overlay from an environment.
+
+    Removing an overlay doesn't change any infrastructure by itself. Run tf apply
+    over the environment (or re-deploy the apps, if --apps is used) to remove
+    the resources it created.`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runEnvOverlayDeleteCmd,
+	Example: "cloudfauj env overlay delete --env staging alb_override.tf",
+}
+
+func init() {
+	f := envOverlayDeleteCmd.Flags()
+	f.String("env", "", "The environment to delete the overlay from")
+	f.Bool("apps", false, "Delete the overlay from all applications in the environment")
+	_ = envOverlayDeleteCmd.MarkFlagRequired("env")
+}
+
+func runEnvOverlayDeleteCmd(cmd *cobra.Command, args []string) error {
+	apiClient, err := api.NewClient(serverAddr)
+	if err != nil {
+		return err
+	}
+
+	f := cmd.Flags()
+	env, _ := f.GetString("env")
+	apps, _ := f.GetBool("apps")
+
+	scope := environment.OverlayScopeEnv
+	if apps {
+		scope = environment.OverlayScopeApps
+	}
+	if err := apiClient.DeleteEnvOverlay(env, args[0], scope); err != nil {
+		return err
+	}
+	fmt.Println("Done")
+	return nil
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/api"
+	"github.com/spf13/cobra"
+)
+
+var envOverlayListCmd = &cobra.Command{
+	Use:   "ls [flags] ENV",
+	Short: "List Terraform overlays of an Environment",
+	Long: `
+    This command returns a list of all overlays added to an environment,
+    along with whether they apply to the environment or its applications.`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runEnvOverlayListCmd,
+	Example: "cloudfauj env overlay ls staging",
+}
+
+func runEnvOverlayListCmd(cmd *cobra.Command, args []string) error {
+	apiClient, err := api.NewClient(serverAddr)
+	if err != nil {
+		return err
+	}
+	res, err := apiClient.ListEnvOverlays(args[0])
+	if err != nil {
+		return err
+	}
+	if len(res) == 0 {
+		fmt.Println("No overlays added yet")
+	}
+	for _, o := range res {
+		fmt.Printf("%s (%s)\n", o.Name, o.Scope)
+	}
+	return nil
+}
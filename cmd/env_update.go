@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/api"
+	"github.com/cloudfauj/cloudfauj/environment"
+	"github.com/cloudfauj/cloudfauj/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var envUpdateCmd = &cobra.Command{
+	Use:   "update [flags] ENV",
+	Short: "Change the configuration of an Environment",
+	Long: `
+    This command lets you change the configuration of an existing environment.
+
+    A new configuration can be provided to change the environment in place. Only its
+    domain, load balancer, NAT gateways & log retention can be changed. Settings that
+    can't be changed, such as the network & VPC CIDR, must match the current configuration.
+
+    A domain can also be attached to or detached from the environment using flags.
+    The environment keeps its load balancer when a domain is detached, so apps remain
+    reachable via path-based URLs.
+
+    The changes to the environment's infrastructure are shown before being applied.
+    All applications in the environment are then reapplied to pick up the change,
+    eg- their URLs move to the domain when it is attached. Apps whose routing depends
+    on the current configuration, such as custom hostnames, must be changed before
+    the environment can be updated.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runEnvUpdateCmd,
+	Example: `cloudfauj env update staging --domain example.com
+cloudfauj env update staging --config ./cloudfauj-env.yml`,
+}
+
+func init() {
+	f := envUpdateCmd.Flags()
+
+	f.String("config", "", "Configuration file to update the environment to")
+	f.String("domain", "", "Domain to attach to the environment")
+	f.Bool("no-domain", false, "Detach the domain from the environment")
+	f.Bool("auto-approve", false, "Apply the changes without asking for confirmation")
+}
+
+func runEnvUpdateCmd(cmd *cobra.Command, args []string) error {
+	apiClient, err := api.NewClient(serverAddr)
+	if err != nil {
+		return err
+	}
+
+	var u server.EnvUpdate
+	configFile, _ := cmd.Flags().GetString("config")
+	domain, _ := cmd.Flags().GetString("domain")
+	noDomain, _ := cmd.Flags().GetBool("no-domain")
+	autoApprove, _ := cmd.Flags().GetBool("auto-approve")
+	switch {
+	case configFile != "" && (domain != "" || noDomain):
+		return errors.New("--config cannot be used together with --domain or --no-domain")
+	case domain != "" && noDomain:
+		return errors.New("--domain and --no-domain cannot be used together")
+	case configFile != "":
+		initConfig(configFile)
+		u.Config = &environment.Environment{}
+		_ = viper.Unmarshal(u.Config)
+		if u.Config.Name != args[0] {
+			return fmt.Errorf("config is for environment %s, not %s", u.Config.Name, args[0])
+		}
+	case domain != "":
+		u.Domain = &domain
+	case noDomain:
+		u.Domain = new(string)
+	default:
+		return errors.New("nothing to update, specify the changes to make")
+	}
+
+	fmt.Printf("Planning changes to %s\n\n", args[0])
+	u.Plan = true
+	if err := sendEnvUpdate(apiClient, args[0], &u); err != nil {
+		return err
+	}
+	if !autoApprove && !confirm("Apply these changes?") {
+		return nil
+	}
+
+	fmt.Printf("\nUpdating %s\n\n", args[0])
+	u.Plan = false
+	return sendEnvUpdate(apiClient, args[0], &u)
+}
+
+func sendEnvUpdate(apiClient *api.API, env string, u *server.EnvUpdate) error {
+	eventsCh, err := apiClient.UpdateEnvironment(env, u)
+	if err != nil {
+		return err
+	}
+	for e := range eventsCh {
+		if e.Err != nil {
+			return e.Err
+		}
+		fmt.Println(e.Msg)
+	}
+	return nil
+}
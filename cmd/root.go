@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"os"
+	"strings"
 )
 
 var serverAddr string
@@ -27,10 +29,12 @@ func Execute() {
 }
 
 func init() {
-	appCmd.AddCommand(appDestroyCmd)
-	envCmd.AddCommand(envCreateCmd, envDestroyCmd, envListCmd)
+	serverCmd.AddCommand(serverUpgradeTerraformCmd)
+	appCmd.AddCommand(appListCmd, appInfoCmd, appStatusCmd, appLogsCmd, appExecCmd, appDestroyCmd)
+	envOverlayCmd.AddCommand(envOverlayAddCmd, envOverlayListCmd, envOverlayDeleteCmd)
+	envCmd.AddCommand(envCreateCmd, envImportCmd, envUpdateCmd, envDestroyCmd, envListCmd, envInfoCmd, envOverlayCmd, envEjectCmd)
 	deploymentCmd.AddCommand(deploymentInfoCmd, deploymentLogsCmd, deploymentListCmd)
-	domainCmd.AddCommand(domainAddCmd, domainDeleteCmd, domainListCmd)
+	domainCmd.AddCommand(domainAddCmd, domainInfoCmd, domainDeleteCmd, domainListCmd)
 	tfCmd.AddCommand(tfPlanCmd, tfApplyCmd)
 
 	rootCmd.PersistentFlags().StringVar(
@@ -59,3 +63,11 @@ func initConfig(file string) {
 		os.Exit(1)
 	}
 }
+
+// confirm asks the user a yes/no question on the terminal and
+// returns true only if they answer yes.
+func confirm(question string) bool {
+	fmt.Printf("%s (yes/no): ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(strings.ToLower(answer)) == "yes"
+}
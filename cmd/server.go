@@ -6,16 +6,22 @@ import (
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/cloudfauj/cloudfauj/infrastructure"
 	"github.com/cloudfauj/cloudfauj/server"
 	"github.com/cloudfauj/cloudfauj/state"
+	"github.com/hashicorp/terraform-exec/tfexec"
 	"github.com/hashicorp/terraform-exec/tfinstall"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"net"
 	"net/http"
 	"os"
 	"path"
@@ -47,12 +53,12 @@ func runServerCmd(cmd *cobra.Command, args []string) error {
 	srvCfgFile, _ := cmd.Flags().GetString("config")
 	initConfig(srvCfgFile)
 
-	d := viper.GetString("data_dir")
-	if d == "" {
-		log.Warn("Server data directory not specified, using current directory")
-		d, _ = os.Getwd()
+	srvCfg := newServerConfig(log)
+
+	cidrPool, cidrExclusions, err := vpcCIDRPool()
+	if err != nil {
+		return err
 	}
-	srvCfg := server.NewConfig(d)
 
 	// aws authentication
 	log.Info("Validating AWS credentials")
@@ -85,11 +91,23 @@ func runServerCmd(cmd *cobra.Command, args []string) error {
 	//  See https://github.com/hashicorp/terraform-exec/pull/100.
 
 	infra := &infrastructure.Infrastructure{
-		Log:      log,
-		Region:   awsCfg.Region,
-		Ec2:      ec2.NewFromConfig(awsCfg),
-		Ecs:      ecs.NewFromConfig(awsCfg),
-		TFBinary: path.Join(srvCfg.DataDir(), "terraform"),
+		Log:                log,
+		Region:             awsCfg.Region,
+		Ec2:                ec2.NewFromConfig(awsCfg),
+		Ecs:                ecs.NewFromConfig(awsCfg),
+		Acm:                acm.NewFromConfig(awsCfg),
+		Elbv2:              elasticloadbalancingv2.NewFromConfig(awsCfg),
+		Iam:                iam.NewFromConfig(awsCfg),
+		Logs:               cloudwatchlogs.NewFromConfig(awsCfg),
+		TFBinary:           srvCfg.TerraformBinary(),
+		AWSProviderVersion: awsProviderVersion(),
+		CloudflareAPIToken: viper.GetString("cloudflare_api_token"),
+		Resolver:           dnsResolver(),
+		VpcCIDRPool:        cidrPool,
+		VpcCIDRExclusions:  cidrExclusions,
+	}
+	if err := server.BackfillState(cmd.Context(), srvCfg, log, storage, infra); err != nil {
+		return fmt.Errorf("failed to backfill state: %v", err)
 	}
 	apiServer := server.New(srvCfg, log, storage, infra)
 	bindAddr := viper.GetString("bind_host") + ":" + viper.GetString("bind_port")
@@ -101,11 +119,78 @@ func runServerCmd(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// newServerConfig returns the server configuration based on the
+// configuration file loaded into viper.
+func newServerConfig(log *logrus.Logger) *server.Config {
+	d := viper.GetString("data_dir")
+	if d == "" {
+		log.Warn("Server data directory not specified, using current directory")
+		d, _ = os.Getwd()
+	}
+	c := server.NewConfig(d)
+	if v := viper.GetString("terraform_version"); v != "" {
+		c.SetTerraformVersion(v)
+	}
+	c.SetIAMAllowedActions(viper.GetStringSlice("iam_allowed_actions"))
+	return c
+}
+
+// awsProviderVersion returns the version of Terraform AWS provider
+// specified in the server configuration file loaded into viper.
+func awsProviderVersion() string {
+	if v := viper.GetString("terraform_aws_provider_version"); v != "" {
+		return v
+	}
+	return infrastructure.DefaultAWSProviderVersion
+}
+
+// vpcCIDRPool returns the range to allocate VPC CIDRs from and the ranges
+// to never allocate, as specified in the server configuration loaded into viper.
+func vpcCIDRPool() (*net.IPNet, []*net.IPNet, error) {
+	p := viper.GetString("vpc_cidr_pool")
+	if p == "" {
+		p = infrastructure.DefaultVpcCIDRPool
+	}
+	_, pool, err := net.ParseCIDR(p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid vpc_cidr_pool: %v", err)
+	}
+
+	var exclusions []*net.IPNet
+	for _, e := range viper.GetStringSlice("vpc_cidr_exclusions") {
+		_, ipn, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CIDR in vpc_cidr_exclusions: %v", err)
+		}
+		exclusions = append(exclusions, ipn)
+	}
+	return pool, exclusions, nil
+}
+
+// dnsResolver returns the resolver used to look up DNS records of domains.
+// If the server configuration specifies a DNS server, all lookups are sent to it.
+func dnsResolver() *net.Resolver {
+	addr := viper.GetString("dns_resolver")
+	if addr == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
 func setupDataDir(ctx context.Context, log *logrus.Logger, srvCfg *server.Config) error {
 	_, err := os.Stat(srvCfg.DataDir())
 	if err == nil {
 		log.WithField("dir", srvCfg.DataDir()).Info("Found data directory")
-		return nil
+		return setupTerraform(ctx, log, srvCfg)
 	}
 	if !os.IsNotExist(err) {
 		// unless the error is "dir not found", propagate the unexpected err
@@ -124,7 +209,25 @@ func setupDataDir(ctx context.Context, log *logrus.Logger, srvCfg *server.Config
 	return setupTerraform(ctx, log, srvCfg)
 }
 
+// setupTerraform downloads the configured version of Terraform if the server
+// doesn't have a Terraform binary yet. Otherwise, it ensures that the existing
+// binary is of the configured version.
 func setupTerraform(ctx context.Context, log *logrus.Logger, srvCfg *server.Config) error {
+	if _, err := os.Stat(srvCfg.TerraformBinary()); err == nil {
+		v, err := terraformVersion(ctx, srvCfg.TerraformBinary())
+		if err != nil {
+			return err
+		}
+		if v != srvCfg.TerraformVersion() {
+			return fmt.Errorf(
+				"server is configured to use Terraform %s but has %s, run upgrade-terraform first",
+				srvCfg.TerraformVersion(),
+				v,
+			)
+		}
+		return nil
+	}
+
 	log.WithField("version", srvCfg.TerraformVersion()).Info("Downloading Terraform")
 	_, err := tfinstall.Find(
 		ctx,
@@ -136,6 +239,19 @@ func setupTerraform(ctx context.Context, log *logrus.Logger, srvCfg *server.Conf
 	return nil
 }
 
+// terraformVersion returns the version of the given Terraform binary
+func terraformVersion(ctx context.Context, binary string) (string, error) {
+	tf, err := tfexec.NewTerraform(path.Dir(binary), binary)
+	if err != nil {
+		return "", fmt.Errorf("failed to create new terraform object: %v", err)
+	}
+	v, _, err := tf.Version(ctx, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine terraform version: %v", err)
+	}
+	return v.String(), nil
+}
+
 func logger() *logrus.Logger {
 	l := logrus.New()
 	l.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
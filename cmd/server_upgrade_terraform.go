@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/infrastructure"
+	"github.com/hashicorp/terraform-exec/tfinstall"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path"
+)
+
+// Files of a Terraform module that are modified during an upgrade
+var tfUpgradeFiles = []string{"terraform.tf", ".terraform.lock.hcl"}
+
+var serverUpgradeTerraformCmd = &cobra.Command{
+	Use:   "upgrade-terraform --config PATH",
+	Short: "Upgrade Terraform and the AWS provider used by the server",
+	Long: `
+    This command upgrades the Terraform binary and the Terraform AWS provider
+    used by Cloudfauj Server to the versions specified in the server configuration.
+
+    It downloads the new Terraform version, rewrites the core configuration of
+    every Terraform module managed by the server with the new AWS provider
+    version, upgrades the providers of each module and runs a plan over it to
+    report the impact of the upgrade. The plan of every module with changes to
+    its infrastructure is shown before asking for confirmation.
+
+    The upgrade is committed only after you confirm it. Otherwise, all modules
+    are restored to their previous state.
+
+    The server must be stopped while running this command.`,
+	RunE:    runServerUpgradeTerraformCmd,
+	Example: "cloudfauj server upgrade-terraform --config cf-server.yml",
+}
+
+func init() {
+	f := serverUpgradeTerraformCmd.Flags()
+	f.String("config", "", "Server configuration file")
+	f.Bool("auto-approve", false, "Commit the upgrade without asking for confirmation")
+	_ = serverUpgradeTerraformCmd.MarkFlagRequired("config")
+}
+
+func runServerUpgradeTerraformCmd(cmd *cobra.Command, args []string) error {
+	log := logger()
+	ctx := cmd.Context()
+
+	srvCfgFile, _ := cmd.Flags().GetString("config")
+	autoApprove, _ := cmd.Flags().GetBool("auto-approve")
+	initConfig(srvCfgFile)
+	srvCfg := newServerConfig(log)
+
+	awsCfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	current, err := terraformVersion(ctx, srvCfg.TerraformBinary())
+	if err != nil {
+		return err
+	}
+
+	// Stage the new Terraform binary, if the version needs to change
+	binary := srvCfg.TerraformBinary()
+	if current != srvCfg.TerraformVersion() {
+		dir := srvCfg.TerraformUpgradeDir()
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to clean up upgrade directory: %v", err)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create upgrade directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		log.WithField("version", srvCfg.TerraformVersion()).Info("Downloading Terraform")
+		binary, err = tfinstall.Find(ctx, tfinstall.ExactVersion(srvCfg.TerraformVersion(), dir))
+		if err != nil {
+			return fmt.Errorf("failed to download Terraform: %v", err)
+		}
+	}
+
+	modules, err := srvCfg.TerraformModuleDirs()
+	if err != nil {
+		return fmt.Errorf("failed to find terraform modules: %v", err)
+	}
+	backups, err := backupTFModules(modules)
+	if err != nil {
+		return fmt.Errorf("failed to back up terraform modules: %v", err)
+	}
+
+	infra := &infrastructure.Infrastructure{
+		Log:                log,
+		Region:             awsCfg.Region,
+		TFBinary:           binary,
+		AWSProviderVersion: awsProviderVersion(),
+	}
+	// modules whose plans contain changes, along with their plans
+	var changed []string
+	plans := make(map[string]string)
+	for _, m := range modules {
+		log.WithField("module", m).Info("Upgrading Terraform module")
+		// plans are only shown once all modules are upgraded
+		tf, err := infra.NewTerraform(m, io.Discard)
+		if err == nil {
+			var plan string
+			if plan, err = infra.UpgradeTFModule(ctx, tf); plan != "" {
+				changed = append(changed, m)
+				plans[m] = plan
+			}
+		}
+		if err != nil {
+			log.WithField("module", m).Errorf("Upgrade failed: %v", err)
+			restoreTFModules(ctx, log, srvCfg.TerraformBinary(), backups)
+			return errors.New("upgrade failed, all modules were restored")
+		}
+	}
+
+	fmt.Printf("\nUpgraded %d module(s) to Terraform %s and AWS provider %s\n", len(modules), srvCfg.TerraformVersion(), infra.AWSProviderVersion)
+	if len(changed) == 0 {
+		fmt.Println("No changes to infrastructure were planned")
+	} else {
+		for _, m := range changed {
+			fmt.Printf("\nChanges to infrastructure planned for %s:\n\n%s", m, plans[m])
+		}
+		fmt.Printf("\nChanges to infrastructure were planned for %d module(s)\n", len(changed))
+	}
+
+	if !autoApprove && !confirm("Commit the upgrade?") {
+		restoreTFModules(ctx, log, srvCfg.TerraformBinary(), backups)
+		return errors.New("upgrade aborted, all modules were restored")
+	}
+	if binary != srvCfg.TerraformBinary() {
+		if err := os.Rename(binary, srvCfg.TerraformBinary()); err != nil {
+			return fmt.Errorf("failed to replace terraform binary: %v", err)
+		}
+	}
+	log.Info("Upgrade committed successfully")
+	return nil
+}
+
+// backupTFModules returns the contents of all files modified by an upgrade
+// for each of the given modules. A file that doesn't exist has nil content.
+func backupTFModules(modules []string) (map[string]map[string][]byte, error) {
+	res := make(map[string]map[string][]byte)
+	for _, m := range modules {
+		res[m] = make(map[string][]byte)
+		for _, f := range tfUpgradeFiles {
+			content, err := os.ReadFile(path.Join(m, f))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			res[m][f] = content
+		}
+	}
+	return res, nil
+}
+
+// restoreTFModules restores modules from their backups and re-initializes
+// them with the given Terraform binary.
+func restoreTFModules(
+	ctx context.Context, log *logrus.Logger, binary string, backups map[string]map[string][]byte,
+) {
+	infra := &infrastructure.Infrastructure{Log: log, TFBinary: binary}
+	for m, files := range backups {
+		for f, content := range files {
+			var err error
+			if content == nil {
+				err = os.Remove(path.Join(m, f))
+			} else {
+				err = os.WriteFile(path.Join(m, f), content, 0666)
+			}
+			if err != nil && !os.IsNotExist(err) {
+				log.WithField("module", m).Errorf("Failed to restore %s: %v", f, err)
+			}
+		}
+		tf, err := infra.NewTerraform(m, nil)
+		if err == nil {
+			err = tf.Init(ctx)
+		}
+		if err != nil {
+			log.WithField("module", m).Errorf("Failed to re-initialize terraform: %v", err)
+		}
+	}
+}
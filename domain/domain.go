@@ -1,28 +1,121 @@
 package domain
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
+	"regexp"
 	"strings"
+	"time"
 )
 
-const DNSServiceRoute53 = "aws_route53"
-const CertAuthorityACM = "aws_acm"
+const (
+	DNSServiceRoute53    = "aws_route53"
+	DNSServiceCloudflare = "cloudflare"
+)
+
+const (
+	// ACM issues a DNS-validated wildcard certificate for the domain
+	CertAuthorityACM = "aws_acm"
+	// The certificate is obtained outside of Cloudfauj, eg- from a corporate CA
+	CertAuthorityCustom = "custom"
+)
+
+var acmArnRegex = regexp.MustCompile(`^arn:aws[a-z-]*:acm:[a-z0-9-]+:\d{12}:certificate/[a-z0-9-]+$`)
 
 type Domain struct {
 	Name                 string `json:"name"`
 	DNSService           string `json:"dns_service" mapstructure:"dns_service"`
 	CertificateAuthority string `json:"cert_authority" mapstructure:"cert_authority"`
+
+	// The TLS certificate used by the domain when its certificate authority is custom
+	Certificate *Certificate `json:"certificate,omitempty"`
+}
+
+// Certificate is a TLS certificate obtained outside of Cloudfauj.
+// Either an existing ACM certificate is referenced or one is imported into ACM.
+// The certificate must cover the domain & its wildcard.
+type Certificate struct {
+	// ARN of a certificate already present in ACM
+	Arn string `json:"arn,omitempty"`
+
+	// PEM encoded certificate, its intermediate chain & unencrypted private key
+	// to import into ACM
+	Body       string `json:"body,omitempty"`
+	Chain      string `json:"chain,omitempty"`
+	PrivateKey string `json:"private_key,omitempty" mapstructure:"private_key"`
 }
 
 func (d *Domain) CheckIsValid() error {
 	if len(strings.TrimSpace(d.Name)) == 0 {
 		return errors.New("name cannot be empty")
 	}
-	if d.DNSService != DNSServiceRoute53 {
-		return errors.New("only " + DNSServiceRoute53 + " DNS service is supported as of now")
+	if d.DNSService != DNSServiceRoute53 && d.DNSService != DNSServiceCloudflare {
+		return errors.New("DNS service must be one of " + DNSServiceRoute53 + ", " + DNSServiceCloudflare)
 	}
-	if d.CertificateAuthority != CertAuthorityACM {
-		return errors.New("only " + CertAuthorityACM + " certificate authority is supported as of now")
+
+	switch d.CertificateAuthority {
+	case CertAuthorityACM:
+		if d.Certificate != nil {
+			return errors.New("certificate can only be specified with " + CertAuthorityCustom + " certificate authority")
+		}
+	case CertAuthorityCustom:
+		if d.Certificate == nil {
+			return errors.New("certificate must be specified with " + CertAuthorityCustom + " certificate authority")
+		}
+		if err := d.Certificate.checkIsValid(d.Name); err != nil {
+			return errors.New("invalid certificate: " + err.Error())
+		}
+	default:
+		return errors.New("certificate authority must be one of " + CertAuthorityACM + ", " + CertAuthorityCustom)
 	}
 	return nil
 }
+
+// Imported returns true if the certificate is to be imported into ACM
+func (c *Certificate) Imported() bool {
+	return c.Arn == ""
+}
+
+func (c *Certificate) checkIsValid(domain string) error {
+	if !c.Imported() {
+		if c.Body != "" || c.Chain != "" || c.PrivateKey != "" {
+			return errors.New("either an ARN or a certificate to import must be specified, not both")
+		}
+		if !acmArnRegex.MatchString(c.Arn) {
+			return errors.New("ARN must be that of an ACM certificate")
+		}
+		return nil
+	}
+
+	if c.Body == "" || c.PrivateKey == "" {
+		return errors.New("both certificate body & private key must be specified")
+	}
+	if _, err := tls.X509KeyPair([]byte(c.Body+"\n"+c.Chain), []byte(c.PrivateKey)); err != nil {
+		return err
+	}
+	cert, err := c.x509()
+	if err != nil {
+		return err
+	}
+	if time.Now().After(cert.NotAfter) {
+		return errors.New("certificate has expired")
+	}
+	if err := cert.VerifyHostname(domain); err != nil {
+		return err
+	}
+	if err := cert.VerifyHostname("*." + domain); err != nil {
+		return errors.New("certificate does not cover *." + domain)
+	}
+	return nil
+}
+
+// x509 returns the parsed certificate to import
+func (c *Certificate) x509() (*x509.Certificate, error) {
+	b, _ := pem.Decode([]byte(c.Body))
+	if b == nil || b.Type != "CERTIFICATE" {
+		return nil, errors.New("body must be a PEM encoded certificate")
+	}
+	return x509.ParseCertificate(b.Bytes)
+}
@@ -2,6 +2,7 @@ package environment
 
 import (
 	"errors"
+	"net"
 	"strings"
 )
 
@@ -9,12 +10,37 @@ const (
 	StatusProvisioning = "provisioning"
 	StatusProvisioned  = "provisioned"
 	StatusDestroying   = "destroying"
+	// StatusUpdating means the environment's configuration is being changed
+	StatusUpdating = "updating"
+
+	// StatusUnmanaged means the environment's infrastructure has been
+	// ejected and is no longer managed by Cloudfauj.
+	StatusUnmanaged = "unmanaged"
 )
 
 const NetworkAWS = "aws"
 const OrchFargate = "aws_ecs_fargate"
 const LoadBalALB = "aws_alb"
 
+const (
+	// NetworkModePublic runs applications in a public subnet with public IPs
+	NetworkModePublic = "public"
+	// NetworkModePrivate runs applications in private subnets across multiple
+	// AZs, with outbound internet access via NAT gateways
+	NetworkModePrivate = "private"
+
+	// NatGatewaySingle creates one NAT gateway shared by all AZs
+	NatGatewaySingle = "single"
+	// NatGatewayPerAZ creates a NAT gateway in every AZ for high availability
+	NatGatewayPerAZ = "per_az"
+)
+
+// Number of days CloudWatch can retain logs for
+var validLogRetention = map[int]bool{
+	1: true, 3: true, 5: true, 7: true, 14: true, 30: true, 60: true, 90: true, 120: true,
+	150: true, 180: true, 365: true, 400: true, 545: true, 731: true, 1827: true, 3653: true,
+}
+
 // A Cloudfauj Environment that can contain applications
 type Environment struct {
 	Name         string `json:"name"`
@@ -24,9 +50,36 @@ type Environment struct {
 	Domain       string `json:"domain"`
 	LoadBalancer string `json:"load_balancer" mapstructure:"load_balancer"`
 
+	// CIDR block of the environment's VPC.
+	// If not specified, one is allocated from the server's VPC CIDR pool.
+	VpcCidr string `json:"vpc_cidr,omitempty" mapstructure:"vpc_cidr"`
+
+	// Networking mode of the subnets applications run in. Defaults to public.
+	NetworkMode string `json:"network_mode,omitempty" mapstructure:"network_mode"`
+	// NAT gateway setup for private networking mode. Defaults to single.
+	NatGateways string `json:"nat_gateways,omitempty" mapstructure:"nat_gateways"`
+
+	// Number of days the logs of the env's apps are retained for in CloudWatch.
+	// Must be one of the values supported by CloudWatch. Defaults to 0, ie, forever.
+	LogRetention int `json:"log_retention,omitempty" mapstructure:"log_retention"`
+
+	// Existing AWS resources the environment is built upon.
+	// Only set for environments that were imported.
+	Existing *ExistingResources `json:"existing,omitempty"`
+
 	Status string `json:"status"`
 }
 
+// ExistingResources describes AWS resources that already exist outside
+// Cloudfauj. An environment built upon them only reads them and never
+// modifies or destroys them.
+type ExistingResources struct {
+	VpcId      string   `json:"vpc_id" mapstructure:"vpc_id"`
+	SubnetIds  []string `json:"subnet_ids" mapstructure:"subnet_ids"`
+	EcsCluster string   `json:"ecs_cluster,omitempty" mapstructure:"ecs_cluster"`
+	Alb        string   `json:"alb,omitempty" mapstructure:"alb"`
+}
+
 func (e *Environment) CheckIsValid() error {
 	// TODO
 	//  1. Ensure env name doesn't use any of the reserved names (eg: any that start with _)
@@ -40,9 +93,68 @@ func (e *Environment) CheckIsValid() error {
 	if e.Orchestrator != OrchFargate {
 		return errors.New("only " + OrchFargate + " container orchestrator is supported for now")
 	}
-	if e.DomainEnabled() && e.LoadBalancer != LoadBalALB {
+	if (e.DomainEnabled() || e.LoadBalancer != "") && e.LoadBalancer != LoadBalALB {
 		return errors.New("only " + LoadBalALB + " load balancer is supported for now")
 	}
+	if e.NetworkMode != "" && e.NetworkMode != NetworkModePublic && e.NetworkMode != NetworkModePrivate {
+		return errors.New("network mode must be either " + NetworkModePublic + " or " + NetworkModePrivate)
+	}
+	if e.NatGateways != "" {
+		if !e.PrivateCompute() {
+			return errors.New("NAT gateways can only be configured in " + NetworkModePrivate + " network mode")
+		}
+		if e.NatGateways != NatGatewaySingle && e.NatGateways != NatGatewayPerAZ {
+			return errors.New("NAT gateways must be either " + NatGatewaySingle + " or " + NatGatewayPerAZ)
+		}
+	}
+	if e.LogRetention != 0 && !validLogRetention[e.LogRetention] {
+		return errors.New("log retention must be one of the number of days supported by CloudWatch, eg- 7, 30, 90 or 365")
+	}
+	if e.VpcCidr != "" {
+		if err := checkVpcCidr(e.VpcCidr); err != nil {
+			return err
+		}
+	}
+	if e.Existing != nil {
+		if e.VpcCidr != "" || e.NatGateways != "" {
+			return errors.New("VPC CIDR & NAT gateways cannot be specified when using an existing network")
+		}
+		return e.Existing.checkIsValid(e)
+	}
+	return nil
+}
+
+// checkVpcCidr ensures that a CIDR is large enough to be divided into all the
+// subnets of an environment. The smallest subnet is 9 bits smaller than the VPC
+// and AWS doesn't allow subnets smaller than a /28.
+func checkVpcCidr(c string) error {
+	ip, ipn, err := net.ParseCIDR(c)
+	if err != nil || ip.To4() == nil {
+		return errors.New("VPC CIDR must be a valid IPv4 CIDR block")
+	}
+	if !ip.Equal(ipn.IP) {
+		return errors.New("VPC CIDR must be a network address, eg- " + ipn.String())
+	}
+	if ones, _ := ipn.Mask.Size(); ones < 16 || ones > 19 {
+		return errors.New("VPC CIDR must have a prefix length between /16 and /19")
+	}
+	return nil
+}
+
+func (r *ExistingResources) checkIsValid(e *Environment) error {
+	if len(strings.TrimSpace(r.VpcId)) == 0 {
+		return errors.New("VPC ID of existing network cannot be empty")
+	}
+	if len(r.SubnetIds) == 0 {
+		return errors.New("at least 1 existing subnet must be specified")
+	}
+	if len(r.Alb) > 0 && !e.LoadBalancerEnabled() {
+		return errors.New("an existing load balancer can only be used with " + LoadBalALB + " load balancer")
+	}
+	// A new ALB is created in the existing subnets, which requires at least 2 AZs
+	if e.LoadBalancerEnabled() && len(r.Alb) == 0 && len(r.SubnetIds) < 2 {
+		return errors.New("at least 2 existing subnets are needed to create a load balancer")
+	}
 	return nil
 }
 
@@ -50,3 +162,20 @@ func (e *Environment) CheckIsValid() error {
 func (e *Environment) DomainEnabled() bool {
 	return len(strings.TrimSpace(e.Domain)) != 0
 }
+
+// LoadBalancerEnabled returns true if the environment routes traffic to
+// applications via a load balancer. This is always the case when a domain
+// is associated with the environment.
+func (e *Environment) LoadBalancerEnabled() bool {
+	return e.DomainEnabled() || e.LoadBalancer == LoadBalALB
+}
+
+// PrivateCompute returns true if applications in the env run in private subnets
+func (e *Environment) PrivateCompute() bool {
+	return e.NetworkMode == NetworkModePrivate
+}
+
+// PerAZNatGateways returns true if the env has a NAT gateway in each AZ
+func (e *Environment) PerAZNatGateways() bool {
+	return e.NatGateways == NatGatewayPerAZ
+}
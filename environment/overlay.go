@@ -0,0 +1,51 @@
+package environment
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// OverlayScopeEnv applies an overlay to the environment's own infrastructure
+	OverlayScopeEnv = "env"
+	// OverlayScopeApps applies an overlay to every application in the environment
+	OverlayScopeApps = "apps"
+)
+
+// Overlay is a Terraform configuration file supplied by Ops.
+// It is stored alongside the configuration Cloudfauj generates for an
+// environment or its applications and is never overwritten by Cloudfauj.
+type Overlay struct {
+	Name    string `json:"name"`
+	Scope   string `json:"scope"`
+	Content string `json:"content,omitempty"`
+}
+
+func (o *Overlay) CheckIsValid() error {
+	if err := CheckOverlayName(o.Name); err != nil {
+		return err
+	}
+	if o.Scope != OverlayScopeEnv && o.Scope != OverlayScopeApps {
+		return errors.New("scope must be either " + OverlayScopeEnv + " or " + OverlayScopeApps)
+	}
+	if len(strings.TrimSpace(o.Content)) == 0 {
+		return errors.New("content cannot be empty")
+	}
+	return nil
+}
+
+// CheckOverlayName ensures that name can only refer to a Terraform configuration
+// file directly inside a module, never to its state or lock files.
+func CheckOverlayName(name string) error {
+	if len(strings.TrimSpace(name)) == 0 {
+		return errors.New("name cannot be empty")
+	}
+	if filepath.Base(name) != name || strings.HasPrefix(name, ".") {
+		return errors.New("name must be a plain file name")
+	}
+	if filepath.Ext(name) != ".tf" {
+		return errors.New("name must have the .tf extension")
+	}
+	return nil
+}
@@ -6,8 +6,12 @@ require (
 	github.com/apparentlymart/go-cidr v1.1.0
 	github.com/aws/aws-sdk-go-v2 v1.7.1
 	github.com/aws/aws-sdk-go-v2/config v1.5.0
+	github.com/aws/aws-sdk-go-v2/service/acm v1.2.2
+	github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs v1.5.0
 	github.com/aws/aws-sdk-go-v2/service/ec2 v1.12.0
 	github.com/aws/aws-sdk-go-v2/service/ecs v1.6.1
+	github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2 v1.5.0
+	github.com/aws/aws-sdk-go-v2/service/iam v1.7.0
 	github.com/gorilla/mux v1.8.0
 	github.com/gorilla/websocket v1.4.2
 	github.com/hashicorp/terraform-exec v0.14.0
@@ -15,4 +19,5 @@ require (
 	github.com/sirupsen/logrus v1.4.1
 	github.com/spf13/cobra v1.1.3
 	github.com/spf13/viper v1.8.1
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1
 )
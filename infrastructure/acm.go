@@ -0,0 +1,41 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	"github.com/aws/aws-sdk-go-v2/service/acm/types"
+)
+
+// ACMCertificate returns the details of a certificate in ACM
+func (i *Infrastructure) ACMCertificate(ctx context.Context, arn string) (*types.CertificateDetail, error) {
+	res, err := i.Acm.DescribeCertificate(ctx, &acm.DescribeCertificateInput{CertificateArn: aws.String(arn)})
+	if err != nil {
+		return nil, err
+	}
+	return res.Certificate, nil
+}
+
+// ValidateExistingCertificate ensures that an existing ACM certificate can be
+// used by a domain, ie, it is issued & covers the domain as well as its wildcard.
+func (i *Infrastructure) ValidateExistingCertificate(ctx context.Context, arn, domain string) error {
+	c, err := i.ACMCertificate(ctx, arn)
+	if err != nil {
+		return fmt.Errorf("failed to find certificate %s: %v", arn, err)
+	}
+	if c.Status != types.CertificateStatusIssued {
+		return fmt.Errorf("certificate %s is %s, only issued certificates can be used", arn, c.Status)
+	}
+
+	names := map[string]bool{aws.ToString(c.DomainName): true}
+	for _, n := range c.SubjectAlternativeNames {
+		names[n] = true
+	}
+	for _, n := range []string{domain, "*." + domain} {
+		if !names[n] {
+			return fmt.Errorf("certificate %s does not cover %s", arn, n)
+		}
+	}
+	return nil
+}
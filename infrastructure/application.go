@@ -2,10 +2,15 @@ package infrastructure
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/cloudfauj/cloudfauj/application"
 	"github.com/cloudfauj/cloudfauj/deployment"
+	"github.com/cloudfauj/cloudfauj/domain"
 	"github.com/cloudfauj/cloudfauj/environment"
 	"github.com/hashicorp/terraform-exec/tfexec"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 )
@@ -22,34 +27,318 @@ type AppTFConfigInput struct {
 	// of the file containing the domain's TF state.
 	DomainTFStateFile string
 
+	// If target environment has domain enabled, the DNS service used by the domain
+	DomainDNSService string
+
 	// The exact path on the system of the file containing the environment's
 	// TF state.
 	EnvTFStateFile string
+
+	// If the application has custom hostnames, the exact path on the system
+	// of the file containing the TF state of the domain each hostname belongs to.
+	HostnameTFStateFiles map[string]string
+
+	// If the application has custom hostnames, the DNS service used by the
+	// domain each hostname belongs to.
+	HostnameDNSServices map[string]string
+
+	// If the application has databases, the exact path on the system of the
+	// file containing the TF state of each database, keyed by database name.
+	DatabaseTFStateFiles map[string]string
+
+	// If the application has volumes, the exact path on the system of the
+	// file containing the TF state of each volume, keyed by volume name.
+	VolumeTFStateFiles map[string]string
+
+	// If the application has buckets, the exact path on the system of the
+	// file containing the TF state of each bucket, keyed by bucket name.
+	BucketTFStateFiles map[string]string
 }
 
 func (i *Infrastructure) AppTFConfig(input *AppTFConfigInput) (map[string]string, error) {
 	res := map[string]string{
-		"terraform.tf": i.tfCoreConfig(),
-		"app.tf":       i.appTfConfig(input, appTfTpl),
+		tfCoreConfigFile: i.tfCoreConfig(),
+		"app.tf":         i.appTfConfig(input, appTfTpl),
+	}
+	if input.Env.LoadBalancerEnabled() {
+		res["app_lb.tf"] = i.appTfConfig(input, appLbTfTpl)
+	}
+	if input.Env.DomainEnabled() {
+		tpl := appDnsTfTpl + "\n\n" + dnsProviderFor(input.DomainDNSService).appRecordTpl
+		res["app_dns.tf"] = i.appTfConfig(input, tpl)
+	}
+	if input.Env.LoadBalancerEnabled() && input.Spec.App.Routing != nil {
+		res["app_routes.tf"] = i.appRoutesTfConfig(input)
+	}
+	if input.Spec.App.IAM != nil {
+		res["app_iam.tf"] = i.appIamTfConfig(input)
+	}
+	if len(input.Spec.App.Buckets) > 0 || len(input.Spec.App.Queues) > 0 {
+		res["app_storage.tf"] = i.appStorageTfConfig(input)
 	}
+
+	var services []string
 	if input.Env.DomainEnabled() {
-		res["app_dns.tf"] = i.appTfConfig(input, appDnsTfTpl)
+		services = append(services, input.DomainDNSService)
+	}
+	if input.Spec.App.Routing != nil {
+		for _, h := range input.Spec.App.Routing.Hostnames {
+			services = append(services, input.HostnameDNSServices[h])
+		}
+	}
+	if c := dnsProviderTfConfig(services...); c != "" {
+		res[dnsProviderTFFile] = c
 	}
 	return res, nil
 }
 
+// appRoutesTfConfig returns the TF configuration that routes an application's
+// custom hostnames & paths to it.
+func (i *Infrastructure) appRoutesTfConfig(in *AppTFConfigInput) string {
+	var b strings.Builder
+	routing := in.Spec.App.Routing
+
+	type hostname struct {
+		Name        string
+		DomainIndex int
+	}
+	type route struct {
+		Host     string
+		Patterns []string
+		Priority int
+	}
+
+	// every distinct domain state file is read once
+	var (
+		stateFiles []string
+		hostnames  []hostname
+		// hostnames grouped by the DNS service managing their records
+		route53Hostnames, cloudflareHostnames []hostname
+	)
+	fileIndex := make(map[string]int)
+	for _, h := range routing.Hostnames {
+		f := in.HostnameTFStateFiles[h]
+		if _, ok := fileIndex[f]; !ok {
+			fileIndex[f] = len(stateFiles)
+			stateFiles = append(stateFiles, f)
+		}
+		hn := hostname{Name: h, DomainIndex: fileIndex[f]}
+		hostnames = append(hostnames, hn)
+
+		if in.HostnameDNSServices[h] == domain.DNSServiceCloudflare {
+			cloudflareHostnames = append(cloudflareHostnames, hn)
+		} else {
+			route53Hostnames = append(route53Hostnames, hn)
+		}
+	}
+
+	var routes []route
+	for j, r := range routing.Routes() {
+		rt := route{Host: r.Host}
+		if r.Path != "" {
+			rt.Patterns = r.PathPatterns()
+		}
+		if routing.Priority > 0 {
+			rt.Priority = routing.Priority + j
+		}
+		routes = append(routes, rt)
+	}
+
+	listener := "main_alb_http_listener"
+	if in.Env.DomainEnabled() {
+		listener = "main_alb_https_listener"
+	}
+
+	t := template.Must(template.New("").Parse(appRoutesTfTpl))
+	data := map[string]interface{}{
+		"domain_state_files":   stateFiles,
+		"hostnames":            hostnames,
+		"route53_hostnames":    route53Hostnames,
+		"cloudflare_hostnames": cloudflareHostnames,
+		"routes":               routes,
+		"listener_output":      listener,
+	}
+	t.Execute(&b, data)
+	return b.String()
+}
+
+// appIamTfConfig returns the TF configuration that grants an application's
+// tasks the permissions declared in its IAM settings.
+func (i *Infrastructure) appIamTfConfig(in *AppTFConfigInput) string {
+	var b strings.Builder
+	iam := in.Spec.App.IAM
+
+	type statement struct {
+		Effect    string
+		Actions   []string
+		Resources []string
+	}
+
+	// user-supplied values are quoted so that IAM policy variables like
+	// ${aws:username} aren't interpreted as TF interpolations.
+	var statements []statement
+	for _, s := range iam.Statements {
+		st := statement{Effect: application.IAMEffectAllow}
+		if !s.Allows() {
+			st.Effect = application.IAMEffectDeny
+		}
+		for _, a := range s.Actions {
+			st.Actions = append(st.Actions, hclString(a))
+		}
+		for _, r := range s.Resources {
+			st.Resources = append(st.Resources, hclString(r))
+		}
+		statements = append(statements, st)
+	}
+	var policies []string
+	for _, p := range iam.Policies {
+		policies = append(policies, hclString(p))
+	}
+
+	t := template.Must(template.New("").Parse(appIamTfTpl))
+	data := map[string]interface{}{
+		"statements": statements,
+		"policies":   policies,
+	}
+	t.Execute(&b, data)
+	return b.String()
+}
+
+// appStorageTfConfig returns the TF configuration of an application's buckets
+// & queues and the permissions its tasks need to use them.
+func (i *Infrastructure) appStorageTfConfig(in *AppTFConfigInput) string {
+	var b strings.Builder
+
+	type queue struct {
+		Name              string
+		Fifo              bool
+		VisibilityTimeout string
+	}
+	type bucket struct {
+		Name      string
+		StateFile string
+	}
+	var buckets []bucket
+	for _, bk := range in.Spec.App.Buckets {
+		buckets = append(buckets, bucket{Name: bk.Name, StateFile: in.BucketTFStateFiles[bk.Name]})
+	}
+	var queues []queue
+	for _, q := range in.Spec.App.Queues {
+		queues = append(queues, queue{Name: q.Name, Fifo: q.Fifo, VisibilityTimeout: intOrDefault(q.VisibilityTimeout, 30)})
+	}
+
+	t := template.Must(template.New("").Parse(appStorageTfTpl))
+	data := map[string]interface{}{
+		"buckets": buckets,
+		"queues":  queues,
+	}
+	t.Execute(&b, data)
+	return b.String()
+}
+
 func (i *Infrastructure) appTfConfig(in *AppTFConfigInput, tpl string) string {
 	var b strings.Builder
 
 	t := template.Must(template.New("").Parse(tpl))
 	data := map[string]interface{}{
-		"env_name":              in.Env.Name,
-		"app_name":              in.Spec.App.Name,
-		"env_tfstate_file":      in.EnvTFStateFile,
-		"target_group_resource": "",
+		"env_name":               in.Env.Name,
+		"app_name":               in.Spec.App.Name,
+		"env_tfstate_file":       in.EnvTFStateFile,
+		"target_group_resource":  "",
+		"assign_public_ip":       !in.Env.PrivateCompute(),
+		"container_health_check": in.Spec.App.ContainerHealthCheck != nil,
+		"ephemeral_storage":      in.Spec.App.Resources.EphemeralStorage,
 	}
-	if in.Env.DomainEnabled() {
+	if in.Env.LoadBalancerEnabled() {
 		data["target_group_resource"] = "aws_alb_target_group.alb_to_ecs_service.arn"
+	}
+
+	type database struct {
+		Index     int
+		EnvVar    string
+		StateFile string
+	}
+	var databases []database
+	for j, db := range in.Spec.App.Databases {
+		databases = append(databases, database{
+			Index:     j,
+			EnvVar:    db.ConnectionEnvVar(),
+			StateFile: in.DatabaseTFStateFiles[db.Name],
+		})
+	}
+	data["databases"] = databases
+
+	type volume struct {
+		Index     int
+		Name      string
+		MountPath string
+		ReadOnly  bool
+		StateFile string
+	}
+	var volumes []volume
+	for j, v := range in.Spec.App.Volumes {
+		volumes = append(volumes, volume{
+			Index:     j,
+			Name:      v.Name,
+			MountPath: v.MountPath,
+			ReadOnly:  v.ReadOnly,
+			StateFile: in.VolumeTFStateFiles[v.Name],
+		})
+	}
+	data["volumes"] = volumes
+
+	// names of buckets & URLs of queues are supplied to the container
+	type envVar struct {
+		Name  string
+		Value string
+	}
+	var storageEnv []envVar
+	for _, bk := range in.Spec.App.Buckets {
+		storageEnv = append(storageEnv, envVar{Name: bk.NameEnvVar(), Value: "data.terraform_remote_state.bucket_" + bk.Name + ".outputs.name"})
+	}
+	for _, q := range in.Spec.App.Queues {
+		storageEnv = append(storageEnv, envVar{Name: q.URLEnvVar(), Value: "aws_sqs_queue.queue_" + q.Name + ".url"})
+	}
+	data["storage_env"] = storageEnv
+
+	type dependency struct {
+		Container string
+		Condition string
+	}
+	type sidecar struct {
+		Name      string
+		Image     string
+		Cpu       int
+		Memory    int
+		Essential bool
+		Env       []envVar
+		DependsOn []dependency
+	}
+	var sidecars []sidecar
+	for _, s := range in.Spec.App.Sidecars {
+		sc := sidecar{
+			Name:      s.Name,
+			Image:     hclString(s.Image),
+			Cpu:       s.Cpu,
+			Memory:    s.Memory,
+			Essential: s.Essential,
+		}
+		// sorted to keep the task definition from changing between deployments
+		names := make([]string, 0, len(s.Env))
+		for k := range s.Env {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			sc.Env = append(sc.Env, envVar{Name: k, Value: hclString(s.Env[k])})
+		}
+		for _, d := range s.DependsOn {
+			sc.DependsOn = append(sc.DependsOn, dependency{Container: d.Container, Condition: d.DependencyCondition()})
+		}
+		sidecars = append(sidecars, sc)
+	}
+	data["sidecars"] = sidecars
+	if in.Env.DomainEnabled() {
 		data["domain_tfstate_file"] = in.DomainTFStateFile
 		data["domain_name"] = in.Env.Domain
 	}
@@ -71,22 +360,113 @@ func (i *Infrastructure) CreateApplication(ctx context.Context, s *deployment.Sp
 func (i *Infrastructure) ModifyApplication(
 	ctx context.Context, spec *deployment.Spec, tf *tfexec.Terraform,
 ) error {
+	// regenerated configuration may require providers the module wasn't
+	// initialized with, eg- when routing a hostname managed by another DNS service.
+	if err := tf.Init(ctx); err != nil {
+		return fmt.Errorf("failed to initialize terraform: %v", err)
+	}
 	return i.applyAppConfig(ctx, spec, tf)
 }
 
 func (i *Infrastructure) applyAppConfig(ctx context.Context, spec *deployment.Spec, tf *tfexec.Terraform) error {
-	return tf.Apply(
-		ctx,
-		tfexec.Var("app_health_check_path="+spec.App.HealthCheck.Path),
-		tfexec.Var(fmt.Sprintf("cpu=%v", fargateRoundedCPU(spec.App.Resources.Cpu))),
-		tfexec.Var(
-			fmt.Sprintf(
-				"memory=%v", fargateRoundedMemory(spec.App.Resources.Cpu, spec.App.Resources.Memory),
-			),
-		),
-		tfexec.Var(fmt.Sprintf("ingress_port=%d", spec.App.Resources.Network.BindPort)),
-		tfexec.Var("ecr_image="+spec.Artifact),
-	)
+	vars, err := appTFVars(spec)
+	if err != nil {
+		return err
+	}
+	var opts []tfexec.ApplyOption
+	for k, v := range vars {
+		opts = append(opts, tfexec.Var(k+"="+v))
+	}
+	return tf.Apply(ctx, opts...)
+}
+
+// appTFVars returns the values of all variables supplied to the TF
+// configuration of an application when applying it.
+func appTFVars(spec *deployment.Spec) (map[string]string, error) {
+	hc := spec.App.HealthCheck
+	// specs stored by older versions are applied without being validated
+	// again, eg- when updating an env, so their tasks may not fit Fargate
+	cpu, memory, err := spec.App.TaskSize()
+	if err != nil {
+		return nil, fmt.Errorf("invalid resources: %v", err)
+	}
+	res := map[string]string{
+		"app_health_check_path": hc.Path,
+		"cpu":                   strconv.Itoa(cpu),
+		"memory":                strconv.Itoa(memory),
+		"ingress_port":          strconv.Itoa(int(spec.App.Resources.Network.BindPort)),
+		"ecr_image":             spec.Artifact,
+
+		"app_protocol":                         application.ProtocolHTTP,
+		"app_protocol_version":                 "HTTP1",
+		"app_health_check_interval":            intOrDefault(hc.Interval, application.DefaultHealthCheckInterval),
+		"app_health_check_timeout":             intOrDefault(hc.Timeout, application.DefaultHealthCheckTimeout),
+		"app_health_check_healthy_threshold":   intOrDefault(hc.HealthyThreshold, 5),
+		"app_health_check_unhealthy_threshold": intOrDefault(hc.UnhealthyThreshold, 2),
+		"app_health_check_matcher":             hc.Matcher,
+		"app_health_check_grace_period":        intOrDefault(hc.GracePeriod, 0),
+		"app_deregistration_delay":             "300",
+		"app_stickiness_enabled":               "false",
+		"app_stickiness_duration":              "86400",
+	}
+
+	// gRPC apps are served over plaintext HTTP/2 and report health via gRPC status codes
+	switch hc.Protocol {
+	case application.ProtocolHTTPS:
+		res["app_protocol"] = application.ProtocolHTTPS
+	case application.ProtocolGRPC:
+		res["app_protocol_version"] = application.ProtocolGRPC
+	}
+	if hc.Matcher == "" {
+		res["app_health_check_matcher"] = "200"
+		if hc.Protocol == application.ProtocolGRPC {
+			res["app_health_check_matcher"] = "12"
+		}
+	}
+
+	if c := spec.App.ContainerHealthCheck; c != nil {
+		res["container_health_check_command"] = c.Command
+		res["container_health_check_interval"] = intOrDefault(c.Interval, 30)
+		res["container_health_check_timeout"] = intOrDefault(c.Timeout, 5)
+		res["container_health_check_retries"] = intOrDefault(c.Retries, 3)
+		res["container_health_check_start_period"] = strconv.Itoa(c.StartPeriod)
+	}
+	if tg := spec.App.TargetGroup; tg != nil {
+		if tg.DeregistrationDelay != nil {
+			res["app_deregistration_delay"] = strconv.Itoa(*tg.DeregistrationDelay)
+		}
+		res["app_stickiness_enabled"] = strconv.FormatBool(tg.Stickiness)
+		res["app_stickiness_duration"] = intOrDefault(tg.StickinessDuration, 86400)
+	}
+	return res, nil
+}
+
+func intOrDefault(v, def int) string {
+	if v == 0 {
+		return strconv.Itoa(def)
+	}
+	return strconv.Itoa(v)
+}
+
+// AppTFVarsFile returns the contents of a Terraform variables file that
+// supplies all variables needed to apply an application's TF configuration.
+func (i *Infrastructure) AppTFVarsFile(spec *deployment.Spec) (string, error) {
+	var b strings.Builder
+
+	vars, err := appTFVars(spec)
+	if err != nil {
+		return "", err
+	}
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s = %s\n", k, hclString(vars[k]))
+	}
+	return b.String(), nil
 }
 
 func (i *Infrastructure) DestroyApplication(ctx context.Context, tf *tfexec.Terraform) error {
@@ -100,10 +480,53 @@ func (i *Infrastructure) AppECSService(ctx context.Context, tf *tfexec.Terraform
 	return i.tfOutput(ctx, tf, "ecs_service")
 }
 
+// AppURL returns the URL an application is reachable at.
+// It returns an empty string if the app isn't exposed via a load balancer.
+func (i *Infrastructure) AppURL(ctx context.Context, tf *tfexec.Terraform) (string, error) {
+	return i.tfOutput(ctx, tf, "app_url")
+}
+
 func (i *Infrastructure) AppECSCluster(ctx context.Context, tf *tfexec.Terraform) (string, error) {
 	return i.tfOutput(ctx, tf, "ecs_cluster_arn")
 }
 
+// AppBuckets returns the names of an application's S3 buckets, keyed by
+// their names in the app's config.
+func (i *Infrastructure) AppBuckets(ctx context.Context, tf *tfexec.Terraform) (map[string]string, error) {
+	return i.tfOutputMap(ctx, tf, "buckets")
+}
+
+// AppQueues returns the URLs of an application's SQS queues, keyed by
+// their names in the app's config.
+func (i *Infrastructure) AppQueues(ctx context.Context, tf *tfexec.Terraform) (map[string]string, error) {
+	return i.tfOutputMap(ctx, tf, "queues")
+}
+
+// AppTargetGroup returns the ARN of the target group the load balancer forwards
+// an application's traffic to. It returns an empty string if the app isn't
+// exposed via a load balancer.
+func (i *Infrastructure) AppTargetGroup(ctx context.Context, tf *tfexec.Terraform) (string, error) {
+	return i.tfOutput(ctx, tf, "target_group_arn")
+}
+
+// tfOutputMap returns the value of a TF output that is a map of strings.
+// It returns nil if the output doesn't exist.
+func (i *Infrastructure) tfOutputMap(ctx context.Context, tf *tfexec.Terraform, varName string) (map[string]string, error) {
+	res, err := tf.Output(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terraform output: %v", err)
+	}
+	o, ok := res[varName]
+	if !ok {
+		return nil, nil
+	}
+	var value map[string]string
+	if err := json.Unmarshal(o.Value, &value); err != nil {
+		return nil, fmt.Errorf("failed to decode terraform output %s: %v", varName, err)
+	}
+	return value, nil
+}
+
 func (i *Infrastructure) tfOutput(ctx context.Context, tf *tfexec.Terraform, varName string) (string, error) {
 	res, err := tf.Output(ctx)
 	if err != nil {
@@ -0,0 +1,48 @@
+package infrastructure
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cloudfauj/cloudfauj/application"
+	"github.com/cloudfauj/cloudfauj/deployment"
+)
+
+func TestAppTFVarsTaskSize(t *testing.T) {
+	spec := func(cpu, memory int) *deployment.Spec {
+		return &deployment.Spec{
+			App: &application.Application{
+				HealthCheck: &application.HealthCheck{Path: "/"},
+				Resources: &application.Resources{
+					Cpu:     cpu,
+					Memory:  memory,
+					Network: &application.Network{BindPort: 80},
+				},
+			},
+		}
+	}
+
+	vars, err := appTFVars(spec(300, 600))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vars["cpu"] != "512" || vars["memory"] != "1024" {
+		t.Errorf("got cpu %s & memory %s, want the task size 512 & 1024", vars["cpu"], vars["memory"])
+	}
+
+	// specs stored before task sizes were validated must not be applied with a zero size
+	if _, err := appTFVars(spec(32768, 512)); err == nil {
+		t.Error("got no error for tasks that don't fit Fargate")
+	}
+	if _, err := (&Infrastructure{}).AppTFVarsFile(spec(32768, 512)); err == nil {
+		t.Error("got no error exporting variables of tasks that don't fit Fargate")
+	}
+
+	file, err := (&Infrastructure{}).AppTFVarsFile(spec(256, 512))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(file, `cpu = "256"`) {
+		t.Errorf("variables file doesn't contain the task's cpu:\n%s", file)
+	}
+}
@@ -0,0 +1,64 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/application"
+	"github.com/hashicorp/terraform-exec/tfexec"
+	"strings"
+	"text/template"
+)
+
+// A set of Objects supplied to the BucketTFConfig method
+type BucketTFConfigInput struct {
+	Bucket *application.Bucket
+
+	// Name of the application the bucket belongs to
+	App string
+
+	// Name of the environment the application runs in
+	Env string
+}
+
+// BucketTFConfig returns the TF configuration of an S3 bucket provisioned for
+// an application. Like databases & volumes, every bucket is a module of its own
+// so that destroying the app doesn't delete its objects.
+func (i *Infrastructure) BucketTFConfig(in *BucketTFConfigInput) map[string]string {
+	var b strings.Builder
+
+	t := template.Must(template.New("").Parse(bucketTfTpl))
+	data := map[string]interface{}{
+		"env_name":    in.Env,
+		"app_name":    in.App,
+		"bucket_name": in.Bucket.Name,
+		"versioning":  in.Bucket.Versioning,
+	}
+	t.Execute(&b, data)
+
+	return map[string]string{
+		tfCoreConfigFile: i.tfCoreConfig(),
+		"bucket.tf":      b.String(),
+	}
+}
+
+// ApplyBucket creates or modifies the infrastructure of a bucket
+func (i *Infrastructure) ApplyBucket(ctx context.Context, tf *tfexec.Terraform) error {
+	if err := tf.Init(ctx); err != nil {
+		return fmt.Errorf("failed to initialize terraform: %v", err)
+	}
+	if err := tf.Apply(ctx); err != nil {
+		return fmt.Errorf("failed to apply terraform changes: %v", err)
+	}
+	return nil
+}
+
+// DestroyBucket deletes a bucket along with all its objects
+func (i *Infrastructure) DestroyBucket(ctx context.Context, tf *tfexec.Terraform) error {
+	if err := tf.Init(ctx); err != nil {
+		return fmt.Errorf("failed to initialize terraform: %v", err)
+	}
+	if err := tf.Destroy(ctx); err != nil {
+		return fmt.Errorf("failed to destroy bucket: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/application"
+	"github.com/hashicorp/terraform-exec/tfexec"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Version of the Terraform Random provider used to generate database passwords
+const randomProviderVersion = "3.1.0"
+
+var databaseEnginePorts = map[string]int{
+	application.DatabaseEnginePostgres: 5432,
+	application.DatabaseEngineMySQL:    3306,
+}
+
+// A set of Objects supplied to the DatabaseTFConfig method
+type DatabaseTFConfigInput struct {
+	Database *application.Database
+
+	// Name of the application the database belongs to
+	App string
+
+	// Name of the environment the application runs in
+	Env string
+
+	// The exact path on the system of the file containing the environment's
+	// TF state.
+	EnvTFStateFile string
+}
+
+// DatabaseTFConfig returns the TF configuration of a database provisioned for an
+// application. Every database is a module of its own, so that destroying the app
+// doesn't destroy its data.
+func (i *Infrastructure) DatabaseTFConfig(in *DatabaseTFConfigInput) map[string]string {
+	var b strings.Builder
+	db := in.Database
+
+	storage := db.Storage
+	if storage == 0 {
+		storage = application.DefaultDatabaseStorage
+	}
+	size := db.Size
+	if size == "" {
+		size = application.DefaultDatabaseSize
+	}
+
+	t := template.Must(template.New("").Parse(databaseTfTpl))
+	data := map[string]interface{}{
+		"random_provider_version": randomProviderVersion,
+		"env_tfstate_file":        in.EnvTFStateFile,
+		"env_name":                in.Env,
+		"app_name":                in.App,
+		"db_name":                 db.Name,
+		"engine":                  db.Engine,
+		"engine_version":          db.Version,
+		"instance_class":          size,
+		"storage":                 strconv.Itoa(storage),
+		"port":                    strconv.Itoa(databaseEnginePorts[db.Engine]),
+	}
+	t.Execute(&b, data)
+
+	return map[string]string{
+		tfCoreConfigFile: i.tfCoreConfig(),
+		"database.tf":    b.String(),
+	}
+}
+
+// ApplyDatabase creates or modifies the infrastructure of a database
+func (i *Infrastructure) ApplyDatabase(ctx context.Context, tf *tfexec.Terraform) error {
+	if err := tf.Init(ctx); err != nil {
+		return fmt.Errorf("failed to initialize terraform: %v", err)
+	}
+	if err := tf.Apply(ctx); err != nil {
+		return fmt.Errorf("failed to apply terraform changes: %v", err)
+	}
+	return nil
+}
+
+// DestroyDatabase deletes a database along with all its data & backups.
+// Deletion protection is turned off before destroying the instance.
+func (i *Infrastructure) DestroyDatabase(ctx context.Context, tf *tfexec.Terraform) error {
+	if err := tf.Init(ctx); err != nil {
+		return fmt.Errorf("failed to initialize terraform: %v", err)
+	}
+	if err := tf.Apply(ctx, tfexec.Var("delete_data=true")); err != nil {
+		return fmt.Errorf("failed to disable deletion protection: %v", err)
+	}
+	if err := tf.Destroy(ctx, tfexec.Var("delete_data=true")); err != nil {
+		return fmt.Errorf("failed to destroy database: %v", err)
+	}
+	return nil
+}
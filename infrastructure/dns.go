@@ -0,0 +1,78 @@
+package infrastructure
+
+import (
+	"github.com/cloudfauj/cloudfauj/domain"
+	"strings"
+	"text/template"
+)
+
+// Version of the Terraform Cloudflare provider used in generated configuration
+const cloudflareProviderVersion = "3.4.0"
+
+// Environment variable the Terraform Cloudflare provider reads its API token from.
+// The token is never written to generated configuration.
+const cloudflareAPITokenEnvVar = "CLOUDFLARE_API_TOKEN"
+
+// Name of the file declaring the Terraform provider of a DNS service,
+// kept separate so that the core configuration stays the same for all modules.
+const dnsProviderTFFile = "dns_provider.tf"
+
+// dnsProvider generates the Terraform configuration that manages
+// a domain's DNS records in the DNS service used by the domain.
+type dnsProvider struct {
+	// TF configuration declaring the TF provider of the DNS service.
+	// Empty if the provider is already part of the core configuration.
+	providerTpl string
+
+	// TF configuration of the domain's DNS zone & records validating its
+	// TLS certificate. It must output the zone's ID & name servers.
+	zoneTpl string
+
+	// TF configuration of the CNAME record pointing an application's
+	// URL to the load balancer.
+	appRecordTpl string
+}
+
+var dnsProviders = map[string]*dnsProvider{
+	domain.DNSServiceRoute53: {
+		zoneTpl:      domainDnsTfConfigTpl,
+		appRecordTpl: appRoute53RecordTfTpl,
+	},
+	domain.DNSServiceCloudflare: {
+		providerTpl:  cloudflareProviderTfTpl,
+		zoneTpl:      domainCloudflareDnsTfConfigTpl,
+		appRecordTpl: appCloudflareRecordTfTpl,
+	},
+}
+
+// dnsProviderFor returns the DNS provider of the given DNS service.
+// Domains added before DNS services were configurable always use Route53.
+func dnsProviderFor(service string) *dnsProvider {
+	if p, ok := dnsProviders[service]; ok {
+		return p
+	}
+	return dnsProviders[domain.DNSServiceRoute53]
+}
+
+// dnsProviderTfConfig returns the TF configuration declaring the providers of
+// all given DNS services. It returns an empty string if none of them need one.
+func dnsProviderTfConfig(services ...string) string {
+	var b strings.Builder
+
+	seen := make(map[string]bool)
+	for _, s := range services {
+		p := dnsProviderFor(s)
+		if p.providerTpl == "" || seen[p.providerTpl] {
+			continue
+		}
+		seen[p.providerTpl] = true
+
+		t := template.Must(template.New("").Parse(p.providerTpl))
+		data := map[string]interface{}{"cloudflare_provider_version": cloudflareProviderVersion}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		t.Execute(&b, data)
+	}
+	return b.String()
+}
@@ -6,23 +6,51 @@ import (
 	"fmt"
 	"github.com/cloudfauj/cloudfauj/domain"
 	"github.com/hashicorp/terraform-exec/tfexec"
+	"net"
 	"strings"
 	"text/template"
 )
 
+// Names of the PEM files a certificate imported into ACM is read from
+const (
+	certificateFile      = "certificate.pem"
+	certificateChainFile = "certificate_chain.pem"
+	privateKeyFile       = "private_key.pem"
+)
+
+// IsSensitiveFile returns true if the given file generated inside a
+// Terraform module contains secrets, eg- a private key.
+func IsSensitiveFile(name string) bool {
+	return name == privateKeyFile
+}
+
 // DomainTFConfig returns a map.
 // The keys are names of terraform config files needed for the domain infrastructure.
 // The values are their corresponding TF code.
 // This method generates the TF configuration depending on the components being used
 // for the domain.
 func (i *Infrastructure) DomainTFConfig(d *domain.Domain) (map[string]string, error) {
-	// NOTE: As of now, only route53 dns service & acm cert authority are supported,
-	// so this method generates tf only for those, regardless of what's specified
-	// in the domain configuration.
 	res := map[string]string{
-		"terraform.tf":      i.tfCoreConfig(),
-		"dns_service.tf":    i.domainTfConfig(d, domainDnsTfConfigTpl),
-		"cert_authority.tf": i.domainTfConfig(d, domainCertTfConfigTpl),
+		tfCoreConfigFile: i.tfCoreConfig(),
+		"dns_service.tf": i.domainTfConfig(d, dnsProviderFor(d.DNSService).zoneTpl),
+	}
+	if c := dnsProviderTfConfig(d.DNSService); c != "" {
+		res[dnsProviderTFFile] = c
+	}
+
+	c := d.Certificate
+	switch {
+	case d.CertificateAuthority != domain.CertAuthorityCustom:
+		res["cert_authority.tf"] = i.domainTfConfig(d, domainCertTfConfigTpl)
+	case c.Imported():
+		res["cert_authority.tf"] = i.domainTfConfig(d, domainImportedCertTfConfigTpl)
+		res[certificateFile] = c.Body
+		res[privateKeyFile] = c.PrivateKey
+		if c.Chain != "" {
+			res[certificateChainFile] = c.Chain
+		}
+	default:
+		res["cert_authority.tf"] = i.domainTfConfig(d, domainExistingCertTfConfigTpl)
 	}
 	return res, nil
 }
@@ -30,24 +58,69 @@ func (i *Infrastructure) DomainTFConfig(d *domain.Domain) (map[string]string, er
 // CreateDomain creates infrastructure for a domain.
 // It returns the Name Server records of the DNS hosted zone.
 func (i *Infrastructure) CreateDomain(ctx context.Context, tf *tfexec.Terraform) ([]string, error) {
-	var nsRecords []string
-
 	if err := tf.Init(ctx); err != nil {
 		return nil, fmt.Errorf("failed to initialize terraform: %v", err)
 	}
 	if err := tf.Apply(ctx); err != nil {
 		return nil, fmt.Errorf("failed to apply TF config: %v", err)
 	}
+	_, nsRecords, err := i.DomainZone(ctx, tf)
+	return nsRecords, err
+}
+
+// DomainZone returns the ID & Name Server records of a domain's DNS hosted zone
+func (i *Infrastructure) DomainZone(ctx context.Context, tf *tfexec.Terraform) (string, []string, error) {
+	var nsRecords []string
 
-	// read NS records from terraform output
 	res, err := tf.Output(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read terraform output: %v", err)
+		return "", nil, fmt.Errorf("failed to read terraform output: %v", err)
 	}
 	if err := json.Unmarshal(res["name_servers"].Value, &nsRecords); err != nil {
-		return nil, fmt.Errorf("failed to parse terraform output: %v", err)
+		return "", nil, fmt.Errorf("failed to parse terraform output: %v", err)
+	}
+	return strings.Trim(string(res["zone_id"].Value), "\""), nsRecords, nil
+}
+
+// CheckDelegation resolves the NS records of a domain and compares them with
+// those of its DNS hosted zone. It returns the resolved records and whether
+// the domain is delegated to the hosted zone.
+func (i *Infrastructure) CheckDelegation(ctx context.Context, name string, zoneNS []string) ([]string, bool, error) {
+	r := i.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	records, err := r.LookupNS(ctx, name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var resolved []string
+	for _, ns := range records {
+		resolved = append(resolved, normalizeNS(ns.Host))
+	}
+	if len(resolved) != len(zoneNS) {
+		return resolved, false, nil
+	}
+	expected := make(map[string]bool)
+	for _, ns := range zoneNS {
+		expected[normalizeNS(ns)] = true
 	}
-	return nsRecords, nil
+	for _, ns := range resolved {
+		if !expected[ns] {
+			return resolved, false, nil
+		}
+	}
+	return resolved, true, nil
+}
+
+func normalizeNS(ns string) string {
+	return strings.ToLower(strings.TrimSuffix(ns, "."))
+}
+
+// DomainCertificateArn returns the ARN of the TLS certificate used by a domain
+func (i *Infrastructure) DomainCertificateArn(ctx context.Context, tf *tfexec.Terraform) (string, error) {
+	return i.tfOutput(ctx, tf, "ssl_cert_arn")
 }
 
 // DeleteDomain destroys the Terraform infrastructure of a domain
@@ -69,7 +142,17 @@ func (i *Infrastructure) domainTfConfig(d *domain.Domain, tpl string) string {
 	var b strings.Builder
 
 	t := template.Must(template.New("").Parse(tpl))
-	data := map[string]interface{}{"domain_name": d.Name}
+	data := map[string]interface{}{
+		"domain_name":      d.Name,
+		"certificate_file": certificateFile,
+		"private_key_file": privateKeyFile,
+	}
+	if c := d.Certificate; c != nil {
+		data["certificate_arn"] = c.Arn
+		if c.Chain != "" {
+			data["certificate_chain_file"] = certificateChainFile
+		}
+	}
 
 	t.Execute(&b, data)
 	return b.String()
@@ -0,0 +1,155 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeDNSServer answers NS queries over UDP from a fixed set of records, keyed
+// by lowercase domain name without the trailing dot. Other names get no answers.
+type fakeDNSServer struct {
+	conn net.PacketConn
+	ns   map[string][]string
+}
+
+func newFakeDNSServer(t *testing.T, ns map[string][]string) *fakeDNSServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &fakeDNSServer{conn: conn, ns: ns}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+// resolver returns a resolver that sends all queries to the fake server
+func (s *fakeDNSServer) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+		},
+	}
+}
+
+func (s *fakeDNSServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if res := s.answer(buf[:n]); res != nil {
+			_, _ = s.conn.WriteTo(res, addr)
+		}
+	}
+}
+
+func (s *fakeDNSServer) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	// the question section starts right after the header
+	name, end := readDNSName(query, 12)
+	if end+4 > len(query) {
+		return nil
+	}
+	question := query[12 : end+4]
+	qtype := binary.BigEndian.Uint16(query[end:])
+
+	var records []string
+	if qtype == 2 {
+		records = s.ns[name]
+	}
+
+	res := make([]byte, 12, 512)
+	copy(res, query[:2])
+	// response, recursion desired & available, no error
+	binary.BigEndian.PutUint16(res[2:], 0x8180)
+	binary.BigEndian.PutUint16(res[4:], 1)
+	binary.BigEndian.PutUint16(res[6:], uint16(len(records)))
+	res = append(res, question...)
+	for _, r := range records {
+		data := encodeDNSName(r)
+		// pointer to the name in the question, type NS, class IN, TTL 60
+		res = append(res, 0xc0, 12, 0, 2, 0, 1, 0, 0, 0, 60)
+		res = append(res, byte(len(data)>>8), byte(len(data)))
+		res = append(res, data...)
+	}
+	return res
+}
+
+// readDNSName decodes an uncompressed name starting at off. It returns the name
+// in lowercase without the trailing dot and the offset right after it.
+func readDNSName(msg []byte, off int) (string, int) {
+	var labels []string
+	for off < len(msg) {
+		l := int(msg[off])
+		off++
+		if l == 0 || off+l > len(msg) {
+			break
+		}
+		labels = append(labels, string(msg[off:off+l]))
+		off += l
+	}
+	return strings.ToLower(strings.Join(labels, ".")), off
+}
+
+func encodeDNSName(name string) []byte {
+	var res []byte
+	for _, l := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		res = append(res, byte(len(l)))
+		res = append(res, l...)
+	}
+	return append(res, 0)
+}
+
+func TestCheckDelegation(t *testing.T) {
+	srv := newFakeDNSServer(t, map[string][]string{
+		"delegated.com": {"ns-1.awsdns-01.org.", "NS-2.awsdns-02.com."},
+		"elsewhere.com": {"ns1.registrar.com.", "ns2.registrar.com."},
+		"partial.com":   {"ns-1.awsdns-01.org."},
+	})
+	i := &Infrastructure{Resolver: srv.resolver()}
+	zoneNS := []string{"ns-2.awsdns-02.com", "ns-1.awsdns-01.org"}
+
+	cases := []struct {
+		domain    string
+		resolved  []string
+		delegated bool
+	}{
+		{"delegated.com", []string{"ns-1.awsdns-01.org", "ns-2.awsdns-02.com"}, true},
+		{"elsewhere.com", []string{"ns1.registrar.com", "ns2.registrar.com"}, false},
+		{"partial.com", []string{"ns-1.awsdns-01.org"}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.domain, func(t *testing.T) {
+			resolved, delegated, err := i.CheckDelegation(context.Background(), c.domain+".", zoneNS)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(resolved, c.resolved) {
+				t.Errorf("resolved %v, want %v", resolved, c.resolved)
+			}
+			if delegated != c.delegated {
+				t.Errorf("delegated = %v, want %v", delegated, c.delegated)
+			}
+		})
+	}
+}
+
+func TestCheckDelegationNoRecords(t *testing.T) {
+	srv := newFakeDNSServer(t, nil)
+	i := &Infrastructure{Resolver: srv.resolver()}
+
+	_, delegated, err := i.CheckDelegation(context.Background(), "unknown.com.", []string{"ns-1.awsdns-01.org"})
+	if err == nil && delegated {
+		t.Error("domain without NS records reported as delegated")
+	}
+}
@@ -3,6 +3,7 @@ package infrastructure
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/apparentlymart/go-cidr/cidr"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
@@ -10,35 +11,119 @@ import (
 )
 
 const (
-	vpcFrozenBits  = 16
-	minVPCCidr     = "10.0.0.0/16"
-	largestVPCCidr = "10.0.0.0/8"
+	vpcFrozenBits = 16
+
+	// DefaultVpcCIDRPool is the range VPC CIDRs are allocated from when
+	// the server configuration doesn't specify one.
+	DefaultVpcCIDRPool = "10.0.0.0/8"
 )
 
-// nextAvailableCIDR returns the first /16 CIDR available for use in the target AWS account-Region
-func (i *Infrastructure) nextAvailableCIDR(ctx context.Context) (string, error) {
-	// todo: paginate to ensure we have all VPCs
-	res, err := i.Ec2.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{})
+// ErrCIDRUnavailable is returned when a VPC CIDR cannot be allocated
+var ErrCIDRUnavailable = errors.New("CIDR unavailable")
+
+// NextAvailableCIDR returns the first /16 CIDR in the VPC CIDR pool that doesn't
+// overlap with any VPC in the target AWS account-Region, any of the reserved
+// CIDRs or any of the excluded ranges.
+func (i *Infrastructure) NextAvailableCIDR(ctx context.Context, reserved []string) (string, error) {
+	used, err := i.usedCIDRs(ctx, reserved)
 	if err != nil {
 		return "", err
 	}
-	existingCidrs := make([]*net.IPNet, len(res.Vpcs))
-	for j, vpc := range res.Vpcs {
-		_, ipn, _ := net.ParseCIDR(aws.ToString(vpc.CidrBlock))
-		existingCidrs[j] = ipn
+
+	pool := i.vpcCIDRPool()
+	if ones, _ := pool.Mask.Size(); ones > vpcFrozenBits {
+		return "", fmt.Errorf("VPC CIDR pool %s is smaller than a /%d", pool, vpcFrozenBits)
 	}
 
-	_, super, _ := net.ParseCIDR(largestVPCCidr)
-	_, proposed, _ := net.ParseCIDR(minVPCCidr)
+	proposed := &net.IPNet{IP: pool.IP, Mask: net.CIDRMask(vpcFrozenBits, 32)}
 	for {
-		all := append(existingCidrs, proposed)
-		if err := cidr.VerifyNoOverlap(all, super); err == nil {
+		if !overlapsAny(proposed, used) {
 			return proposed.String(), nil
 		}
 		next, maxed := cidr.NextSubnet(proposed, vpcFrozenBits)
-		if maxed || (next.IP[0] > 10) {
-			return "", errors.New("no CIDRs available")
+		if maxed || !pool.Contains(next.IP) {
+			return "", fmt.Errorf("%w: no free /%d left in pool %s", ErrCIDRUnavailable, vpcFrozenBits, pool)
 		}
 		proposed = next
 	}
 }
+
+// CheckCIDRAvailable returns an error if the given CIDR lies outside the VPC CIDR
+// pool or overlaps with any VPC in the target AWS account-Region, any of the
+// reserved CIDRs or any of the excluded ranges.
+func (i *Infrastructure) CheckCIDRAvailable(ctx context.Context, c string, reserved []string) error {
+	_, proposed, err := net.ParseCIDR(c)
+	if err != nil {
+		return err
+	}
+	pool := i.vpcCIDRPool()
+	poolOnes, _ := pool.Mask.Size()
+	if ones, _ := proposed.Mask.Size(); !pool.Contains(proposed.IP) || ones < poolOnes {
+		return fmt.Errorf("%w: %s lies outside the VPC CIDR pool %s", ErrCIDRUnavailable, c, pool)
+	}
+	used, err := i.usedCIDRs(ctx, reserved)
+	if err != nil {
+		return err
+	}
+	for _, u := range used {
+		if overlaps(proposed, u) {
+			return fmt.Errorf("%w: %s overlaps with %s which is already in use", ErrCIDRUnavailable, c, u)
+		}
+	}
+	return nil
+}
+
+// vpcCIDRPool returns the range VPC CIDRs are allocated from
+func (i *Infrastructure) vpcCIDRPool() *net.IPNet {
+	if i.VpcCIDRPool != nil {
+		return i.VpcCIDRPool
+	}
+	_, pool, _ := net.ParseCIDR(DefaultVpcCIDRPool)
+	return pool
+}
+
+// usedCIDRs returns all CIDRs that must not be allocated to a new VPC
+func (i *Infrastructure) usedCIDRs(ctx context.Context, reserved []string) ([]*net.IPNet, error) {
+	res := append([]*net.IPNet{}, i.VpcCIDRExclusions...)
+
+	for _, r := range reserved {
+		_, ipn, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reserved CIDR %s: %v", r, err)
+		}
+		res = append(res, ipn)
+	}
+
+	p := ec2.NewDescribeVpcsPaginator(i.Ec2, &ec2.DescribeVpcsInput{})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, vpc := range page.Vpcs {
+			// a VPC may have secondary CIDR blocks associated with it
+			for _, a := range vpc.CidrBlockAssociationSet {
+				if _, ipn, err := net.ParseCIDR(aws.ToString(a.CidrBlock)); err == nil {
+					res = append(res, ipn)
+				}
+			}
+			if _, ipn, err := net.ParseCIDR(aws.ToString(vpc.CidrBlock)); err == nil {
+				res = append(res, ipn)
+			}
+		}
+	}
+	return res, nil
+}
+
+func overlapsAny(n *net.IPNet, others []*net.IPNet) bool {
+	for _, o := range others {
+		if overlaps(n, o) {
+			return true
+		}
+	}
+	return false
+}
+
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
@@ -2,10 +2,12 @@ package infrastructure
 
 import (
 	"context"
+	"errors"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
-	"strconv"
+	"sort"
+	"strings"
 )
 
 func (i *Infrastructure) ECSService(ctx context.Context, service, cluster string) (types.Service, error) {
@@ -36,49 +38,171 @@ func (i *Infrastructure) ECSServicePrimaryDeployment(ctx context.Context, servic
 	return s.Deployments[0], nil
 }
 
-// memRange returns discrete memory values (MB) from start to end
-// at increments of 1024.
-func memRange(start, end int) []int {
-	var res []int
-	inc := 1024
-	for i := start; i <= end; i += inc {
-		res = append(res, i)
-	}
-	return res
-}
+// ECSDeploymentTaskIssues returns the problems reported by ECS for the tasks
+// launched by a service deployment, keyed by task ID. Tasks without problems
+// are not included.
+func (i *Infrastructure) ECSDeploymentTaskIssues(ctx context.Context, cluster, deploymentId string) (map[string]string, error) {
+	var arns []string
+	for _, status := range []types.DesiredStatus{types.DesiredStatusRunning, types.DesiredStatusStopped} {
+		res, err := i.Ecs.ListTasks(ctx, &ecs.ListTasksInput{
+			Cluster:       aws.String(cluster),
+			StartedBy:     aws.String(deploymentId),
+			DesiredStatus: status,
+		})
+		if err != nil {
+			return nil, err
+		}
+		arns = append(arns, res.TaskArns...)
+	}
+	if len(arns) == 0 {
+		return nil, nil
+	}
+	// DescribeTasks accepts at most 100 tasks
+	if len(arns) > 100 {
+		arns = arns[:100]
+	}
 
-// fargateRoundedCPU returns the amount of CPU compatible with fargate.
-// It is at least as much as the user-specified CPU.
-func fargateRoundedCPU(cpu int) string {
-	rng := []int{0, 256, 512, 1024, 2048, 4096}
-	for i := 0; i < len(rng)-1; i++ {
-		if cpu > rng[i] && cpu <= rng[i+1] {
-			return strconv.Itoa(rng[i+1])
+	res, err := i.Ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(cluster),
+		Tasks:   arns,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make(map[string]string)
+	for _, t := range res.Tasks {
+		var msgs []string
+		for _, c := range t.Containers {
+			if c.HealthStatus == types.HealthStatusUnhealthy {
+				msgs = append(msgs, "container "+aws.ToString(c.Name)+" is unhealthy")
+			}
+			if c.Reason != nil {
+				msgs = append(msgs, "container "+aws.ToString(c.Name)+": "+aws.ToString(c.Reason))
+			}
+		}
+		if t.StoppedReason != nil {
+			msgs = append(msgs, "stopped: "+aws.ToString(t.StoppedReason))
+		}
+		if len(msgs) > 0 {
+			issues[ECSTaskID(aws.ToString(t.TaskArn))] = strings.Join(msgs, "; ")
 		}
 	}
-	// todo: return err if cpu > max rng in fargate
-	return strconv.Itoa(rng[len(rng)-1])
+	return issues, nil
 }
 
-// fargateRoundedMemory returns the amount of Memory compatible with fargate.
-// It is at least as much as the user-specified memory.
-func fargateRoundedMemory(cpu, memory int) string {
-	ranges := map[string][]int{
-		"256":  {512, 1024, 2048},
-		"512":  memRange(1024, 4096),
-		"1024": memRange(2048, 8192),
-		"2048": memRange(4096, 16384),
-		"4096": memRange(9216, 30720),
-	}
-	rng := ranges[fargateRoundedCPU(cpu)]
-	if memory <= rng[0] {
-		return strconv.Itoa(rng[0])
-	}
-	for i := 0; i < len(rng)-1; i++ {
-		if memory <= rng[i+1] {
-			return strconv.Itoa(rng[i+1])
+// ECSTaskDefinition returns the details of a task definition
+func (i *Infrastructure) ECSTaskDefinition(ctx context.Context, arn string) (*types.TaskDefinition, error) {
+	res, err := i.Ecs.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(arn),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.TaskDefinition, nil
+}
+
+// ECSStoppedTasks returns the tasks of a service that were recently stopped,
+// most recent first. ECS only retains stopped tasks for a short while.
+func (i *Infrastructure) ECSStoppedTasks(ctx context.Context, cluster, service string, limit int) ([]types.Task, error) {
+	list, err := i.Ecs.ListTasks(ctx, &ecs.ListTasksInput{
+		Cluster:       aws.String(cluster),
+		ServiceName:   aws.String(service),
+		DesiredStatus: types.DesiredStatusStopped,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(list.TaskArns) == 0 {
+		return nil, nil
+	}
+	// DescribeTasks accepts at most 100 tasks
+	arns := list.TaskArns
+	if len(arns) > 100 {
+		arns = arns[:100]
+	}
+
+	res, err := i.Ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(cluster),
+		Tasks:   arns,
+	})
+	if err != nil {
+		return nil, err
+	}
+	tasks := res.Tasks
+	sort.Slice(tasks, func(a, b int) bool {
+		return aws.ToTime(tasks[a].StoppedAt).After(aws.ToTime(tasks[b].StoppedAt))
+	})
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+	}
+	return tasks, nil
+}
+
+// ErrNoExecTask is returned when none of a service's running tasks accept ECS Exec sessions
+var ErrNoExecTask = errors.New("no running task of the app accepts exec sessions yet")
+
+// ECSExecTask returns the ARN of a running task of a service that accepts
+// ECS Exec sessions, ie, its execute command agent is running.
+func (i *Infrastructure) ECSExecTask(ctx context.Context, cluster, service string) (string, error) {
+	list, err := i.Ecs.ListTasks(ctx, &ecs.ListTasksInput{
+		Cluster:       aws.String(cluster),
+		ServiceName:   aws.String(service),
+		DesiredStatus: types.DesiredStatusRunning,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(list.TaskArns) == 0 {
+		return "", ErrNoExecTask
+	}
+	// DescribeTasks accepts at most 100 tasks
+	arns := list.TaskArns
+	if len(arns) > 100 {
+		arns = arns[:100]
+	}
+
+	res, err := i.Ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(cluster),
+		Tasks:   arns,
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, t := range res.Tasks {
+		if !t.EnableExecuteCommand || aws.ToString(t.LastStatus) != "RUNNING" {
+			continue
+		}
+		for _, c := range t.Containers {
+			for _, a := range c.ManagedAgents {
+				if a.Name == types.ManagedAgentNameExecuteCommandAgent && aws.ToString(a.LastStatus) == "RUNNING" {
+					return aws.ToString(t.TaskArn), nil
+				}
+			}
 		}
 	}
-	// todo: return err if memory > max rng in fargate
-	return strconv.Itoa(rng[len(rng)-1])
+	return "", ErrNoExecTask
+}
+
+// ECSExecuteCommand starts an interactive ECS Exec session running a command
+// in a container of a task. The returned session must be opened via OpenSSMSession.
+func (i *Infrastructure) ECSExecuteCommand(
+	ctx context.Context, cluster, task, container, command string,
+) (*types.Session, error) {
+	res, err := i.Ecs.ExecuteCommand(ctx, &ecs.ExecuteCommandInput{
+		Cluster:     aws.String(cluster),
+		Task:        aws.String(task),
+		Container:   aws.String(container),
+		Command:     aws.String(command),
+		Interactive: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Session, nil
+}
+
+// ECSTaskID returns the ID of a task from its ARN
+func ECSTaskID(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
 }
@@ -0,0 +1,19 @@
+package infrastructure
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+)
+
+// TargetHealth returns the health of all targets registered with a target group
+func (i *Infrastructure) TargetHealth(ctx context.Context, targetGroup string) ([]types.TargetHealthDescription, error) {
+	res, err := i.Elbv2.DescribeTargetHealth(ctx, &elasticloadbalancingv2.DescribeTargetHealthInput{
+		TargetGroupArn: aws.String(targetGroup),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.TargetHealthDescriptions, nil
+}
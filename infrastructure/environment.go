@@ -2,32 +2,105 @@ package infrastructure
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/cloudfauj/cloudfauj/environment"
 	"github.com/hashicorp/terraform-exec/tfexec"
+	"io/fs"
+	"os"
 	"strings"
 	"text/template"
 )
 
+// computeAZCount is the number of AZs private compute subnets are spread across
+const computeAZCount = 2
+
 func (i *Infrastructure) EnvTFConfig(
 	ctx context.Context, e *environment.Environment, dsf string,
 ) (map[string]string, error) {
-	cidr, err := i.nextAvailableCIDR(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to compute VPC CIDR: %v", err)
+	data := map[string]interface{}{"env_name": e.Name, "domain_enabled": e.DomainEnabled()}
+	networkTpl, albTpl := envNetworkTfTpl, envAlbTfTpl
+	orchestrator := fmt.Sprintf(envOrchestratorTfTpl, e.Name)
+
+	// Existing AWS resources are only read via data sources, so destroying
+	// the environment leaves them untouched.
+	if ex := e.Existing; ex != nil {
+		networkTpl = envImportedNetworkTfTpl
+		var subnets []string
+		for _, s := range ex.SubnetIds {
+			subnets = append(subnets, hclString(s))
+		}
+		data["vpc_id"], data["subnet_ids"] = hclString(ex.VpcId), subnets
+		if ex.EcsCluster != "" {
+			orchestrator = fmt.Sprintf(envImportedOrchestratorTfTpl, hclString(ex.EcsCluster))
+		}
+		if ex.Alb != "" {
+			albTpl = envImportedAlbTfTpl
+			data["alb_name"] = hclString(ex.Alb)
+		}
+	} else {
+		// rendering the VPC without its CIDR would replace it along with everything in it
+		if e.VpcCidr == "" {
+			return nil, fmt.Errorf("VPC CIDR of environment %s is unknown", e.Name)
+		}
+		data["vpc_cidr"] = e.VpcCidr
+		data["private_compute"] = e.PrivateCompute()
+		data["compute_az_count"] = computeAZCount
+		data["nat_gateway_count"] = 1
+		if e.PerAZNatGateways() {
+			data["nat_gateway_count"] = computeAZCount
+		}
 	}
+
 	res := map[string]string{
-		"terraform.tf":    i.tfCoreConfig(),
-		"network.tf":      i.envTfConfig(envNetworkTfTpl, e.Name, cidr),
-		"orchestrator.tf": fmt.Sprintf(envOrchestratorTfTpl, e.Name),
+		tfCoreConfigFile:  i.tfCoreConfig(),
+		"network.tf":      i.envTfConfig(networkTpl, data),
+		"iam.tf":          i.envTfConfig(envIamTfTpl, data),
+		"orchestrator.tf": orchestrator,
 	}
 	if e.DomainEnabled() {
 		res["domain.tf"] = fmt.Sprintf(envDomainStateTfTpl, dsf)
-		res["load_balancer.tf"] = i.envTfConfig(envAlbTfTpl, e.Name, cidr)
+	}
+	if e.LoadBalancerEnabled() {
+		res["load_balancer.tf"] = i.envTfConfig(albTpl, data)
 	}
 	return res, nil
 }
 
+// EnvVpcCIDR returns the CIDR of an environment's VPC recorded in its TF state
+// file. It returns an empty string if the state doesn't contain the VPC.
+func (i *Infrastructure) EnvVpcCIDR(stateFile string) (string, error) {
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	var st struct {
+		Resources []struct {
+			Mode      string `json:"mode"`
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Instances []struct {
+				Attributes struct {
+					CidrBlock string `json:"cidr_block"`
+				} `json:"attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return "", fmt.Errorf("failed to parse TF state: %v", err)
+	}
+	for _, r := range st.Resources {
+		if r.Mode == "managed" && r.Type == "aws_vpc" && r.Name == "main_vpc" && len(r.Instances) > 0 {
+			return r.Instances[0].Attributes.CidrBlock, nil
+		}
+	}
+	return "", nil
+}
+
 func (i *Infrastructure) CreateEnvironment(ctx context.Context, tf *tfexec.Terraform) error {
 	if err := tf.Init(ctx); err != nil {
 		return fmt.Errorf("failed to initialize terraform: %v", err)
@@ -56,10 +129,36 @@ func (i *Infrastructure) ApplyEnv(ctx context.Context, tf *tfexec.Terraform) err
 	return tf.Apply(ctx)
 }
 
-func (i *Infrastructure) envTfConfig(tpl, env, cidr string) string {
+// PlanEnvUpdate shows the changes to an environment's infrastructure and saves
+// them in planFile, so that exactly these changes can be applied later.
+func (i *Infrastructure) PlanEnvUpdate(ctx context.Context, tf *tfexec.Terraform, planFile string) error {
+	if err := tf.Init(ctx); err != nil {
+		return fmt.Errorf("failed to initialize terraform: %v", err)
+	}
+	if _, err := tf.Plan(ctx, tfexec.Out(planFile)); err != nil {
+		return fmt.Errorf("failed to plan changes: %v", err)
+	}
+	return nil
+}
+
+// ApplyEnvPlan applies the changes saved in planFile by PlanEnvUpdate. It fails
+// if the environment's infrastructure changed since the plan was made.
+func (i *Infrastructure) ApplyEnvPlan(ctx context.Context, tf *tfexec.Terraform, planFile string) error {
+	if err := tf.Apply(ctx, tfexec.DirOrPlan(planFile)); err != nil {
+		return fmt.Errorf("failed to apply planned changes: %v", err)
+	}
+	return nil
+}
+
+// EnvALBDNSName returns the DNS name of the load balancer routing traffic to
+// an environment's apps. It returns an empty string if the env has none.
+func (i *Infrastructure) EnvALBDNSName(ctx context.Context, tf *tfexec.Terraform) (string, error) {
+	return i.tfOutput(ctx, tf, "apps_alb_dns_name")
+}
+
+func (i *Infrastructure) envTfConfig(tpl string, data map[string]interface{}) string {
 	var b strings.Builder
 	t := template.Must(template.New("").Parse(tpl))
-	data := map[string]interface{}{"env_name": env, "vpc_cidr": cidr}
 
 	t.Execute(&b, data)
 	return b.String()
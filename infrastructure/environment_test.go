@@ -0,0 +1,80 @@
+package infrastructure
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/cloudfauj/cloudfauj/environment"
+)
+
+func TestEnvTFConfigVpcCidr(t *testing.T) {
+	i := &Infrastructure{}
+
+	configs, err := i.EnvTFConfig(context.Background(), &environment.Environment{Name: "staging", VpcCidr: "10.1.0.0/16"}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(configs["network.tf"], `"10.1.0.0/16"`) {
+		t.Errorf("network config doesn't contain the VPC CIDR:\n%s", configs["network.tf"])
+	}
+
+	// envs created before CIDRs were reserved in state have none until backfilled
+	if _, err := i.EnvTFConfig(context.Background(), &environment.Environment{Name: "staging"}, ""); err == nil {
+		t.Error("got config for an environment without a VPC CIDR")
+	}
+
+	imported := &environment.Environment{
+		Name:     "staging",
+		Existing: &environment.ExistingResources{VpcId: "vpc-1", SubnetIds: []string{"subnet-1"}},
+	}
+	if _, err := i.EnvTFConfig(context.Background(), imported, ""); err != nil {
+		t.Errorf("unexpected error for an imported environment: %v", err)
+	}
+}
+
+func TestEnvVpcCIDR(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		f := path.Join(dir, name)
+		if err := os.WriteFile(f, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	i := &Infrastructure{}
+
+	cases := []struct {
+		name    string
+		file    string
+		cidr    string
+		wantErr bool
+	}{
+		{
+			"vpc",
+			write("vpc.tfstate", `{"version": 4, "resources": [
+				{"mode": "data", "type": "aws_vpc", "name": "main_vpc", "instances": [{"attributes": {"cidr_block": "10.9.0.0/16"}}]},
+				{"mode": "managed", "type": "aws_subnet", "name": "compute", "instances": [{"attributes": {"cidr_block": "10.0.1.0/24"}}]},
+				{"mode": "managed", "type": "aws_vpc", "name": "main_vpc", "instances": [{"attributes": {"cidr_block": "10.0.0.0/16"}}]}
+			]}`),
+			"10.0.0.0/16",
+			false,
+		},
+		{"no vpc", write("empty.tfstate", `{"version": 4, "resources": []}`), "", false},
+		{"no state", path.Join(dir, "missing.tfstate"), "", false},
+		{"invalid state", write("invalid.tfstate", `{`), "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cidr, err := i.EnvVpcCIDR(c.file)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("EnvVpcCIDR() error = %v, want error = %v", err, c.wantErr)
+			}
+			if cidr != c.cidr {
+				t.Errorf("got CIDR %q, want %q", cidr, c.cidr)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"net/url"
+)
+
+var ErrPolicyNotFound = errors.New("policy does not exist")
+
+// stringOrList decodes an IAM policy element that is either a single string or a list of them
+type stringOrList []string
+
+func (s *stringOrList) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err == nil {
+		*s = []string{v}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(s))
+}
+
+type policyStatement struct {
+	Effect    string
+	Action    stringOrList
+	NotAction stringOrList
+}
+
+// ManagedPolicyActions returns the actions allowed by the default version of a
+// managed IAM policy. A statement allowing all actions except some (NotAction)
+// is reported as allowing "*".
+func (i *Infrastructure) ManagedPolicyActions(ctx context.Context, arn string) ([]string, error) {
+	p, err := i.Iam.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: aws.String(arn)})
+	if err != nil {
+		var notFound *types.NoSuchEntityException
+		if errors.As(err, &notFound) {
+			return nil, ErrPolicyNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch policy: %v", err)
+	}
+	v, err := i.Iam.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+		PolicyArn: aws.String(arn),
+		VersionId: p.Policy.DefaultVersionId,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch policy version: %v", err)
+	}
+
+	// the document is returned URL-encoded
+	doc, err := url.PathUnescape(aws.ToString(v.PolicyVersion.Document))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode policy document: %v", err)
+	}
+	var policy struct {
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(doc), &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy document: %v", err)
+	}
+	// a policy's statement is either a single statement or a list of them
+	var statements []policyStatement
+	if err := json.Unmarshal(policy.Statement, &statements); err != nil {
+		var s policyStatement
+		if err := json.Unmarshal(policy.Statement, &s); err != nil {
+			return nil, fmt.Errorf("failed to parse policy statements: %v", err)
+		}
+		statements = []policyStatement{s}
+	}
+
+	var res []string
+	for _, s := range statements {
+		if s.Effect != "Allow" {
+			continue
+		}
+		if len(s.NotAction) > 0 {
+			res = append(res, "*")
+		}
+		res = append(res, s.Action...)
+	}
+	return res, nil
+}
@@ -0,0 +1,49 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/cloudfauj/cloudfauj/environment"
+)
+
+// ValidateExistingResources ensures that the existing AWS resources an
+// environment is to be built upon are present in the target account-Region.
+func (i *Infrastructure) ValidateExistingResources(ctx context.Context, r *environment.ExistingResources) error {
+	vpcs, err := i.Ec2.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{VpcIds: []string{r.VpcId}})
+	if err != nil {
+		return fmt.Errorf("failed to find VPC %s: %v", r.VpcId, err)
+	}
+	if len(vpcs.Vpcs) == 0 {
+		return fmt.Errorf("VPC %s does not exist", r.VpcId)
+	}
+
+	subnets, err := i.Ec2.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{SubnetIds: r.SubnetIds})
+	if err != nil {
+		return fmt.Errorf("failed to find subnets: %v", err)
+	}
+	if len(subnets.Subnets) != len(r.SubnetIds) {
+		return fmt.Errorf("only %d of the %d subnets exist", len(subnets.Subnets), len(r.SubnetIds))
+	}
+	for _, s := range subnets.Subnets {
+		if aws.ToString(s.VpcId) != r.VpcId {
+			return fmt.Errorf("subnet %s does not belong to VPC %s", aws.ToString(s.SubnetId), r.VpcId)
+		}
+	}
+
+	if r.EcsCluster == "" {
+		return nil
+	}
+	clusters, err := i.Ecs.DescribeClusters(ctx, &ecs.DescribeClustersInput{
+		Clusters: []string{r.EcsCluster},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find ECS cluster %s: %v", r.EcsCluster, err)
+	}
+	if len(clusters.Clusters) == 0 || aws.ToString(clusters.Clusters[0].Status) != "ACTIVE" {
+		return fmt.Errorf("ECS cluster %s does not exist or is not active", r.EcsCluster)
+	}
+	return nil
+}
@@ -1,9 +1,13 @@
 package infrastructure
 
 import (
+	"github.com/aws/aws-sdk-go-v2/service/acm"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/sirupsen/logrus"
+	"net"
 )
 
 // Interacts with AWS and Terraform to provision and manage infrastructure resources.
@@ -12,5 +16,24 @@ type Infrastructure struct {
 	Region   string
 	Ec2      *ec2.Client
 	Ecs      *ecs.Client
+	Acm      *acm.Client
+	Elbv2    *elasticloadbalancingv2.Client
+	Iam      *iam.Client
+	Logs     CloudWatchLogsAPI
 	TFBinary string
+
+	// Version of the Terraform AWS provider used in all generated configuration
+	AWSProviderVersion string
+
+	// API token used to manage DNS records of domains using Cloudflare
+	CloudflareAPIToken string
+
+	// Resolver used to check whether domains are delegated to their hosted zones.
+	// Defaults to the system's resolver.
+	Resolver *net.Resolver
+
+	// Range new VPC CIDRs are allocated from. Defaults to DefaultVpcCIDRPool.
+	VpcCIDRPool *net.IPNet
+	// Ranges that must never be allocated to a VPC, eg- peered or on-prem networks
+	VpcCIDRExclusions []*net.IPNet
 }
@@ -0,0 +1,163 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"strings"
+	"time"
+)
+
+// CloudWatchLogsAPI is the subset of the CloudWatch Logs API used to read
+// application logs & manage their retention. It is satisfied by *cloudwatchlogs.Client
+// and lets a fake be used instead where AWS isn't available.
+type CloudWatchLogsAPI interface {
+	FilterLogEvents(
+		context.Context, *cloudwatchlogs.FilterLogEventsInput, ...func(*cloudwatchlogs.Options),
+	) (*cloudwatchlogs.FilterLogEventsOutput, error)
+	CreateLogGroup(
+		context.Context, *cloudwatchlogs.CreateLogGroupInput, ...func(*cloudwatchlogs.Options),
+	) (*cloudwatchlogs.CreateLogGroupOutput, error)
+	PutRetentionPolicy(
+		context.Context, *cloudwatchlogs.PutRetentionPolicyInput, ...func(*cloudwatchlogs.Options),
+	) (*cloudwatchlogs.PutRetentionPolicyOutput, error)
+	DeleteRetentionPolicy(
+		context.Context, *cloudwatchlogs.DeleteRetentionPolicyInput, ...func(*cloudwatchlogs.Options),
+	) (*cloudwatchlogs.DeleteRetentionPolicyOutput, error)
+}
+
+// Interval at which new log events are fetched when following an app's logs
+var appLogsPollInterval = 5 * time.Second
+
+// AppLogEvent is a single line logged by an application's container
+type AppLogEvent struct {
+	Id        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	// ID of the ECS task the line was logged by
+	TaskId  string `json:"task_id"`
+	Message string `json:"message"`
+}
+
+// AppLogs returns the events logged by an application in an environment since
+// the given time, oldest first. Only events matching the CloudWatch filter pattern
+// are returned if one is specified.
+//
+// Containers log to the env's log group, in streams named <app>/<container>/<task id>.
+func (i *Infrastructure) AppLogs(
+	ctx context.Context, env, app string, since time.Time, filter string,
+) ([]*AppLogEvent, error) {
+	var res []*AppLogEvent
+
+	in := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:        aws.String(env),
+		LogStreamNamePrefix: aws.String(app + "/"),
+		StartTime:           aws.Int64(since.UnixNano() / int64(time.Millisecond)),
+	}
+	if filter != "" {
+		in.FilterPattern = aws.String(filter)
+	}
+	for {
+		out, err := i.Logs.FilterLogEvents(ctx, in)
+		if err != nil {
+			// no app in the env has logged anything yet
+			var notFound *types.ResourceNotFoundException
+			if errors.As(err, &notFound) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to fetch log events: %v", err)
+		}
+		for _, e := range out.Events {
+			stream := aws.ToString(e.LogStreamName)
+			res = append(res, &AppLogEvent{
+				Id:        aws.ToString(e.EventId),
+				Timestamp: time.Unix(0, aws.ToInt64(e.Timestamp)*int64(time.Millisecond)),
+				TaskId:    stream[strings.LastIndex(stream, "/")+1:],
+				Message:   strings.TrimRight(aws.ToString(e.Message), "\n"),
+			})
+		}
+		if out.NextToken == nil {
+			break
+		}
+		in.NextToken = out.NextToken
+	}
+	return res, nil
+}
+
+// StreamAppLogs calls fn with every event logged by an application in an environment
+// since the given time, oldest first. If follow is true, new events are fetched
+// periodically until ctx is done. It stops at the first error returned by fn and
+// returns it.
+func (i *Infrastructure) StreamAppLogs(
+	ctx context.Context, env, app string, since time.Time, filter string, follow bool, fn func(*AppLogEvent) error,
+) error {
+	var seen map[string]bool
+	for {
+		events, err := i.AppLogs(ctx, env, app, since, filter)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		for _, e := range events {
+			if seen[e.Id] {
+				continue
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+			if e.Timestamp.After(since) {
+				since = e.Timestamp
+			}
+		}
+		// The next fetch starts at the timestamp of the last event, so events
+		// sharing that timestamp are fetched again and must be skipped.
+		seen = make(map[string]bool)
+		for _, e := range events {
+			if e.Timestamp.Equal(since) {
+				seen[e.Id] = true
+			}
+		}
+
+		if !follow {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(appLogsPollInterval):
+		}
+	}
+}
+
+// SetLogRetention sets the number of days the logs of an environment's apps
+// are retained for. 0 retains them forever. The env's log group is created if
+// no app has logged to it yet.
+func (i *Infrastructure) SetLogRetention(ctx context.Context, env string, days int) error {
+	_, err := i.Logs.CreateLogGroup(ctx, &cloudwatchlogs.CreateLogGroupInput{LogGroupName: aws.String(env)})
+	if err != nil {
+		var exists *types.ResourceAlreadyExistsException
+		if !errors.As(err, &exists) {
+			return fmt.Errorf("failed to create log group: %v", err)
+		}
+	}
+
+	if days == 0 {
+		_, err = i.Logs.DeleteRetentionPolicy(ctx, &cloudwatchlogs.DeleteRetentionPolicyInput{
+			LogGroupName: aws.String(env),
+		})
+	} else {
+		_, err = i.Logs.PutRetentionPolicy(ctx, &cloudwatchlogs.PutRetentionPolicyInput{
+			LogGroupName:    aws.String(env),
+			RetentionInDays: aws.Int32(int32(days)),
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set log retention: %v", err)
+	}
+	return nil
+}
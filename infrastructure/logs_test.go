@@ -0,0 +1,242 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// fakeLogsClient serves FilterLogEvents from an in-memory list of events,
+// pageSize events at a time, and records the inputs it receives.
+type fakeLogsClient struct {
+	mu       sync.Mutex
+	group    string
+	events   []types.FilteredLogEvent
+	pageSize int
+	inputs   []cloudwatchlogs.FilterLogEventsInput
+}
+
+func (f *fakeLogsClient) add(stream, id string, t time.Time, msg string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, types.FilteredLogEvent{
+		EventId:       aws.String(id),
+		LogStreamName: aws.String(stream),
+		Timestamp:     aws.Int64(t.UnixMilli()),
+		Message:       aws.String(msg),
+	})
+}
+
+func (f *fakeLogsClient) calls() []cloudwatchlogs.FilterLogEventsInput {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]cloudwatchlogs.FilterLogEventsInput(nil), f.inputs...)
+}
+
+func (f *fakeLogsClient) FilterLogEvents(
+	_ context.Context, in *cloudwatchlogs.FilterLogEventsInput, _ ...func(*cloudwatchlogs.Options),
+) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inputs = append(f.inputs, *in)
+
+	if aws.ToString(in.LogGroupName) != f.group {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("log group does not exist")}
+	}
+
+	var matched []types.FilteredLogEvent
+	for _, e := range f.events {
+		if in.StartTime != nil && *e.Timestamp < *in.StartTime {
+			continue
+		}
+		if !strings.HasPrefix(*e.LogStreamName, aws.ToString(in.LogStreamNamePrefix)) {
+			continue
+		}
+		if !strings.Contains(*e.Message, aws.ToString(in.FilterPattern)) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+
+	start := 0
+	if in.NextToken != nil {
+		start, _ = strconv.Atoi(*in.NextToken)
+	}
+	end := start + f.pageSize
+	if f.pageSize == 0 || end > len(matched) {
+		end = len(matched)
+	}
+	out := &cloudwatchlogs.FilterLogEventsOutput{Events: matched[start:end]}
+	if end < len(matched) {
+		out.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+func (f *fakeLogsClient) CreateLogGroup(
+	context.Context, *cloudwatchlogs.CreateLogGroupInput, ...func(*cloudwatchlogs.Options),
+) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+}
+
+func (f *fakeLogsClient) PutRetentionPolicy(
+	context.Context, *cloudwatchlogs.PutRetentionPolicyInput, ...func(*cloudwatchlogs.Options),
+) (*cloudwatchlogs.PutRetentionPolicyOutput, error) {
+	return &cloudwatchlogs.PutRetentionPolicyOutput{}, nil
+}
+
+func (f *fakeLogsClient) DeleteRetentionPolicy(
+	context.Context, *cloudwatchlogs.DeleteRetentionPolicyInput, ...func(*cloudwatchlogs.Options),
+) (*cloudwatchlogs.DeleteRetentionPolicyOutput, error) {
+	return &cloudwatchlogs.DeleteRetentionPolicyOutput{}, nil
+}
+
+func eventIds(events []*AppLogEvent) []string {
+	var res []string
+	for _, e := range events {
+		res = append(res, e.Id)
+	}
+	return res
+}
+
+func TestAppLogsPagination(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	f := &fakeLogsClient{group: "staging", pageSize: 2}
+	for i := 1; i <= 5; i++ {
+		f.add("api/api/task"+strconv.Itoa(i), strconv.Itoa(i), now.Add(time.Duration(i)*time.Second), "line\n")
+	}
+	f.add("worker/worker/task9", "9", now, "other app")
+	i := &Infrastructure{Logs: f}
+
+	events, err := i.AppLogs(context.Background(), "staging", "api", now, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := eventIds(events); !reflect.DeepEqual(ids, []string{"1", "2", "3", "4", "5"}) {
+		t.Errorf("got events %v, want 1-5 in order", ids)
+	}
+	if e := events[0]; e.TaskId != "task1" || e.Message != "line" || !e.Timestamp.Equal(now.Add(time.Second)) {
+		t.Errorf("event parsed as %+v", e)
+	}
+
+	calls := f.calls()
+	if len(calls) != 3 {
+		t.Fatalf("made %d calls, want 3", len(calls))
+	}
+	for n, c := range calls {
+		if aws.ToString(c.LogStreamNamePrefix) != "api/" {
+			t.Errorf("call %d: stream prefix %q, want api/", n, aws.ToString(c.LogStreamNamePrefix))
+		}
+	}
+	if calls[0].NextToken != nil || aws.ToString(calls[1].NextToken) != "2" || aws.ToString(calls[2].NextToken) != "4" {
+		t.Error("next tokens weren't passed on between pages")
+	}
+}
+
+func TestAppLogsStartTime(t *testing.T) {
+	now := time.Now()
+	f := &fakeLogsClient{group: "staging"}
+	f.add("api/api/a", "old", now.Add(-time.Hour), "old")
+	f.add("api/api/a", "new", now.Add(time.Second), "new")
+	i := &Infrastructure{Logs: f}
+
+	events, err := i.AppLogs(context.Background(), "staging", "api", now, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := eventIds(events); !reflect.DeepEqual(ids, []string{"new"}) {
+		t.Errorf("got events %v, want [new]", ids)
+	}
+	if got := aws.ToInt64(f.calls()[0].StartTime); got != now.UnixMilli() {
+		t.Errorf("start time %d, want %d", got, now.UnixMilli())
+	}
+}
+
+func TestAppLogsMissingGroup(t *testing.T) {
+	i := &Infrastructure{Logs: &fakeLogsClient{group: "staging"}}
+
+	events, err := i.AppLogs(context.Background(), "production", "api", time.Now(), "")
+	if err != nil || len(events) != 0 {
+		t.Errorf("got %v, %v, want no events & no error", events, err)
+	}
+}
+
+func TestStreamAppLogs(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	f := &fakeLogsClient{group: "staging", pageSize: 1}
+	f.add("api/api/a", "1", now.Add(time.Second), "one")
+	f.add("api/api/a", "2", now.Add(2*time.Second), "two")
+	i := &Infrastructure{Logs: f}
+
+	var got []*AppLogEvent
+	err := i.StreamAppLogs(context.Background(), "staging", "api", now, "", false, func(e *AppLogEvent) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := eventIds(got); !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Errorf("got events %v, want [1 2]", ids)
+	}
+
+	stop := errors.New("stop")
+	err = i.StreamAppLogs(context.Background(), "staging", "api", now, "", false, func(*AppLogEvent) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("got error %v, want the one returned by fn", err)
+	}
+}
+
+func TestStreamAppLogsFollow(t *testing.T) {
+	defer func(d time.Duration) { appLogsPollInterval = d }(appLogsPollInterval)
+	appLogsPollInterval = 10 * time.Millisecond
+
+	now := time.Now().Truncate(time.Millisecond)
+	last := now.Add(2 * time.Second)
+	f := &fakeLogsClient{group: "staging"}
+	f.add("api/api/a", "1", now.Add(time.Second), "one")
+	f.add("api/api/a", "2", last, "two")
+	i := &Infrastructure{Logs: f}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var got []*AppLogEvent
+	err := i.StreamAppLogs(ctx, "staging", "api", now, "", true, func(e *AppLogEvent) error {
+		got = append(got, e)
+		switch e.Id {
+		case "2":
+			// logged after the first fetch, one of them sharing the last timestamp
+			f.add("api/api/b", "3", last, "three")
+			f.add("api/api/b", "4", last.Add(time.Second), "four")
+		case "4":
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := eventIds(got); !reflect.DeepEqual(ids, []string{"1", "2", "3", "4"}) {
+		t.Errorf("got events %v, want each of 1-4 once, in order", ids)
+	}
+
+	calls := f.calls()
+	if len(calls) < 2 {
+		t.Fatalf("made %d calls, want new events to be fetched", len(calls))
+	}
+	if got := aws.ToInt64(calls[1].StartTime); got != last.UnixMilli() {
+		t.Errorf("follow-up fetch starts at %d, want the last event's timestamp %d", got, last.UnixMilli())
+	}
+}
@@ -0,0 +1,65 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/terraform-exec/tfexec"
+	"strings"
+)
+
+// generatedTFFiles contains the names of all files that Cloudfauj generates
+// inside Terraform modules. These are overwritten whenever configuration is
+// regenerated, so Ops-supplied overlays cannot use them.
+var generatedTFFiles = map[string]bool{
+	tfCoreConfigFile:    true,
+	"network.tf":        true,
+	"iam.tf":            true,
+	"orchestrator.tf":   true,
+	"domain.tf":         true,
+	"load_balancer.tf":  true,
+	"app.tf":            true,
+	"app_lb.tf":         true,
+	"app_routes.tf":     true,
+	"app_iam.tf":        true,
+	"app_storage.tf":    true,
+	"database.tf":       true,
+	"volume.tf":         true,
+	"app_dns.tf":        true,
+	"dns_service.tf":    true,
+	dnsProviderTFFile:   true,
+	"cert_authority.tf": true,
+}
+
+// IsGeneratedTFFile returns true if the given file name is reserved for
+// configuration generated by Cloudfauj.
+func IsGeneratedTFFile(name string) bool {
+	return generatedTFFiles[name]
+}
+
+// ValidateTFConfig initializes a Terraform module and runs validate over it.
+// It returns an error describing all diagnostics if the configuration is invalid.
+func (i *Infrastructure) ValidateTFConfig(ctx context.Context, tf *tfexec.Terraform) error {
+	if err := tf.Init(ctx); err != nil {
+		return fmt.Errorf("failed to initialize terraform: %v", err)
+	}
+	res, err := tf.Validate(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to run terraform validate: %v", err)
+	}
+	if res.Valid {
+		return nil
+	}
+
+	var diags []string
+	for _, d := range res.Diagnostics {
+		msg := d.Summary
+		if d.Detail != "" {
+			msg += ": " + d.Detail
+		}
+		if d.Range != nil {
+			msg = fmt.Sprintf("%s:%d: %s", d.Range.Filename, d.Range.Start.Line, msg)
+		}
+		diags = append(diags, msg)
+	}
+	return fmt.Errorf("invalid terraform configuration\n%s", strings.Join(diags, "\n"))
+}
@@ -0,0 +1,388 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/gorilla/websocket"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// An ECS Exec session is an SSM session. Its data channel is a websocket carrying
+// binary messages in the format used by the AWS Session Manager plugin, which lets
+// the server relay sessions without the plugin being installed anywhere.
+
+const (
+	ssmClientVersion = "1.2.0.0"
+	ssmSchemaVersion = 1
+	// Length of a message header, excluding the payload length that follows it
+	ssmHeaderLength = 116
+	// Maximum size of the input sent in a single message
+	ssmMaxInputSize = 1024
+
+	ssmMsgInputStream   = "input_stream_data"
+	ssmMsgOutputStream  = "output_stream_data"
+	ssmMsgAcknowledge   = "acknowledge"
+	ssmMsgChannelClosed = "channel_closed"
+)
+
+// Time after which input that hasn't been acknowledged by the agent is sent again
+var ssmResendTimeout = time.Second
+
+// Types of message payloads
+const (
+	ssmPayloadOutput            uint32 = 1
+	ssmPayloadSize              uint32 = 3
+	ssmPayloadHandshakeRequest  uint32 = 5
+	ssmPayloadHandshakeResponse uint32 = 6
+	ssmPayloadHandshakeComplete uint32 = 7
+	ssmPayloadStdErr            uint32 = 11
+)
+
+// Status of a client action requested by the agent during handshake
+const (
+	ssmActionSuccess     = 1
+	ssmActionUnsupported = 3
+)
+
+type ssmMessage struct {
+	Type           string
+	SequenceNumber int64
+	Flags          uint64
+	// UUID of the message, stored as its least significant 8 bytes followed
+	// by its most significant 8 bytes.
+	MessageId   [16]byte
+	PayloadType uint32
+	Payload     []byte
+}
+
+func (m *ssmMessage) marshal() []byte {
+	b := make([]byte, ssmHeaderLength+4+len(m.Payload))
+
+	binary.BigEndian.PutUint32(b[0:], ssmHeaderLength)
+	copy(b[4:36], fmt.Sprintf("%-32s", m.Type))
+	binary.BigEndian.PutUint32(b[36:], ssmSchemaVersion)
+	binary.BigEndian.PutUint64(b[40:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	binary.BigEndian.PutUint64(b[48:], uint64(m.SequenceNumber))
+	binary.BigEndian.PutUint64(b[56:], m.Flags)
+	copy(b[64:80], m.MessageId[:])
+	digest := sha256.Sum256(m.Payload)
+	copy(b[80:112], digest[:])
+	binary.BigEndian.PutUint32(b[112:], m.PayloadType)
+	binary.BigEndian.PutUint32(b[ssmHeaderLength:], uint32(len(m.Payload)))
+	copy(b[ssmHeaderLength+4:], m.Payload)
+
+	return b
+}
+
+func unmarshalSSMMessage(b []byte) (*ssmMessage, error) {
+	if len(b) < ssmHeaderLength+4 {
+		return nil, errors.New("message is shorter than its header")
+	}
+	hl := binary.BigEndian.Uint32(b[0:])
+	if hl < ssmHeaderLength || uint64(len(b)) < uint64(hl)+4 {
+		return nil, fmt.Errorf("invalid message header length %d", hl)
+	}
+	l := binary.BigEndian.Uint32(b[hl:])
+	if uint64(len(b)) < uint64(hl)+4+uint64(l) {
+		return nil, fmt.Errorf("invalid message payload length %d", l)
+	}
+
+	m := &ssmMessage{
+		Type:           strings.TrimSpace(strings.TrimRight(string(b[4:36]), "\x00")),
+		SequenceNumber: int64(binary.BigEndian.Uint64(b[48:])),
+		Flags:          binary.BigEndian.Uint64(b[56:]),
+		PayloadType:    binary.BigEndian.Uint32(b[112:]),
+		Payload:        b[hl+4 : hl+4+l],
+	}
+	copy(m.MessageId[:], b[64:80])
+	return m, nil
+}
+
+// messageUUID returns the UUID of a message in its string form
+func (m *ssmMessage) messageUUID() string {
+	var u [16]byte
+	copy(u[:8], m.MessageId[8:])
+	copy(u[8:], m.MessageId[:8])
+	return formatUUID(u)
+}
+
+func newUUID() [16]byte {
+	var u [16]byte
+	_, _ = rand.Read(u[:])
+	// version 4, variant RFC 4122
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return u
+}
+
+func formatUUID(u [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// SSMSession is an open data channel of an ECS Exec session
+type SSMSession struct {
+	conn *websocket.Conn
+
+	// guards writes to the connection, the input sequence number & unacknowledged input
+	mu  sync.Mutex
+	seq int64
+	// input messages not yet acknowledged by the agent, by sequence number
+	unacked map[int64]*unackedInput
+	// set once the session is closed by the client
+	closed int32
+
+	cols, rows int
+}
+
+// OpenSSMSession connects to the data channel of a session started via ECSExecuteCommand
+func (i *Infrastructure) OpenSSMSession(ctx context.Context, s *types.Session) (*SSMSession, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, aws.ToString(s.StreamUrl), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session: %v", err)
+	}
+	open := map[string]string{
+		"MessageSchemaVersion": "1.0",
+		"RequestId":            formatUUID(newUUID()),
+		"TokenValue":           aws.ToString(s.TokenValue),
+		"ClientId":             formatUUID(newUUID()),
+		"ClientVersion":        ssmClientVersion,
+	}
+	if err := conn.WriteJSON(open); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open session data channel: %v", err)
+	}
+	return newSSMSession(conn), nil
+}
+
+func newSSMSession(conn *websocket.Conn) *SSMSession {
+	return &SSMSession{conn: conn, unacked: make(map[int64]*unackedInput)}
+}
+
+type unackedInput struct {
+	msg    *ssmMessage
+	sentAt time.Time
+}
+
+// SetTerminalSize sets the size of the session's terminal.
+// It is sent to the container once the session is established.
+func (s *SSMSession) SetTerminalSize(cols, rows int) {
+	s.cols, s.rows = cols, rows
+}
+
+// Write sends input to the command running in the session
+func (s *SSMSession) Write(p []byte) (int, error) {
+	for i := 0; i < len(p); i += ssmMaxInputSize {
+		end := i + ssmMaxInputSize
+		if end > len(p) {
+			end = len(p)
+		}
+		if err := s.sendInput(ssmPayloadOutput, p[i:end]); err != nil {
+			return i, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close disconnects from the session, which terminates it
+func (s *SSMSession) Close() error {
+	atomic.StoreInt32(&s.closed, 1)
+	return s.conn.Close()
+}
+
+// Run writes the output of the command running in the session to out
+// until the session ends. Meanwhile, input not acknowledged by the agent is
+// sent again periodically.
+func (s *SSMSession) Run(out io.Writer) error {
+	var expected int64
+	pending := make(map[int64]*ssmMessage)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.resendUnacked(ssmResendTimeout, stop)
+
+	for {
+		_, b, err := s.conn.ReadMessage()
+		if err != nil {
+			if atomic.LoadInt32(&s.closed) == 1 || websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return nil
+			}
+			return err
+		}
+		m, err := unmarshalSSMMessage(b)
+		if err != nil {
+			return fmt.Errorf("failed to parse session message: %v", err)
+		}
+
+		switch m.Type {
+		case ssmMsgOutputStream:
+			if err := s.acknowledge(m); err != nil {
+				return err
+			}
+			// The agent may resend messages, output must only be written once & in order
+			if m.SequenceNumber < expected {
+				continue
+			}
+			pending[m.SequenceNumber] = m
+			for next, ok := pending[expected]; ok; next, ok = pending[expected] {
+				delete(pending, expected)
+				expected++
+				if err := s.handleOutput(next, out); err != nil {
+					return err
+				}
+			}
+
+		case ssmMsgAcknowledge:
+			var ack struct{ AcknowledgedMessageSequenceNumber int64 }
+			if err := json.Unmarshal(m.Payload, &ack); err != nil {
+				return fmt.Errorf("failed to parse session acknowledgement: %v", err)
+			}
+			s.mu.Lock()
+			delete(s.unacked, ack.AcknowledgedMessageSequenceNumber)
+			s.mu.Unlock()
+
+		case ssmMsgChannelClosed:
+			var closed struct{ Output string }
+			_ = json.Unmarshal(m.Payload, &closed)
+			if closed.Output != "" {
+				_, _ = io.WriteString(out, closed.Output)
+			}
+			return nil
+		}
+	}
+}
+
+func (s *SSMSession) handleOutput(m *ssmMessage, out io.Writer) error {
+	switch m.PayloadType {
+	case ssmPayloadOutput, ssmPayloadStdErr:
+		_, err := out.Write(m.Payload)
+		return err
+
+	case ssmPayloadHandshakeRequest:
+		return s.handshake(m.Payload)
+
+	case ssmPayloadHandshakeComplete:
+		if s.cols > 0 && s.rows > 0 {
+			size, _ := json.Marshal(map[string]int{"cols": s.cols, "rows": s.rows})
+			return s.sendInput(ssmPayloadSize, size)
+		}
+	}
+	return nil
+}
+
+// handshake responds to the actions requested by the agent before the session
+// starts. Only plain sessions are supported, not those encrypted using KMS.
+func (s *SSMSession) handshake(payload []byte) error {
+	var req struct {
+		RequestedClientActions []struct {
+			ActionType string
+		}
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return fmt.Errorf("failed to parse session handshake: %v", err)
+	}
+
+	type processedAction struct {
+		ActionType   string
+		ActionStatus int
+		Error        string
+	}
+	res := struct {
+		ClientVersion          string
+		ProcessedClientActions []processedAction
+		Errors                 []string
+	}{ClientVersion: ssmClientVersion, Errors: []string{}}
+
+	for _, a := range req.RequestedClientActions {
+		p := processedAction{ActionType: a.ActionType, ActionStatus: ssmActionSuccess}
+		if a.ActionType != "SessionType" {
+			p.ActionStatus = ssmActionUnsupported
+			p.Error = "unsupported action " + a.ActionType
+			res.Errors = append(res.Errors, p.Error)
+		}
+		res.ProcessedClientActions = append(res.ProcessedClientActions, p)
+	}
+
+	b, _ := json.Marshal(res)
+	return s.sendInput(ssmPayloadHandshakeResponse, b)
+}
+
+func (s *SSMSession) acknowledge(m *ssmMessage) error {
+	ack, _ := json.Marshal(map[string]interface{}{
+		"AcknowledgedMessageType":           m.Type,
+		"AcknowledgedMessageId":             m.messageUUID(),
+		"AcknowledgedMessageSequenceNumber": m.SequenceNumber,
+		"IsSequentialMessage":               true,
+	})
+	return s.send(&ssmMessage{Type: ssmMsgAcknowledge, Flags: 3, MessageId: newUUID(), Payload: ack})
+}
+
+func (s *SSMSession) sendInput(payloadType uint32, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := &ssmMessage{
+		Type:           ssmMsgInputStream,
+		SequenceNumber: s.seq,
+		MessageId:      newUUID(),
+		PayloadType:    payloadType,
+		Payload:        payload,
+	}
+	// the first message of the stream is marked as its start
+	if s.seq == 0 {
+		m.Flags = 1
+	}
+	s.seq++
+	s.unacked[m.SequenceNumber] = &unackedInput{msg: m, sentAt: time.Now()}
+	return s.conn.WriteMessage(websocket.BinaryMessage, m.marshal())
+}
+
+// resendUnacked sends input again, oldest first, if the agent hasn't
+// acknowledged it within timeout, until stop is closed.
+func (s *SSMSession) resendUnacked(timeout time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(timeout / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+
+		s.mu.Lock()
+		var seqs []int64
+		for seq, u := range s.unacked {
+			if time.Since(u.sentAt) >= timeout {
+				seqs = append(seqs, seq)
+			}
+		}
+		sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+		for _, seq := range seqs {
+			u := s.unacked[seq]
+			u.sentAt = time.Now()
+			if err := s.conn.WriteMessage(websocket.BinaryMessage, u.msg.marshal()); err != nil {
+				// the connection is gone, Run reports it
+				s.mu.Unlock()
+				return
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *SSMSession) send(m *ssmMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.WriteMessage(websocket.BinaryMessage, m.marshal())
+}
@@ -0,0 +1,299 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/gorilla/websocket"
+)
+
+// fakeAgent is the agent's end of a session's data channel
+type fakeAgent struct {
+	t    *testing.T
+	conn *websocket.Conn
+	// the message opening the data channel
+	open map[string]string
+	// agent's output sequence number
+	seq int64
+}
+
+// openFakeSession connects a session to a fake agent
+func openFakeSession(t *testing.T) (*SSMSession, *fakeAgent) {
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade connection: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	s, err := (&Infrastructure{}).OpenSSMSession(context.Background(), &types.Session{
+		StreamUrl:  aws.String("ws" + strings.TrimPrefix(srv.URL, "http")),
+		TokenValue: aws.String("token"),
+	})
+	if err != nil {
+		t.Fatalf("failed to open session: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	a := &fakeAgent{t: t, conn: <-conns}
+	t.Cleanup(func() { a.conn.Close() })
+	if err := a.conn.ReadJSON(&a.open); err != nil {
+		t.Fatalf("failed to read open message: %v", err)
+	}
+	return s, a
+}
+
+// run runs the session in the background, its output is sent once it ends
+func run(s *SSMSession) (<-chan string, <-chan error) {
+	out, errs := make(chan string, 1), make(chan error, 1)
+	go func() {
+		var b bytes.Buffer
+		errs <- s.Run(&b)
+		out <- b.String()
+	}()
+	return out, errs
+}
+
+func (a *fakeAgent) send(m *ssmMessage) {
+	a.t.Helper()
+	if err := a.conn.WriteMessage(websocket.BinaryMessage, m.marshal()); err != nil {
+		a.t.Fatalf("agent failed to send message: %v", err)
+	}
+}
+
+// output sends output of the given payload type with the given sequence number
+func (a *fakeAgent) output(seq int64, payloadType uint32, payload string) {
+	a.t.Helper()
+	a.send(&ssmMessage{
+		Type:           ssmMsgOutputStream,
+		SequenceNumber: seq,
+		MessageId:      newUUID(),
+		PayloadType:    payloadType,
+		Payload:        []byte(payload),
+	})
+}
+
+func (a *fakeAgent) read() *ssmMessage {
+	a.t.Helper()
+	_ = a.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, b, err := a.conn.ReadMessage()
+	if err != nil {
+		a.t.Fatalf("agent failed to read message: %v", err)
+	}
+	m, err := unmarshalSSMMessage(b)
+	if err != nil {
+		a.t.Fatalf("agent received invalid message: %v", err)
+	}
+	return m
+}
+
+// expectAck reads the acknowledgement of the agent's output with the given sequence number
+func (a *fakeAgent) expectAck(seq int64) {
+	a.t.Helper()
+	m := a.read()
+	var ack struct {
+		AcknowledgedMessageType           string
+		AcknowledgedMessageSequenceNumber int64
+	}
+	_ = json.Unmarshal(m.Payload, &ack)
+	if m.Type != ssmMsgAcknowledge || ack.AcknowledgedMessageType != ssmMsgOutputStream ||
+		ack.AcknowledgedMessageSequenceNumber != seq {
+		a.t.Fatalf("got %s message %s, want acknowledgement of output %d", m.Type, m.Payload, seq)
+	}
+}
+
+// expectInput reads input from the client and acknowledges it
+func (a *fakeAgent) expectInput(seq int64, payloadType uint32) *ssmMessage {
+	a.t.Helper()
+	m := a.read()
+	if m.Type != ssmMsgInputStream || m.SequenceNumber != seq || m.PayloadType != payloadType {
+		a.t.Fatalf(
+			"got %s message %d of payload type %d, want input %d of payload type %d",
+			m.Type, m.SequenceNumber, m.PayloadType, seq, payloadType,
+		)
+	}
+	a.ack(m)
+	return m
+}
+
+func (a *fakeAgent) ack(m *ssmMessage) {
+	a.t.Helper()
+	ack, _ := json.Marshal(map[string]interface{}{
+		"AcknowledgedMessageType":           m.Type,
+		"AcknowledgedMessageId":             m.messageUUID(),
+		"AcknowledgedMessageSequenceNumber": m.SequenceNumber,
+		"IsSequentialMessage":               true,
+	})
+	a.send(&ssmMessage{Type: ssmMsgAcknowledge, MessageId: newUUID(), Payload: ack})
+}
+
+func (a *fakeAgent) closeChannel(output string) {
+	a.t.Helper()
+	payload, _ := json.Marshal(map[string]string{"Output": output})
+	a.send(&ssmMessage{Type: ssmMsgChannelClosed, MessageId: newUUID(), Payload: payload})
+}
+
+func TestSSMMessageRoundTrip(t *testing.T) {
+	cases := []*ssmMessage{
+		{
+			Type:           ssmMsgInputStream,
+			SequenceNumber: 42,
+			Flags:          1,
+			MessageId:      newUUID(),
+			PayloadType:    ssmPayloadSize,
+			Payload:        []byte(`{"cols":80,"rows":24}`),
+		},
+		{Type: ssmMsgAcknowledge, Flags: 3, MessageId: newUUID(), Payload: []byte{}},
+	}
+	for _, m := range cases {
+		t.Run(m.Type, func(t *testing.T) {
+			got, err := unmarshalSSMMessage(m.marshal())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, m) {
+				t.Errorf("got %+v, want %+v", got, m)
+			}
+		})
+	}
+}
+
+func TestUnmarshalSSMMessageInvalid(t *testing.T) {
+	valid := (&ssmMessage{Type: ssmMsgOutputStream, Payload: []byte("hello")}).marshal()
+
+	cases := map[string][]byte{
+		"empty":            {},
+		"truncated header": valid[:ssmHeaderLength],
+		"short header":     append([]byte{0, 0, 0, 4}, valid[4:]...),
+		"truncated data":   valid[:len(valid)-1],
+	}
+	for name, b := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := unmarshalSSMMessage(b); err == nil {
+				t.Error("invalid message was parsed")
+			}
+		})
+	}
+}
+
+func TestSSMSessionHandshake(t *testing.T) {
+	s, a := openFakeSession(t)
+	if a.open["TokenValue"] != "token" {
+		t.Errorf("data channel opened with token %q, want the session's token", a.open["TokenValue"])
+	}
+	s.SetTerminalSize(80, 24)
+	out, errs := run(s)
+
+	a.output(0, ssmPayloadHandshakeRequest, `{"RequestedClientActions":[{"ActionType":"SessionType"},{"ActionType":"KMSEncryption"}]}`)
+	a.expectAck(0)
+	res := a.expectInput(0, ssmPayloadHandshakeResponse)
+	if res.Flags != 1 {
+		t.Errorf("first input has flags %d, want it marked as the start of the stream", res.Flags)
+	}
+	var handshake struct {
+		ProcessedClientActions []struct {
+			ActionType   string
+			ActionStatus int
+		}
+	}
+	if err := json.Unmarshal(res.Payload, &handshake); err != nil {
+		t.Fatalf("invalid handshake response: %v", err)
+	}
+	statuses := map[string]int{}
+	for _, p := range handshake.ProcessedClientActions {
+		statuses[p.ActionType] = p.ActionStatus
+	}
+	if want := map[string]int{"SessionType": ssmActionSuccess, "KMSEncryption": ssmActionUnsupported}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("processed actions %v, want %v", statuses, want)
+	}
+
+	a.output(1, ssmPayloadHandshakeComplete, `{}`)
+	a.expectAck(1)
+	size := a.expectInput(1, ssmPayloadSize)
+	if string(size.Payload) != `{"cols":80,"rows":24}` {
+		t.Errorf("terminal size sent as %s", size.Payload)
+	}
+
+	a.closeChannel("bye")
+	if err := <-errs; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if o := <-out; o != "bye" {
+		t.Errorf("got output %q, want %q", o, "bye")
+	}
+}
+
+func TestSSMSessionOutputOrder(t *testing.T) {
+	s, a := openFakeSession(t)
+	out, errs := run(s)
+
+	// output arrives out of order & some of it more than once
+	seqs := []int64{1, 0, 0, 3, 1, 2, 3}
+	payloads := []string{"hello", " ", "world", "!"}
+	for _, seq := range seqs {
+		a.output(seq, ssmPayloadOutput, payloads[seq])
+		a.expectAck(seq)
+	}
+	a.closeChannel("")
+
+	if err := <-errs; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if o := <-out; o != "hello world!" {
+		t.Errorf("got output %q, want %q", o, "hello world!")
+	}
+}
+
+func TestSSMSessionResendsInput(t *testing.T) {
+	defer func(d time.Duration) { ssmResendTimeout = d }(ssmResendTimeout)
+	ssmResendTimeout = 20 * time.Millisecond
+
+	s, a := openFakeSession(t)
+	_, errs := run(s)
+
+	if _, err := s.Write([]byte("ls\n")); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+	first := a.read()
+	resent := a.read()
+	if resent.Type != ssmMsgInputStream || resent.SequenceNumber != first.SequenceNumber ||
+		resent.MessageId != first.MessageId || string(resent.Payload) != "ls\n" {
+		t.Fatalf("got %+v, want unacknowledged input %+v to be sent again", resent, first)
+	}
+	a.ack(resent)
+
+	// once acknowledged, only new input is sent
+	if _, err := s.Write([]byte("exit\n")); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+	for {
+		m := a.read()
+		if m.SequenceNumber == first.SequenceNumber {
+			// resent before the acknowledgement arrived
+			continue
+		}
+		if string(m.Payload) != "exit\n" || m.SequenceNumber != first.SequenceNumber+1 {
+			t.Fatalf("got input %d %q, want input %d %q", m.SequenceNumber, m.Payload, first.SequenceNumber+1, "exit\n")
+		}
+		a.ack(m)
+		break
+	}
+
+	a.closeChannel("")
+	if err := <-errs; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
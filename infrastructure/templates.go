@@ -33,7 +33,7 @@ const domainDnsTfConfigTpl = `resource "aws_route53_zone" "dns_manager" {
 // After that, ACM will be able to validate & issue the certificate.
 resource "aws_route53_record" "acm_cert_validation" {
   for_each = {
-    for dvo in aws_acm_certificate.primary_wildcard_cert.domain_validation_options : dvo.domain_name => {
+    for dvo in local.cert_validation_options : dvo.domain_name => {
       name   = dvo.resource_record_name
       record = dvo.resource_record_value
       type   = dvo.resource_record_type
@@ -57,6 +57,54 @@ output "name_servers" {
   value = aws_route53_zone.dns_manager.name_servers
 }`
 
+const cloudflareProviderTfTpl = `terraform {
+  required_providers {
+    cloudflare = {
+      source  = "cloudflare/cloudflare"
+      version = "{{.cloudflare_provider_version}}"
+    }
+  }
+}
+
+# API token is read from the CLOUDFLARE_API_TOKEN environment variable
+provider "cloudflare" {}`
+
+// The zone must already exist in Cloudflare, Cloudfauj only manages records in it.
+const domainCloudflareDnsTfConfigTpl = `data "cloudflare_zone" "dns_manager" {
+  name = "{{.domain_name}}"
+}
+
+// The apex & wildcard names of the certificate share the same validation
+// record, so duplicates are removed before creating them.
+resource "cloudflare_record" "acm_cert_validation" {
+  for_each = {
+    for r in distinct([
+      for dvo in local.cert_validation_options : {
+        name   = trimsuffix(dvo.resource_record_name, ".")
+        record = trimsuffix(dvo.resource_record_value, ".")
+        type   = dvo.resource_record_type
+      }
+    ]) : r.name => r
+  }
+
+  allow_overwrite = true
+
+  name    = each.value.name
+  value   = each.value.record
+  ttl     = 60
+  type    = each.value.type
+  proxied = false
+  zone_id = data.cloudflare_zone.dns_manager.id
+}
+
+output "zone_id" {
+  value = data.cloudflare_zone.dns_manager.id
+}
+
+output "name_servers" {
+  value = data.cloudflare_zone.dns_manager.name_servers
+}`
+
 const domainCertTfConfigTpl = `resource "aws_acm_certificate" "primary_wildcard_cert" {
   domain_name               = "{{.domain_name}}"
   subject_alternative_names = ["*.{{.domain_name}}"]
@@ -64,6 +112,10 @@ const domainCertTfConfigTpl = `resource "aws_acm_certificate" "primary_wildcard_
   tags                      = local.common_tags
 }
 
+locals {
+  cert_validation_options = aws_acm_certificate.primary_wildcard_cert.domain_validation_options
+}
+
 output "ssl_cert_arn" {
   value = aws_acm_certificate.primary_wildcard_cert.arn
 }
@@ -72,6 +124,43 @@ output "apex_domain" {
   value = "{{.domain_name}}"
 }`
 
+// Certificate obtained outside of Cloudfauj & imported into ACM from the PEM
+// files stored alongside the configuration. It is never renewed by ACM.
+const domainImportedCertTfConfigTpl = `resource "aws_acm_certificate" "primary_wildcard_cert" {
+  certificate_body  = file("${path.module}/{{.certificate_file}}")
+{{- if .certificate_chain_file}}
+  certificate_chain = file("${path.module}/{{.certificate_chain_file}}")
+{{- end}}
+  private_key       = file("${path.module}/{{.private_key_file}}")
+  tags              = local.common_tags
+}
+
+# Imported certificates are not validated via DNS
+locals {
+  cert_validation_options = []
+}
+
+output "ssl_cert_arn" {
+  value = aws_acm_certificate.primary_wildcard_cert.arn
+}
+
+output "apex_domain" {
+  value = "{{.domain_name}}"
+}`
+
+// Certificate already present in ACM that Cloudfauj only references
+const domainExistingCertTfConfigTpl = `locals {
+  cert_validation_options = []
+}
+
+output "ssl_cert_arn" {
+  value = "{{.certificate_arn}}"
+}
+
+output "apex_domain" {
+  value = "{{.domain_name}}"
+}`
+
 const envDomainStateTfTpl = `data "terraform_remote_state" "domain" {
   backend = "local"
   config = {
@@ -90,6 +179,15 @@ output "compute_ecs_cluster_arn" {
   value = aws_ecs_cluster.compute_cluster.arn
 }`
 
+const envImportedOrchestratorTfTpl = `# Existing ECS cluster that Cloudfauj only reads and never modifies
+data "aws_ecs_cluster" "compute_cluster" {
+  cluster_name = %s
+}
+
+output "compute_ecs_cluster_arn" {
+  value = data.aws_ecs_cluster.compute_cluster.arn
+}`
+
 const envNetworkTfTpl = `data "aws_availability_zones" "available" {}
 
 # VPC
@@ -116,11 +214,59 @@ resource "aws_default_route_table" "main_vpc_default_rt" {
 }
 
 # Subnets
+{{- if .private_compute}}
+resource "aws_subnet" "compute" {
+  count             = {{.compute_az_count}}
+  vpc_id            = aws_vpc.main_vpc.id
+  cidr_block        = cidrsubnet(aws_vpc.main_vpc.cidr_block, 4, count.index + 2)
+  availability_zone = data.aws_availability_zones.available.names[count.index]
+
+  tags = {
+    Name    = "{{.env_name}}-compute-${count.index}"
+    manager = local.common_tags.manager
+  }
+}
+
+# NAT gateways provide outbound internet access to the private compute subnets.
+# They're placed in the public ALB subnets.
+resource "aws_eip" "nat" {
+  count = {{.nat_gateway_count}}
+  vpc   = true
+  tags  = local.common_tags
+}
+
+resource "aws_nat_gateway" "compute" {
+  count         = {{.nat_gateway_count}}
+  allocation_id = aws_eip.nat[count.index].id
+  subnet_id     = aws_subnet.apps_alb[count.index].id
+  tags          = local.common_tags
+
+  depends_on = [aws_internet_gateway.main_vpc_igw]
+}
+
+resource "aws_route_table" "compute" {
+  count  = {{.compute_az_count}}
+  vpc_id = aws_vpc.main_vpc.id
+  tags   = local.common_tags
+
+  route {
+    cidr_block     = "0.0.0.0/0"
+    nat_gateway_id = aws_nat_gateway.compute[count.index % {{.nat_gateway_count}}].id
+  }
+}
+
+resource "aws_route_table_association" "compute" {
+  count          = {{.compute_az_count}}
+  subnet_id      = aws_subnet.compute[count.index].id
+  route_table_id = aws_route_table.compute[count.index].id
+}
+{{- else}}
 resource "aws_subnet" "compute" {
   vpc_id     = aws_vpc.main_vpc.id
   cidr_block = cidrsubnet(aws_vpc.main_vpc.cidr_block, 4, 1)
   tags       = local.common_tags
 }
+{{- end}}
 
 resource "aws_subnet" "apps_alb" {
   count             = 2
@@ -134,7 +280,43 @@ resource "aws_subnet" "apps_alb" {
   }
 }
 
-# ECS Task IAM role shared by all applications in the environment
+locals {
+  vpc_id      = aws_vpc.main_vpc.id
+  alb_subnets = aws_subnet.apps_alb.*.id
+}
+
+output "main_vpc_id" {
+  value = aws_vpc.main_vpc.id
+}
+
+output "compute_subnets" {
+  value = {{if .private_compute}}aws_subnet.compute.*.id{{else}}[aws_subnet.compute.id]{{end}}
+}`
+
+const envImportedNetworkTfTpl = `# Existing network infrastructure that Cloudfauj only reads and never modifies
+data "aws_vpc" "main_vpc" {
+  id = {{.vpc_id}}
+}
+
+data "aws_subnet" "compute" {
+  for_each = toset([{{range $i, $s := .subnet_ids}}{{if $i}}, {{end}}{{$s}}{{end}}])
+  id       = each.value
+}
+
+locals {
+  vpc_id      = data.aws_vpc.main_vpc.id
+  alb_subnets = [for s in data.aws_subnet.compute : s.id]
+}
+
+output "main_vpc_id" {
+  value = data.aws_vpc.main_vpc.id
+}
+
+output "compute_subnets" {
+  value = [for s in data.aws_subnet.compute : s.id]
+}`
+
+const envIamTfTpl = `# ECS Task IAM role shared by all applications in the environment
 resource "aws_iam_role" "ecs_task_exec_role" {
   name               = "{{.env_name}}-ecs-task-exec-role"
   assume_role_policy = data.aws_iam_policy_document.ecs_task_exec_role_assume_role.json
@@ -175,30 +357,35 @@ output "ecs_task_execution_role_arn" {
   value = aws_iam_role.ecs_task_exec_role.arn
 }
 
-output "main_vpc_id" {
-  value = aws_vpc.main_vpc.id
-}
-
-output "compute_subnets" {
-  value = [aws_subnet.compute.id]
+output "ecs_task_execution_role_name" {
+  value = aws_iam_role.ecs_task_exec_role.name
 }`
 
 const envAlbTfTpl = `resource "aws_security_group" "env_apps_alb" {
   name        = "{{.env_name}}-apps-alb"
   description = "{{.env_name}} applications ALB traffic control"
-  vpc_id      = aws_vpc.main_vpc.id
+  vpc_id      = local.vpc_id
 
   tags = {
     Name    = "{{.env_name}}-alb"
     manager = local.common_tags.manager
   }
 
+  ingress {
+    from_port   = 80
+    to_port     = 80
+    protocol    = "tcp"
+    cidr_blocks = ["0.0.0.0/0"]
+  }
+{{- if .domain_enabled}}
+
   ingress {
     from_port   = 443
     to_port     = 443
     protocol    = "tcp"
     cidr_blocks = ["0.0.0.0/0"]
   }
+{{- end}}
 
   egress {
     from_port   = 0
@@ -214,7 +401,24 @@ resource "aws_alb" "env_apps" {
   load_balancer_type = "application"
   security_groups    = [aws_security_group.env_apps_alb.id]
   tags               = local.common_tags
-  subnets            = aws_subnet.apps_alb.*.id
+  subnets            = local.alb_subnets
+}
+{{if .domain_enabled}}
+# Plain HTTP requests are redirected to HTTPS
+resource "aws_alb_listener" "env_apps_http" {
+  load_balancer_arn = aws_alb.env_apps.arn
+  port              = 80
+  protocol          = "HTTP"
+
+  default_action {
+    type = "redirect"
+
+    redirect {
+      port        = "443"
+      protocol    = "HTTPS"
+      status_code = "HTTP_301"
+    }
+  }
 }
 
 resource "aws_alb_listener" "env_apps_https" {
@@ -235,6 +439,32 @@ resource "aws_alb_listener" "env_apps_https" {
   }
 }
 
+output "main_alb_https_listener" {
+  value = aws_alb_listener.env_apps_https.arn
+}
+{{- else}}
+# Without a domain, apps are served over plain HTTP on the ALB's own DNS name
+resource "aws_alb_listener" "env_apps_http" {
+  load_balancer_arn = aws_alb.env_apps.arn
+  port              = 80
+  protocol          = "HTTP"
+
+  default_action {
+    type = "fixed-response"
+
+    fixed_response {
+      content_type = "text/plain"
+      message_body = "Service Unavailable"
+      status_code  = "503"
+    }
+  }
+}
+{{- end}}
+
+output "main_alb_http_listener" {
+  value = aws_alb_listener.env_apps_http.arn
+}
+
 output "apps_alb_arn" {
   value = aws_alb.env_apps.arn
 }
@@ -243,8 +473,50 @@ output "apps_alb_name" {
   value = aws_alb.env_apps.name
 }
 
+output "apps_alb_dns_name" {
+  value = aws_alb.env_apps.dns_name
+}`
+
+const envImportedAlbTfTpl = `# Existing load balancer that Cloudfauj only reads and never modifies
+data "aws_lb" "env_apps" {
+  name = {{.alb_name}}
+}
+{{if .domain_enabled}}
+data "aws_lb_listener" "env_apps_https" {
+  load_balancer_arn = data.aws_lb.env_apps.arn
+  port              = 443
+}
+
+# Serve the domain's certificate from the existing HTTPS listener
+resource "aws_lb_listener_certificate" "domain" {
+  listener_arn    = data.aws_lb_listener.env_apps_https.arn
+  certificate_arn = data.terraform_remote_state.domain.outputs.ssl_cert_arn
+}
+
 output "main_alb_https_listener" {
-  value = aws_alb_listener.env_apps_https.arn
+  value = data.aws_lb_listener.env_apps_https.arn
+}
+{{- else}}
+data "aws_lb_listener" "env_apps_http" {
+  load_balancer_arn = data.aws_lb.env_apps.arn
+  port              = 80
+}
+
+output "main_alb_http_listener" {
+  value = data.aws_lb_listener.env_apps_http.arn
+}
+{{- end}}
+
+output "apps_alb_arn" {
+  value = data.aws_lb.env_apps.arn
+}
+
+output "apps_alb_name" {
+  value = data.aws_lb.env_apps.name
+}
+
+output "apps_alb_dns_name" {
+  value = data.aws_lb.env_apps.dns_name
 }`
 
 const appTfTpl = `data "terraform_remote_state" "env" {
@@ -253,6 +525,24 @@ const appTfTpl = `data "terraform_remote_state" "env" {
     path = "{{.env_tfstate_file}}"
   }
 }
+{{- range .databases}}
+
+data "terraform_remote_state" "database_{{.Index}}" {
+  backend = "local"
+  config = {
+    path = "{{.StateFile}}"
+  }
+}
+{{- end}}
+{{- range .volumes}}
+
+data "terraform_remote_state" "volume_{{.Index}}" {
+  backend = "local"
+  config = {
+    path = "{{.StateFile}}"
+  }
+}
+{{- end}}
 
 # Variables that need to be supplied during invokation
 # Note that these have default empty values only to make TF destroy
@@ -262,6 +552,22 @@ variable "cpu" { default = 256 }
 variable "memory" { default = 512 }
 variable "ecr_image" { default = "" }
 variable "app_health_check_path" { default = "" }
+variable "app_protocol" { default = "HTTP" }
+variable "app_protocol_version" { default = "HTTP1" }
+variable "app_health_check_interval" { default = 30 }
+variable "app_health_check_timeout" { default = 5 }
+variable "app_health_check_healthy_threshold" { default = 5 }
+variable "app_health_check_unhealthy_threshold" { default = 2 }
+variable "app_health_check_matcher" { default = "200" }
+variable "app_health_check_grace_period" { default = 0 }
+variable "app_deregistration_delay" { default = 300 }
+variable "app_stickiness_enabled" { default = false }
+variable "app_stickiness_duration" { default = 86400 }
+variable "container_health_check_command" { default = "" }
+variable "container_health_check_interval" { default = 30 }
+variable "container_health_check_timeout" { default = 5 }
+variable "container_health_check_retries" { default = 3 }
+variable "container_health_check_start_period" { default = 0 }
 
 locals {
   name = "{{.env_name}}-{{.app_name}}"
@@ -292,14 +598,59 @@ resource "aws_security_group" "main_app_sg" {
   }
 }
 
+# IAM role assumed by the application's tasks
+resource "aws_iam_role" "main_app_task" {
+  name               = "${local.name}-task"
+  assume_role_policy = data.aws_iam_policy_document.main_app_task_assume_role.json
+  tags               = local.common_tags
+}
+
+data "aws_iam_policy_document" "main_app_task_assume_role" {
+  statement {
+    actions = ["sts:AssumeRole"]
+
+    principals {
+      type        = "Service"
+      identifiers = ["ecs-tasks.amazonaws.com"]
+    }
+  }
+}
+
+# Allows ECS Exec to open sessions into the application's containers
+resource "aws_iam_role_policy" "main_app_task_exec" {
+  name   = "${local.name}-ecs-exec"
+  role   = aws_iam_role.main_app_task.id
+  policy = data.aws_iam_policy_document.main_app_task_exec.json
+}
+
+data "aws_iam_policy_document" "main_app_task_exec" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "ssmmessages:CreateControlChannel",
+      "ssmmessages:CreateDataChannel",
+      "ssmmessages:OpenControlChannel",
+      "ssmmessages:OpenDataChannel",
+    ]
+    resources = ["*"]
+  }
+}
+
 # Task Definition
 resource "aws_ecs_task_definition" "main_app" {
   family                   = local.name
   requires_compatibilities = ["FARGATE"]
   network_mode             = "awsvpc"
   execution_role_arn       = data.terraform_remote_state.env.outputs.ecs_task_execution_role_arn
+  task_role_arn            = aws_iam_role.main_app_task.arn
   cpu                      = var.cpu
   memory                   = var.memory
+{{- if .ephemeral_storage}}
+
+  ephemeral_storage {
+    size_in_gib = {{.ephemeral_storage}}
+  }
+{{- end}}
 
   container_definitions = jsonencode([
     {
@@ -318,8 +669,112 @@ resource "aws_ecs_task_definition" "main_app" {
 
       essential    = true
       portMappings = [{ containerPort = tonumber(var.ingress_port) }]
-    }
+{{- if .volumes}}
+
+      mountPoints = [
+{{- range .volumes}}
+        {
+          sourceVolume  = "{{.Name}}"
+          containerPath = "{{.MountPath}}"
+          readOnly      = {{.ReadOnly}}
+        },
+{{- end}}
+      ]
+{{- end}}
+{{- if .storage_env}}
+
+      environment = [
+{{- range .storage_env}}
+        {
+          name  = "{{.Name}}"
+          value = {{.Value}}
+        },
+{{- end}}
+      ]
+{{- end}}
+{{- if .databases}}
+
+      secrets = [
+{{- range .databases}}
+        {
+          name      = "{{.EnvVar}}"
+          valueFrom = data.terraform_remote_state.database_{{.Index}}.outputs.secret_arn
+        },
+{{- end}}
+      ]
+{{- end}}
+{{- if .container_health_check}}
+
+      healthCheck = {
+        command     = ["CMD-SHELL", var.container_health_check_command]
+        interval    = tonumber(var.container_health_check_interval)
+        timeout     = tonumber(var.container_health_check_timeout)
+        retries     = tonumber(var.container_health_check_retries)
+        startPeriod = tonumber(var.container_health_check_start_period)
+      }
+{{- end}}
+    },
+{{- range .sidecars}}
+    {
+      name      = "{{.Name}}"
+      image     = {{.Image}}
+      essential = {{.Essential}}
+{{- if .Cpu}}
+      cpu       = {{.Cpu}}
+{{- end}}
+{{- if .Memory}}
+      memory    = {{.Memory}}
+{{- end}}
+
+      logConfiguration = {
+        logDriver = "awslogs"
+        options = {
+          "awslogs-create-group"  = "true"
+          "awslogs-region"        = data.aws_region.current.name
+          "awslogs-group"         = "{{$.env_name}}"
+          "awslogs-stream-prefix" = "{{$.app_name}}"
+        }
+      }
+{{- if .Env}}
+
+      environment = [
+{{- range .Env}}
+        {
+          name  = "{{.Name}}"
+          value = {{.Value}}
+        },
+{{- end}}
+      ]
+{{- end}}
+{{- if .DependsOn}}
+
+      dependsOn = [
+{{- range .DependsOn}}
+        {
+          containerName = "{{.Container}}"
+          condition     = "{{.Condition}}"
+        },
+{{- end}}
+      ]
+{{- end}}
+    },
+{{- end}}
   ])
+{{- range .volumes}}
+
+  volume {
+    name = "{{.Name}}"
+
+    efs_volume_configuration {
+      file_system_id     = data.terraform_remote_state.volume_{{.Index}}.outputs.file_system_id
+      transit_encryption = "ENABLED"
+
+      authorization_config {
+        access_point_id = data.terraform_remote_state.volume_{{.Index}}.outputs.access_point_id
+      }
+    }
+  }
+{{- end}}
 }
 
 # ECS Service
@@ -331,6 +786,8 @@ resource "aws_ecs_service" "main_app" {
   task_definition     = aws_ecs_task_definition.main_app.arn
   scheduling_strategy = "REPLICA"
 
+  enable_execute_command = true
+
   deployment_maximum_percent         = 200
   deployment_minimum_healthy_percent = 100
 
@@ -338,10 +795,14 @@ resource "aws_ecs_service" "main_app" {
     enable   = true
     rollback = true
   }
+{{- if .target_group_resource}}
+
+  health_check_grace_period_seconds = var.app_health_check_grace_period
+{{- end}}
 
   network_configuration {
     subnets          = data.terraform_remote_state.env.outputs.compute_subnets
-    assign_public_ip = true
+    assign_public_ip = {{.assign_public_ip}}
     security_groups  = [aws_security_group.main_app_sg.id]
   }
 
@@ -364,6 +825,73 @@ output "ecs_cluster_arn" {
   value = data.terraform_remote_state.env.outputs.compute_ecs_cluster_arn
 }`
 
+const appLbTfTpl = `data "aws_lb" "apps_alb" {
+  name = data.terraform_remote_state.env.outputs.apps_alb_name
+}
+
+resource "aws_alb_target_group" "alb_to_ecs_service" {
+  name                 = replace(local.name, "_", "-")
+  vpc_id               = data.terraform_remote_state.env.outputs.main_vpc_id
+  port                 = 80
+  protocol             = var.app_protocol
+  protocol_version     = var.app_protocol_version
+  target_type          = "ip"
+  deregistration_delay = var.app_deregistration_delay
+  tags                 = local.common_tags
+
+  health_check {
+    path                = var.app_health_check_path
+    protocol            = var.app_protocol
+    interval            = var.app_health_check_interval
+    timeout             = var.app_health_check_timeout
+    healthy_threshold   = var.app_health_check_healthy_threshold
+    unhealthy_threshold = var.app_health_check_unhealthy_threshold
+    matcher             = var.app_health_check_matcher
+  }
+
+  stickiness {
+    enabled         = var.app_stickiness_enabled
+    type            = "lb_cookie"
+    cookie_duration = var.app_stickiness_duration
+  }
+}
+
+resource "aws_lb_listener_rule" "app_router" {
+{{- if .domain_name}}
+  listener_arn = data.terraform_remote_state.env.outputs.main_alb_https_listener
+{{- else}}
+  listener_arn = data.terraform_remote_state.env.outputs.main_alb_http_listener
+{{- end}}
+
+  action {
+    type             = "forward"
+    target_group_arn = aws_alb_target_group.alb_to_ecs_service.arn
+  }
+  condition {
+{{- if .domain_name}}
+    host_header {
+      values = [local.app_url]
+    }
+{{- else}}
+    path_pattern {
+      values = ["/{{.app_name}}", "/{{.app_name}}/*"]
+    }
+{{- end}}
+  }
+}
+
+output "target_group_arn" {
+  value = aws_alb_target_group.alb_to_ecs_service.arn
+}
+
+output "app_url" {
+{{- if .domain_name}}
+  value = "https://${local.app_url}"
+{{- else}}
+  value = "http://${data.aws_lb.apps_alb.dns_name}/{{.app_name}}"
+{{- end}}
+}`
+
 const appDnsTfTpl = `data "terraform_remote_state" "domain" {
   backend = "local"
   config = {
@@ -373,43 +901,521 @@ const appDnsTfTpl = `data "terraform_remote_state" "domain" {
 
 locals {
   app_url = "${local.name}.{{.domain_name}}"
-}
-
-data "aws_lb" "apps_alb" {
-  name = data.terraform_remote_state.env.outputs.apps_alb_name
-}
+}`
 
-resource "aws_route53_record" "app_url" {
+const appRoute53RecordTfTpl = `resource "aws_route53_record" "app_url" {
   name    = local.app_url
   type    = "CNAME"
   zone_id = data.terraform_remote_state.domain.outputs.zone_id
   ttl     = 60
   records = [data.aws_lb.apps_alb.dns_name]
+}`
+
+const appCloudflareRecordTfTpl = `resource "cloudflare_record" "app_url" {
+  name    = local.app_url
+  type    = "CNAME"
+  zone_id = data.terraform_remote_state.domain.outputs.zone_id
+  ttl     = 60
+  value   = data.aws_lb.apps_alb.dns_name
+  proxied = false
+}`
+
+const appRoutesTfTpl = `# Custom routes of the application
+{{- range $i, $f := .domain_state_files}}
+
+data "terraform_remote_state" "route_domain_{{$i}}" {
+  backend = "local"
+  config = {
+    path = "{{$f}}"
+  }
 }
+{{- end}}
+{{- if .hostnames}}
 
-resource "aws_alb_target_group" "alb_to_ecs_service" {
-  name        = replace(local.name, "_", "-")
-  vpc_id      = data.terraform_remote_state.env.outputs.main_vpc_id
-  port        = 80
-  protocol    = "HTTP"
-  target_type = "ip"
-  tags        = local.common_tags
+locals {
+{{- if .route53_hostnames}}
+  hostname_zones = {
+{{- range .route53_hostnames}}
+    "{{.Name}}" = data.terraform_remote_state.route_domain_{{.DomainIndex}}.outputs.zone_id
+{{- end}}
+  }
+{{- end}}
+{{- if .cloudflare_hostnames}}
+  cloudflare_hostname_zones = {
+{{- range .cloudflare_hostnames}}
+    "{{.Name}}" = data.terraform_remote_state.route_domain_{{.DomainIndex}}.outputs.zone_id
+{{- end}}
+  }
+{{- end}}
+}
 
-  health_check {
-    path = var.app_health_check_path
+# TLS certificate covering all custom hostnames, served from the HTTPS listener
+resource "aws_acm_certificate" "custom_hostnames" {
+  domain_name               = "{{(index .hostnames 0).Name}}"
+  subject_alternative_names = [{{range $i, $h := .hostnames}}{{if $i}}{{if gt $i 1}}, {{end}}"{{$h.Name}}"{{end}}{{end}}]
+  validation_method         = "DNS"
+  tags                      = local.common_tags
+
+  lifecycle {
+    create_before_destroy = true
   }
 }
+{{- if .route53_hostnames}}
 
-resource "aws_lb_listener_rule" "app_router" {
-  listener_arn = data.terraform_remote_state.env.outputs.main_alb_https_listener
+resource "aws_route53_record" "custom_hostnames_validation" {
+  for_each = {
+    for dvo in aws_acm_certificate.custom_hostnames.domain_validation_options : dvo.domain_name => {
+      name   = dvo.resource_record_name
+      record = dvo.resource_record_value
+      type   = dvo.resource_record_type
+    } if contains(keys(local.hostname_zones), dvo.domain_name)
+  }
+
+  allow_overwrite = true
+  name            = each.value.name
+  records         = [each.value.record]
+  ttl             = 60
+  type            = each.value.type
+  zone_id         = local.hostname_zones[each.key]
+}
+
+# Alias records support apex domains, unlike CNAME
+resource "aws_route53_record" "custom_hostnames" {
+  for_each = local.hostname_zones
+
+  name    = each.key
+  type    = "A"
+  zone_id = each.value
+
+  alias {
+    name                   = data.aws_lb.apps_alb.dns_name
+    zone_id                = data.aws_lb.apps_alb.zone_id
+    evaluate_target_health = false
+  }
+}
+{{- end}}
+{{- if .cloudflare_hostnames}}
+
+resource "cloudflare_record" "custom_hostnames_validation" {
+  for_each = {
+    for dvo in aws_acm_certificate.custom_hostnames.domain_validation_options : dvo.domain_name => {
+      name   = trimsuffix(dvo.resource_record_name, ".")
+      record = trimsuffix(dvo.resource_record_value, ".")
+      type   = dvo.resource_record_type
+    } if contains(keys(local.cloudflare_hostname_zones), dvo.domain_name)
+  }
+
+  allow_overwrite = true
+  name            = each.value.name
+  value           = each.value.record
+  ttl             = 60
+  type            = each.value.type
+  proxied         = false
+  zone_id         = local.cloudflare_hostname_zones[each.key]
+}
+
+# Cloudflare flattens CNAME records at the zone apex
+resource "cloudflare_record" "custom_hostnames" {
+  for_each = local.cloudflare_hostname_zones
+
+  name    = each.key
+  type    = "CNAME"
+  ttl     = 60
+  value   = data.aws_lb.apps_alb.dns_name
+  proxied = false
+  zone_id = each.value
+}
+{{- end}}
+
+resource "aws_acm_certificate_validation" "custom_hostnames" {
+  certificate_arn = aws_acm_certificate.custom_hostnames.arn
+  validation_record_fqdns = concat(
+{{- if .route53_hostnames}}
+    [for r in aws_route53_record.custom_hostnames_validation : r.fqdn],
+{{- end}}
+{{- if .cloudflare_hostnames}}
+    [for r in cloudflare_record.custom_hostnames_validation : r.hostname],
+{{- end}}
+  )
+}
+
+resource "aws_lb_listener_certificate" "custom_hostnames" {
+  listener_arn    = data.terraform_remote_state.env.outputs.main_alb_https_listener
+  certificate_arn = aws_acm_certificate_validation.custom_hostnames.certificate_arn
+}
+{{- end}}
+{{- range $i, $r := .routes}}
+
+resource "aws_lb_listener_rule" "custom_route_{{$i}}" {
+  listener_arn = data.terraform_remote_state.env.outputs.{{$.listener_output}}
+{{- if $r.Priority}}
+  priority     = {{$r.Priority}}
+{{- end}}
 
   action {
     type             = "forward"
     target_group_arn = aws_alb_target_group.alb_to_ecs_service.arn
   }
+{{- if $r.Host}}
   condition {
     host_header {
-      values = [local.app_url]
+      values = ["{{$r.Host}}"]
+    }
+  }
+{{- end}}
+{{- if $r.Patterns}}
+  condition {
+    path_pattern {
+      values = [{{range $j, $p := $r.Patterns}}{{if $j}}, {{end}}"{{$p}}"{{end}}]
+    }
+  }
+{{- end}}
+}
+{{- end}}`
+
+const appIamTfTpl = `# Permissions granted to the application's tasks
+{{- if .statements}}
+
+resource "aws_iam_role_policy" "main_app_task_custom" {
+  name   = "${local.name}-custom"
+  role   = aws_iam_role.main_app_task.id
+  policy = data.aws_iam_policy_document.main_app_task_custom.json
+}
+
+data "aws_iam_policy_document" "main_app_task_custom" {
+{{- range .statements}}
+  statement {
+    effect    = "{{.Effect}}"
+    actions   = [{{range $j, $a := .Actions}}{{if $j}}, {{end}}{{$a}}{{end}}]
+    resources = [{{range $j, $r := .Resources}}{{if $j}}, {{end}}{{$r}}{{end}}]
+  }
+{{- end}}
+}
+{{- end}}
+{{- range $i, $p := .policies}}
+
+resource "aws_iam_role_policy_attachment" "main_app_task_managed_{{$i}}" {
+  role       = aws_iam_role.main_app_task.name
+  policy_arn = {{$p}}
+}
+{{- end}}`
+
+const databaseTfTpl = `terraform {
+  required_providers {
+    random = {
+      source  = "hashicorp/random"
+      version = "{{.random_provider_version}}"
     }
   }
+}
+
+data "terraform_remote_state" "env" {
+  backend = "local"
+  config = {
+    path = "{{.env_tfstate_file}}"
+  }
+}
+
+# Deleting the database's data must be requested explicitly, the instance is
+# protected from deletion otherwise.
+variable "delete_data" { default = false }
+
+locals {
+  name       = "{{.env_name}}-{{.app_name}}-{{.db_name}}"
+  identifier = replace(local.name, "_", "-")
+  vpc_id     = data.terraform_remote_state.env.outputs.main_vpc_id
+
+  # RDS requires subnets in at least 2 AZs, which public compute subnets
+  # don't span. All subnets of the VPC are used in that case.
+  compute_azs = distinct([for s in data.aws_subnet.compute : s.availability_zone])
+  subnet_ids  = length(local.compute_azs) > 1 ? data.terraform_remote_state.env.outputs.compute_subnets : tolist(data.aws_subnet_ids.vpc.ids)
+}
+
+data "aws_vpc" "main" {
+  id = local.vpc_id
+}
+
+data "aws_subnet" "compute" {
+  for_each = toset(data.terraform_remote_state.env.outputs.compute_subnets)
+  id       = each.value
+}
+
+data "aws_subnet_ids" "vpc" {
+  vpc_id = local.vpc_id
+}
+
+resource "aws_db_subnet_group" "main" {
+  name       = local.identifier
+  subnet_ids = local.subnet_ids
+  tags       = local.common_tags
+}
+
+# Only resources inside the environment's VPC can connect to the database
+resource "aws_security_group" "main" {
+  name        = local.name
+  description = "${local.name} database traffic control"
+  vpc_id      = local.vpc_id
+  tags        = local.common_tags
+
+  ingress {
+    from_port   = {{.port}}
+    to_port     = {{.port}}
+    protocol    = "tcp"
+    cidr_blocks = [data.aws_vpc.main.cidr_block]
+  }
+}
+
+resource "random_password" "main" {
+  length  = 32
+  special = false
+}
+
+resource "aws_db_instance" "main" {
+  identifier                = local.identifier
+  engine                    = "{{.engine}}"
+{{- if .engine_version}}
+  engine_version            = "{{.engine_version}}"
+{{- end}}
+  instance_class            = "{{.instance_class}}"
+  allocated_storage         = {{.storage}}
+  storage_encrypted         = true
+  name                      = "{{.db_name}}"
+  username                  = "cloudfauj"
+  password                  = random_password.main.result
+  port                      = {{.port}}
+  db_subnet_group_name      = aws_db_subnet_group.main.name
+  vpc_security_group_ids    = [aws_security_group.main.id]
+  publicly_accessible       = false
+  backup_retention_period   = 7
+  deletion_protection       = !var.delete_data
+  skip_final_snapshot       = var.delete_data
+  final_snapshot_identifier = "${local.identifier}-final"
+  tags                      = local.common_tags
+}
+
+# The connection URL is stored as a secret & supplied to the app's container by ECS
+resource "aws_secretsmanager_secret" "main" {
+  name                    = "${local.name}-url"
+  recovery_window_in_days = 0
+  tags                    = local.common_tags
+}
+
+resource "aws_secretsmanager_secret_version" "main" {
+  secret_id     = aws_secretsmanager_secret.main.id
+  secret_string = "{{.engine}}://${aws_db_instance.main.username}:${random_password.main.result}@${aws_db_instance.main.endpoint}/${aws_db_instance.main.name}"
+}
+
+# ECS pulls the secret using the environment's task execution role.
+# The state of envs not applied since the role's name was output doesn't contain it.
+resource "aws_iam_role_policy" "main_secret" {
+  name   = "${local.name}-url"
+  role   = try(data.terraform_remote_state.env.outputs.ecs_task_execution_role_name, "{{.env_name}}-ecs-task-exec-role")
+  policy = data.aws_iam_policy_document.main_secret.json
+}
+
+data "aws_iam_policy_document" "main_secret" {
+  statement {
+    effect    = "Allow"
+    actions   = ["secretsmanager:GetSecretValue"]
+    resources = [aws_secretsmanager_secret.main.arn]
+  }
+}
+
+output "secret_arn" {
+  value = aws_secretsmanager_secret.main.arn
+}
+
+output "endpoint" {
+  value = aws_db_instance.main.endpoint
+}`
+
+const appStorageTfTpl = `# Buckets & queues of the application, accessible to its tasks via the task role.
+# Buckets are modules of their own, so they're retained when the app is destroyed.
+{{- range .buckets}}
+
+data "terraform_remote_state" "bucket_{{.Name}}" {
+  backend = "local"
+  config = {
+    path = "{{.StateFile}}"
+  }
+}
+{{- end}}
+{{- range .queues}}
+
+resource "aws_sqs_queue" "queue_{{.Name}}" {
+  name                       = "${local.name}-{{.Name}}{{if .Fifo}}.fifo{{end}}"
+  fifo_queue                 = {{.Fifo}}
+  visibility_timeout_seconds = {{.VisibilityTimeout}}
+  tags                       = local.common_tags
+}
+{{- end}}
+
+resource "aws_iam_role_policy" "main_app_task_storage" {
+  name   = "${local.name}-storage"
+  role   = aws_iam_role.main_app_task.id
+  policy = data.aws_iam_policy_document.main_app_task_storage.json
+}
+
+data "aws_iam_policy_document" "main_app_task_storage" {
+{{- if .buckets}}
+  statement {
+    effect    = "Allow"
+    actions   = ["s3:ListBucket", "s3:GetBucketLocation"]
+    resources = [{{range $i, $b := .buckets}}{{if $i}}, {{end}}data.terraform_remote_state.bucket_{{$b.Name}}.outputs.arn{{end}}]
+  }
+
+  statement {
+    effect    = "Allow"
+    actions   = ["s3:GetObject", "s3:PutObject", "s3:DeleteObject"]
+    resources = [{{range $i, $b := .buckets}}{{if $i}}, {{end}}"${data.terraform_remote_state.bucket_{{$b.Name}}.outputs.arn}/*"{{end}}]
+  }
+{{- end}}
+{{- if .queues}}
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "sqs:SendMessage",
+      "sqs:ReceiveMessage",
+      "sqs:DeleteMessage",
+      "sqs:ChangeMessageVisibility",
+      "sqs:GetQueueAttributes",
+      "sqs:GetQueueUrl",
+    ]
+    resources = [{{range $i, $q := .queues}}{{if $i}}, {{end}}aws_sqs_queue.queue_{{$q.Name}}.arn{{end}}]
+  }
+{{- end}}
+}
+
+output "buckets" {
+  value = {
+{{- range .buckets}}
+    "{{.Name}}" = data.terraform_remote_state.bucket_{{.Name}}.outputs.name
+{{- end}}
+  }
+}
+
+output "queues" {
+  value = {
+{{- range .queues}}
+    "{{.Name}}" = aws_sqs_queue.queue_{{.Name}}.url
+{{- end}}
+  }
+}`
+
+const volumeTfTpl = `data "terraform_remote_state" "env" {
+  backend = "local"
+  config = {
+    path = "{{.env_tfstate_file}}"
+  }
+}
+
+locals {
+  name   = "{{.env_name}}-{{.app_name}}-{{.volume_name}}"
+  vpc_id = data.terraform_remote_state.env.outputs.main_vpc_id
+
+  # A file system can only have a single mount target per AZ
+  compute_subnets_by_az = { for s in data.aws_subnet.compute : s.availability_zone => s.id... }
+}
+
+data "aws_vpc" "main" {
+  id = local.vpc_id
+}
+
+data "aws_subnet" "compute" {
+  for_each = toset(data.terraform_remote_state.env.outputs.compute_subnets)
+  id       = each.value
+}
+
+resource "aws_efs_file_system" "main" {
+  creation_token = local.name
+  encrypted      = true
+
+  tags = {
+    Name    = local.name
+    manager = local.common_tags.manager
+  }
+}
+
+# Only resources inside the environment's VPC can mount the file system
+resource "aws_security_group" "main" {
+  name        = local.name
+  description = "${local.name} volume traffic control"
+  vpc_id      = local.vpc_id
+  tags        = local.common_tags
+
+  ingress {
+    from_port   = 2049
+    to_port     = 2049
+    protocol    = "tcp"
+    cidr_blocks = [data.aws_vpc.main.cidr_block]
+  }
+}
+
+resource "aws_efs_mount_target" "main" {
+  for_each        = { for az, subnets in local.compute_subnets_by_az : az => subnets[0] }
+  file_system_id  = aws_efs_file_system.main.id
+  subnet_id       = each.value
+  security_groups = [aws_security_group.main.id]
+}
+
+resource "aws_efs_access_point" "main" {
+  file_system_id = aws_efs_file_system.main.id
+  tags           = local.common_tags
+
+  posix_user {
+    uid = {{.uid}}
+    gid = {{.gid}}
+  }
+
+  root_directory {
+    path = "/data"
+
+    creation_info {
+      owner_uid   = {{.uid}}
+      owner_gid   = {{.gid}}
+      permissions = "755"
+    }
+  }
+}
+
+output "file_system_id" {
+  value = aws_efs_file_system.main.id
+}
+
+output "access_point_id" {
+  value = aws_efs_access_point.main.id
+}`
+
+const bucketTfTpl = `locals {
+  name = "{{.env_name}}-{{.app_name}}-{{.bucket_name}}"
+}
+
+resource "aws_s3_bucket" "main" {
+  # bucket names are global, a unique suffix is added to the prefix
+  bucket_prefix = substr(lower(replace("${local.name}-", "_", "-")), 0, 37)
+  acl           = "private"
+  # Cloudfauj only destroys buckets when explicitly asked to delete the app's data
+  force_destroy = true
+  tags          = local.common_tags
+
+  versioning {
+    enabled = {{.versioning}}
+  }
+}
+
+resource "aws_s3_bucket_public_access_block" "main" {
+  bucket                  = aws_s3_bucket.main.id
+  block_public_acls       = true
+  block_public_policy     = true
+  ignore_public_acls      = true
+  restrict_public_buckets = true
+}
+
+output "name" {
+  value = aws_s3_bucket.main.bucket
+}
+
+output "arn" {
+  value = aws_s3_bucket.main.arn
 }`
@@ -1,14 +1,23 @@
 package infrastructure
 
 import (
+	"context"
 	"fmt"
 	"github.com/hashicorp/terraform-exec/tfexec"
 	"io"
+	"os"
+	"path"
+	"strconv"
 	"strings"
 	"text/template"
 )
 
-const terraformAwsProviderVersion = "3.55.0"
+// DefaultAWSProviderVersion is the version of Terraform AWS provider
+// used when the server configuration doesn't specify one.
+const DefaultAWSProviderVersion = "3.55.0"
+
+// Name of the file containing the core configuration of every Terraform module
+const tfCoreConfigFile = "terraform.tf"
 
 func (i *Infrastructure) NewTerraform(workDir string, out io.Writer) (*tfexec.Terraform, error) {
 	tf, err := tfexec.NewTerraform(workDir, i.TFBinary)
@@ -17,7 +26,9 @@ func (i *Infrastructure) NewTerraform(workDir string, out io.Writer) (*tfexec.Te
 	}
 
 	// Pass the server process' environment variables to Terraform process
-	tf.SetEnv(nil)
+	if err := tf.SetEnv(i.tfEnv()); err != nil {
+		return nil, fmt.Errorf("failed to set terraform environment: %v", err)
+	}
 	tf.SetLogger(i.Log)
 
 	// Allow caller to supply a Writer to stream TF output to.
@@ -31,13 +42,77 @@ func (i *Infrastructure) NewTerraform(workDir string, out io.Writer) (*tfexec.Te
 	return tf, nil
 }
 
+// tfEnv returns the server process' environment variables along with the
+// credentials of DNS services, to be passed to the Terraform process.
+// It returns nil if no credentials are configured, in which case
+// Terraform inherits the server's environment as-is.
+func (i *Infrastructure) tfEnv() map[string]string {
+	if i.CloudflareAPIToken == "" {
+		return nil
+	}
+	res := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if p := strings.SplitN(kv, "=", 2); len(p) == 2 {
+			res[p[0]] = p[1]
+		}
+	}
+	// terraform-exec manages some variables itself & refuses them from callers
+	for _, k := range tfexec.ProhibitedEnv(res) {
+		delete(res, k)
+	}
+	res[cloudflareAPITokenEnvVar] = i.CloudflareAPIToken
+	return res
+}
+
 func (i *Infrastructure) tfCoreConfig() string {
 	var b strings.Builder
 	t := template.Must(template.New("").Parse(tfCoreConfigTpl))
 	data := map[string]interface{}{
 		"aws_region":           i.Region,
-		"aws_provider_version": terraformAwsProviderVersion,
+		"aws_provider_version": i.AWSProviderVersion,
 	}
 	t.Execute(&b, data)
 	return b.String()
 }
+
+// UpgradeTFModule rewrites the core configuration of a Terraform module
+// using the current provider version, upgrades the module's providers and
+// plans it to report the impact of the upgrade.
+// It returns the plan in human-readable form, or an empty string if it doesn't
+// contain any changes to the infrastructure.
+func (i *Infrastructure) UpgradeTFModule(ctx context.Context, tf *tfexec.Terraform) (string, error) {
+	f := path.Join(tf.WorkingDir(), tfCoreConfigFile)
+	if err := os.WriteFile(f, []byte(i.tfCoreConfig()), 0666); err != nil {
+		return "", fmt.Errorf("failed to rewrite core config: %v", err)
+	}
+	if err := tf.Init(ctx, tfexec.Upgrade(true)); err != nil {
+		return "", fmt.Errorf("failed to upgrade terraform: %v", err)
+	}
+
+	planFile, err := os.CreateTemp("", "upgrade-*.tfplan")
+	if err != nil {
+		return "", fmt.Errorf("failed to create plan file: %v", err)
+	}
+	planFile.Close()
+	defer os.Remove(planFile.Name())
+
+	changed, err := tf.Plan(ctx, tfexec.Out(planFile.Name()))
+	if err != nil {
+		return "", fmt.Errorf("failed to plan: %v", err)
+	}
+	if !changed {
+		return "", nil
+	}
+	plan, err := tf.ShowPlanFileRaw(ctx, planFile.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to show plan: %v", err)
+	}
+	return plan, nil
+}
+
+// hclString returns the given value as a quoted HCL string literal
+func hclString(v string) string {
+	// escape template sequences so that the value is used as-is
+	v = strings.NewReplacer("${", "$${", "%{", "%%{").Replace(v)
+	return strconv.Quote(v)
+}
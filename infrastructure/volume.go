@@ -0,0 +1,71 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/application"
+	"github.com/hashicorp/terraform-exec/tfexec"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// A set of Objects supplied to the VolumeTFConfig method
+type VolumeTFConfigInput struct {
+	Volume *application.Volume
+
+	// Name of the application the volume belongs to
+	App string
+
+	// Name of the environment the application runs in
+	Env string
+
+	// The exact path on the system of the file containing the environment's
+	// TF state.
+	EnvTFStateFile string
+}
+
+// VolumeTFConfig returns the TF configuration of an EFS volume provisioned for
+// an application. Like databases, every volume is a module of its own so that
+// destroying the app doesn't destroy its data.
+func (i *Infrastructure) VolumeTFConfig(in *VolumeTFConfigInput) map[string]string {
+	var b strings.Builder
+
+	t := template.Must(template.New("").Parse(volumeTfTpl))
+	data := map[string]interface{}{
+		"env_tfstate_file": in.EnvTFStateFile,
+		"env_name":         in.Env,
+		"app_name":         in.App,
+		"volume_name":      in.Volume.Name,
+		"uid":              strconv.Itoa(in.Volume.Uid),
+		"gid":              strconv.Itoa(in.Volume.Gid),
+	}
+	t.Execute(&b, data)
+
+	return map[string]string{
+		tfCoreConfigFile: i.tfCoreConfig(),
+		"volume.tf":      b.String(),
+	}
+}
+
+// ApplyVolume creates or modifies the infrastructure of a volume
+func (i *Infrastructure) ApplyVolume(ctx context.Context, tf *tfexec.Terraform) error {
+	if err := tf.Init(ctx); err != nil {
+		return fmt.Errorf("failed to initialize terraform: %v", err)
+	}
+	if err := tf.Apply(ctx); err != nil {
+		return fmt.Errorf("failed to apply terraform changes: %v", err)
+	}
+	return nil
+}
+
+// DestroyVolume deletes a volume along with all its data
+func (i *Infrastructure) DestroyVolume(ctx context.Context, tf *tfexec.Terraform) error {
+	if err := tf.Init(ctx); err != nil {
+		return fmt.Errorf("failed to initialize terraform: %v", err)
+	}
+	if err := tf.Destroy(ctx); err != nil {
+		return fmt.Errorf("failed to destroy volume: %v", err)
+	}
+	return nil
+}
@@ -2,10 +2,12 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/cloudfauj/cloudfauj/application"
 	"github.com/cloudfauj/cloudfauj/deployment"
 	"github.com/cloudfauj/cloudfauj/environment"
 	"github.com/cloudfauj/cloudfauj/infrastructure"
@@ -62,6 +64,23 @@ func (s *server) handlerDeployApp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	msg, err := s.checkAppCompatible(r.Context(), e, spec.App)
+	if err != nil {
+		s.log.WithField("name", spec.App.Name).Errorf("Failed to check app compatibility: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if msg != "" {
+		conn.SendFailure(msg, websocket.ClosePolicyViolation)
+		return
+	}
+	sizeMsg, err := taskSizeMsg(spec.App)
+	if err != nil {
+		conn.SendFailure(fmt.Sprintf("Invalid specification: invalid resources: %v", err), websocket.ClosePolicyViolation)
+		return
+	}
+	conn.SendTextMsg(sizeMsg)
+
 	// create app dir inside env dir if it doesn't already exist
 	dir := s.appTfDir(spec.TargetEnv, spec.App.Name)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -91,7 +110,7 @@ func (s *server) handlerDeployApp(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// app already exists, run new deployment
-	s.deployApp(r.Context(), conn, &spec, tf)
+	s.deployApp(r.Context(), conn, &spec, e, tf, dir)
 }
 
 func (s *server) createNewApp(
@@ -106,27 +125,71 @@ func (s *server) createNewApp(
 		logrus.Fields{"name": spec.App.Name, "env": spec.TargetEnv},
 	).Info("Creating new application")
 
+	// the app's directory must not outlive a failure to register it in state,
+	// since nothing refers to it afterwards
+	registered := false
+	defer func() {
+		if registered {
+			return
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			s.log.Errorf("Failed to remove directory of unregistered app: %v", err)
+		}
+	}()
+
+	tfConfigs, err := s.appTFConfig(ctx, spec, env)
+	if err != nil {
+		s.log.Errorf("Failed to generate terraform configurations for app: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	overlays, err := s.appOverlays(env.Name)
+	if err != nil {
+		s.log.Errorf("Failed to read app overlays of env: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	for name, content := range overlays {
+		tfConfigs[name] = content
+	}
+	if err := s.writeFiles(dir, tfConfigs); err != nil {
+		s.log.Errorf("Failed to write terraform configs for app: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+
+	// app overlays added before the app existed have never been validated against it
+	if len(overlays) > 0 {
+		conn.SendTextMsg("Validating app overlays of the environment")
+		if err := s.infra.ValidateTFConfig(ctx, tf); err != nil {
+			conn.SendFailure(
+				fmt.Sprintf("App overlays of the environment are invalid for this app: %v", err),
+				websocket.ClosePolicyViolation,
+			)
+			return
+		}
+	}
+
 	conn.SendTextMsg("Registering application in state")
 	if err := s.state.CreateApp(ctx, spec.App, spec.TargetEnv); err != nil {
 		s.log.Errorf("Failed to create app in state: %v", err)
 		conn.SendFailureISE()
 		return
 	}
+	registered = true
 
-	i := &infrastructure.AppTFConfigInput{
-		Spec:              spec,
-		Env:               env,
-		DomainTFStateFile: s.domainTFStateFile(env.Domain),
-		EnvTFStateFile:    s.envTfStateFile(env.Name),
+	if err := s.applyAppDatabases(ctx, conn, spec); err != nil {
+		s.log.Errorf("Failed to provision app databases: %v", err)
+		conn.SendFailureISE()
+		return
 	}
-	tfConfigs, err := s.infra.AppTFConfig(i)
-	if err != nil {
-		s.log.Errorf("Failed to generate terraform configurations for app: %v", err)
+	if err := s.applyAppVolumes(ctx, conn, spec); err != nil {
+		s.log.Errorf("Failed to provision app volumes: %v", err)
 		conn.SendFailureISE()
 		return
 	}
-	if err := s.writeFiles(dir, tfConfigs); err != nil {
-		s.log.Errorf("Failed to write terraform configs for app: %v", err)
+	if err := s.applyAppBuckets(ctx, conn, spec); err != nil {
+		s.log.Errorf("Failed to provision app buckets: %v", err)
 		conn.SendFailureISE()
 		return
 	}
@@ -154,6 +217,12 @@ func (s *server) createNewApp(
 		conn.SendTextMsg(e.Msg)
 	}
 
+	if err := s.state.UpdateAppArtifact(ctx, spec.App.Name, spec.TargetEnv, spec.Artifact); err != nil {
+		s.log.Errorf("Failed to update app artifact in state: %v", err)
+	}
+	if url, _ := s.infra.AppURL(ctx, tf); url != "" {
+		conn.SendTextMsg("App is reachable at " + url)
+	}
 	conn.SendSuccess("App deployed successfully")
 	return
 }
@@ -162,7 +231,9 @@ func (s *server) deployApp(
 	ctx context.Context,
 	conn *wsmanager.WSManager,
 	spec *deployment.Spec,
+	env *environment.Environment,
 	tf *tfexec.Terraform,
+	dir string,
 ) {
 	depLogger := logrus.New()
 	d := deployment.New(spec, depLogger)
@@ -203,6 +274,30 @@ func (s *server) deployApp(
 		conn.SendFailureISE()
 		return
 	}
+	if err := s.applyAppDatabases(ctx, conn, spec); err != nil {
+		s.log.Errorf("Failed to provision app databases: %v", err)
+		d.Fail(errors.New("a server error occurred while provisioning app databases"))
+		conn.SendFailureISE()
+		return
+	}
+	if err := s.applyAppVolumes(ctx, conn, spec); err != nil {
+		s.log.Errorf("Failed to provision app volumes: %v", err)
+		d.Fail(errors.New("a server error occurred while provisioning app volumes"))
+		conn.SendFailureISE()
+		return
+	}
+	if err := s.applyAppBuckets(ctx, conn, spec); err != nil {
+		s.log.Errorf("Failed to provision app buckets: %v", err)
+		d.Fail(errors.New("a server error occurred while provisioning app buckets"))
+		conn.SendFailureISE()
+		return
+	}
+	if err := s.regenerateAppTFConfig(ctx, spec, env, dir); err != nil {
+		s.log.Errorf("Failed to regenerate terraform configs for app: %v", err)
+		d.Fail(errors.New("a server error occurred while generating app configuration"))
+		conn.SendFailureISE()
+		return
+	}
 	if err := s.infra.ModifyApplication(ctx, spec, tf); err != nil {
 		s.log.Errorf("Failed to modify application infrastructure: %v", err)
 		conn.SendFailureISE()
@@ -230,12 +325,106 @@ func (s *server) deployApp(
 
 	d.Succeed()
 	s.state.UpdateDeploymentStatus(ctx, d.Id, d.Status)
+	if err := s.state.UpdateAppArtifact(ctx, spec.App.Name, spec.TargetEnv, spec.Artifact); err != nil {
+		s.log.Errorf("Failed to update app artifact in state: %v", err)
+	}
+	if url, _ := s.infra.AppURL(ctx, tf); url != "" {
+		conn.SendTextMsg("App is reachable at " + url)
+	}
 	conn.SendSuccess("Deployed successfully")
 }
 
+// AppInfo describes an application deployed in an environment
+type AppInfo struct {
+	*application.Application
+	Environment string `json:"environment"`
+	// Artifact last deployed successfully
+	Artifact       string                 `json:"artifact"`
+	LastDeployment *deployment.Deployment `json:"last_deployment,omitempty"`
+	URL            string                 `json:"url,omitempty"`
+	// Names of the app's S3 buckets & URLs of its SQS queues, keyed by
+	// their names in the app's config.
+	Buckets map[string]string `json:"buckets,omitempty"`
+	Queues  map[string]string `json:"queues,omitempty"`
+}
+
+func (s *server) handlerGetApp(w http.ResponseWriter, r *http.Request) {
+	app := mux.Vars(r)["name"]
+	env := r.URL.Query().Get("env")
+	l := s.log.WithFields(logrus.Fields{"app": app, "env": env})
+
+	res, err := s.appInfo(r.Context(), app, env)
+	if err != nil {
+		l.Errorf("Failed to fetch app info: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if res == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonRes, _ := json.Marshal(res)
+	_, _ = w.Write(jsonRes)
+}
+
+// appInfo returns the details of an application in an environment.
+// It returns nil if the app doesn't exist in the env.
+func (s *server) appInfo(ctx context.Context, name, env string) (*AppInfo, error) {
+	app, err := s.state.App(ctx, name, env)
+	if err != nil || app == nil {
+		return nil, err
+	}
+	res := &AppInfo{Application: app, Environment: env}
+
+	if res.Artifact, err = s.state.AppArtifact(ctx, name, env); err != nil {
+		return nil, err
+	}
+	if res.LastDeployment, err = s.state.LatestAppDeployment(ctx, name, env); err != nil {
+		return nil, err
+	}
+
+	// The URL is only known once the app's infrastructure has been applied.
+	// The rest of the information is still useful, so failing to read it is only logged.
+	if res.Artifact != "" {
+		if err := s.appOutputs(ctx, res); err != nil {
+			s.log.WithFields(logrus.Fields{"app": name, "env": env}).Errorf("Failed to read app outputs: %v", err)
+		}
+	}
+	return res, nil
+}
+
+// appOutputs populates the information about an application only known from
+// its Terraform state, such as its URL.
+func (s *server) appOutputs(ctx context.Context, info *AppInfo) error {
+	tf, err := s.infra.NewTerraform(s.appTfDir(info.Environment, info.Name), nil)
+	if err != nil {
+		return err
+	}
+	if info.URL, err = s.infra.AppURL(ctx, tf); err != nil {
+		return err
+	}
+	if info.Buckets, err = s.infra.AppBuckets(ctx, tf); err != nil {
+		return err
+	}
+	info.Queues, err = s.infra.AppQueues(ctx, tf)
+	return err
+}
+
+// AppDestroyResult describes what remains of an application after destroying it
+type AppDestroyResult struct {
+	// Databases, volumes & buckets of the app retained along with their data
+	RetainedDatabases []string `json:"retained_databases,omitempty"`
+	RetainedVolumes   []string `json:"retained_volumes,omitempty"`
+	RetainedBuckets   []string `json:"retained_buckets,omitempty"`
+}
+
 func (s *server) handlerDestroyApp(w http.ResponseWriter, r *http.Request) {
 	app := mux.Vars(r)["name"]
 	env := r.URL.Query().Get("env")
+	// databases are only destroyed along with their data if explicitly requested
+	deleteData := r.URL.Query().Get("delete_data") == "true"
 
 	s.log.WithFields(
 		logrus.Fields{"app": app, "env": env},
@@ -262,7 +451,6 @@ func (s *server) handlerDestroyApp(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-
 	appDir := s.appTfDir(env, app)
 
 	// TODO: Use websocket in this controller and supply connection object below
@@ -282,6 +470,42 @@ func (s *server) handlerDestroyApp(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+
+	var res AppDestroyResult
+	if deleteData {
+		if err := s.destroyAppDatabases(r.Context(), env, app); err != nil {
+			s.log.Errorf("Failed to destroy app databases: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := s.destroyAppVolumes(r.Context(), env, app); err != nil {
+			s.log.Errorf("Failed to destroy app volumes: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := s.destroyAppBuckets(r.Context(), env, app); err != nil {
+			s.log.Errorf("Failed to destroy app buckets: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	} else {
+		if res.RetainedDatabases, err = s.appDatabases(env, app); err != nil {
+			s.log.Errorf("Failed to list app databases: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if res.RetainedVolumes, err = s.appVolumes(env, app); err != nil {
+			s.log.Errorf("Failed to list app volumes: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if res.RetainedBuckets, err = s.appBuckets(env, app); err != nil {
+			s.log.Errorf("Failed to list app buckets: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
 	if err := s.state.DeleteApp(r.Context(), app, env); err != nil {
 		s.log.Errorf("Failed to delete app from state: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -289,7 +513,9 @@ func (s *server) handlerDestroyApp(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.log.Info("Application deleted successfully")
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	jsonRes, _ := json.Marshal(res)
+	_, _ = w.Write(jsonRes)
 }
 
 // trackDeployment polls the latest ECS deployment and streams the status until
@@ -297,6 +523,9 @@ func (s *server) handlerDestroyApp(w http.ResponseWriter, r *http.Request) {
 func (s *server) trackDeployment(ctx context.Context, ecsCluster, ecsService string, e chan<- *Event) {
 	defer close(e)
 
+	// task issues already reported, so each one is only sent once
+	reported := make(map[string]string)
+
 	// todo: improve timeout logic
 	for j := 0; j < 120; j++ {
 		e <- &Event{Msg: "Deploying application to ECS..."}
@@ -304,6 +533,18 @@ func (s *server) trackDeployment(ctx context.Context, ecsCluster, ecsService str
 		if err != nil {
 			s.log.Errorf("Failed to fetch deployment information from ECS: %v", err)
 		}
+		if d.Id != nil {
+			issues, err := s.infra.ECSDeploymentTaskIssues(ctx, ecsCluster, aws.ToString(d.Id))
+			if err != nil {
+				s.log.Errorf("Failed to fetch deployment tasks from ECS: %v", err)
+			}
+			for task, issue := range issues {
+				if reported[task] != issue {
+					reported[task] = issue
+					e <- &Event{Msg: fmt.Sprintf("Task %s: %s", task, issue)}
+				}
+			}
+		}
 		switch d.RolloutState {
 		case types.DeploymentRolloutStateCompleted:
 			e <- &Event{Msg: "Done"}
@@ -317,6 +558,135 @@ func (s *server) trackDeployment(ctx context.Context, ecsCluster, ecsService str
 	e <- &Event{Err: errors.New("deployment polling timeout reached")}
 }
 
+// checkAppCompatible ensures that an application can run in an environment
+// with the given configuration. It returns a message describing why the app
+// is not compatible, or an empty string if it is.
+func (s *server) checkAppCompatible(
+	ctx context.Context, env *environment.Environment, app *application.Application,
+) (string, error) {
+	if app.HealthCheck != nil && app.HealthCheck.Protocol == application.ProtocolGRPC && !env.DomainEnabled() {
+		return "gRPC apps can only be deployed to a domain-enabled environment", nil
+	}
+	if msg, err := s.checkAppIAM(ctx, app); msg != "" || err != nil {
+		return msg, err
+	}
+	return s.checkAppRouting(ctx, env, app)
+}
+
+// taskSizeMsg returns a message describing the size of an application's
+// tasks that it's billed for, which may be larger than it requested.
+func taskSizeMsg(app *application.Application) (string, error) {
+	cpu, memory, err := app.TaskSize()
+	if err != nil {
+		return "", err
+	}
+	msg := fmt.Sprintf(
+		"Each task is billed for %s vCPU & %s GB memory (requested %d CPU units & %d MB memory)",
+		strconv.FormatFloat(float64(cpu)/1024, 'f', -1, 64),
+		strconv.FormatFloat(float64(memory)/1024, 'f', -1, 64),
+		app.TotalCpu(),
+		app.TotalMemory(),
+	)
+	if s := app.Resources.EphemeralStorage; s != 0 {
+		msg += fmt.Sprintf(" and %d GB ephemeral storage", s)
+	}
+	return msg, nil
+}
+
+// appTFConfig generates the TF configuration of an application
+func (s *server) appTFConfig(
+	ctx context.Context, spec *deployment.Spec, env *environment.Environment,
+) (map[string]string, error) {
+	i := &infrastructure.AppTFConfigInput{
+		Spec:              spec,
+		Env:               env,
+		DomainTFStateFile: s.domainTFStateFile(env.Domain),
+		EnvTFStateFile:    s.envTfStateFile(env.Name),
+	}
+	if env.DomainEnabled() {
+		service, err := s.domainDNSService(ctx, env.Domain)
+		if err != nil {
+			return nil, err
+		}
+		i.DomainDNSService = service
+	}
+	if len(spec.App.Databases) > 0 {
+		i.DatabaseTFStateFiles = s.databaseTFStateFiles(spec)
+	}
+	if len(spec.App.Volumes) > 0 {
+		i.VolumeTFStateFiles = s.volumeTFStateFiles(spec)
+	}
+	if len(spec.App.Buckets) > 0 {
+		i.BucketTFStateFiles = s.bucketTFStateFiles(spec)
+	}
+	if spec.App.Routing != nil {
+		files, services, err := s.hostnameDomainInfo(ctx, spec.App.Routing.Hostnames)
+		if err != nil {
+			return nil, err
+		}
+		i.HostnameTFStateFiles = files
+		i.HostnameDNSServices = services
+	}
+	return s.infra.AppTFConfig(i)
+}
+
+// regenerateAppTFConfig rewrites the generated TF configuration of an existing
+// application so changes to its spec, such as routing, take effect.
+func (s *server) regenerateAppTFConfig(
+	ctx context.Context, spec *deployment.Spec, env *environment.Environment, dir string,
+) error {
+	tfConfigs, err := s.appTFConfig(ctx, spec, env)
+	if err != nil {
+		return err
+	}
+	return s.regenerateTFConfig(dir, tfConfigs)
+}
+
+// regenerateTFConfig rewrites the generated TF configuration of an existing
+// module. Generated files that are no longer needed are deleted. The core TF
+// config is left untouched since changing it requires re-initializing the module.
+func (s *server) regenerateTFConfig(dir string, tfConfigs map[string]string) error {
+	delete(tfConfigs, s.config.terraformConfigFile)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		n := e.Name()
+		if _, ok := tfConfigs[n]; ok || n == s.config.terraformConfigFile || !infrastructure.IsGeneratedTFFile(n) {
+			continue
+		}
+		if err := os.Remove(path.Join(dir, n)); err != nil {
+			return err
+		}
+	}
+	return s.writeFiles(dir, tfConfigs)
+}
+
+// generatedTFConfig returns the generated TF configuration files of an existing
+// module, except the core TF config.
+func (s *server) generatedTFConfig(dir string) (map[string]string, error) {
+	res := make(map[string]string)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		n := e.Name()
+		if n == s.config.terraformConfigFile || !infrastructure.IsGeneratedTFFile(n) {
+			continue
+		}
+		content, err := os.ReadFile(path.Join(dir, n))
+		if err != nil {
+			return nil, err
+		}
+		res[n] = string(content)
+	}
+	return res, nil
+}
+
 func (s *server) appTfDir(env, app string) string {
 	return path.Join(s.envTfDir(env), app)
 }
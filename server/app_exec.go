@@ -0,0 +1,139 @@
+package server
+
+import (
+	"errors"
+	"github.com/cloudfauj/cloudfauj/infrastructure"
+	"github.com/cloudfauj/cloudfauj/wsmanager"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// AppExecRequest describes a command to run interactively in an application's container.
+// Once the session starts, the client sends the command's input as binary messages
+// and receives its output as binary messages.
+type AppExecRequest struct {
+	App     string `json:"app"`
+	Env     string `json:"env"`
+	Command string `json:"command"`
+	// Size of the client's terminal, if any
+	Cols int `json:"cols,omitempty"`
+	Rows int `json:"rows,omitempty"`
+}
+
+// binaryWriter sends all data written to it as binary websocket messages
+type binaryWriter struct {
+	conn *wsmanager.WSManager
+}
+
+func (w *binaryWriter) Write(p []byte) (int, error) {
+	return len(p), w.conn.WriteMessage(websocket.BinaryMessage, p)
+}
+
+func (s *server) handlerExecApp(w http.ResponseWriter, r *http.Request) {
+	wsConn, err := s.wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.log.Errorf("Failed to upgrade websocket connection: %v", err)
+		return
+	}
+	defer wsConn.Close()
+	conn := &wsmanager.WSManager{Conn: wsConn}
+
+	var req AppExecRequest
+	if err := conn.ReadJSON(&req); err != nil {
+		s.log.Errorf("Failed to read app exec request: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if req.Command == "" {
+		conn.SendFailure("Command to run must be specified", websocket.CloseInvalidFramePayloadData)
+		return
+	}
+	l := s.log.WithFields(logrus.Fields{"app": req.App, "env": req.Env})
+
+	artifact, err := s.state.AppArtifact(r.Context(), req.App, req.Env)
+	if err != nil {
+		l.Errorf("Failed to fetch app artifact from state: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if artifact == "" {
+		conn.SendFailure("App is not deployed in the environment", websocket.ClosePolicyViolation)
+		return
+	}
+
+	tf, err := s.infra.NewTerraform(s.appTfDir(req.Env, req.App), nil)
+	if err != nil {
+		l.Error(err)
+		conn.SendFailureISE()
+		return
+	}
+	cluster, err := s.infra.AppECSCluster(r.Context(), tf)
+	if err != nil {
+		l.Errorf("Failed to get ECS cluster of app: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	service, err := s.infra.AppECSService(r.Context(), tf)
+	if err != nil {
+		l.Errorf("Failed to get ECS service of app: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+
+	task, err := s.infra.ECSExecTask(r.Context(), cluster, service)
+	if err != nil {
+		if errors.Is(err, infrastructure.ErrNoExecTask) {
+			conn.SendFailure(
+				"No running task of the app accepts exec sessions. Apps deployed before exec was supported must be deployed again.",
+				websocket.ClosePolicyViolation,
+			)
+			return
+		}
+		l.Errorf("Failed to find task to exec into: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	// the app's container is named after it
+	session, err := s.infra.ECSExecuteCommand(r.Context(), cluster, task, req.App, req.Command)
+	if err != nil {
+		l.Errorf("Failed to start exec session: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	ssm, err := s.infra.OpenSSMSession(r.Context(), session)
+	if err != nil {
+		l.Error(err)
+		conn.SendFailureISE()
+		return
+	}
+	defer ssm.Close()
+	ssm.SetTerminalSize(req.Cols, req.Rows)
+
+	l.WithField("task", task).Info("Starting exec session")
+	conn.SendTextMsg("Starting session in task " + infrastructure.ECSTaskID(task))
+
+	// Relay the client's input until it disconnects, which also ends the session
+	go func() {
+		defer ssm.Close()
+		for {
+			t, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if t != websocket.BinaryMessage {
+				continue
+			}
+			if _, err := ssm.Write(msg); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := ssm.Run(&binaryWriter{conn: conn}); err != nil {
+		l.Errorf("Exec session failed: %v", err)
+		conn.SendFailure("Session ended unexpectedly", websocket.CloseInternalServerErr)
+		return
+	}
+	conn.SendClosureMsg(websocket.CloseNormalClosure)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/infrastructure"
+	"github.com/cloudfauj/cloudfauj/wsmanager"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// AppLogsRequest describes the logs of an application to fetch
+type AppLogsRequest struct {
+	App string `json:"app"`
+	Env string `json:"env"`
+	// Only fetch events logged in this duration before now
+	Since time.Duration `json:"since"`
+	// CloudWatch Logs filter pattern events must match
+	Filter string `json:"filter,omitempty"`
+	// Keep streaming new events until the client disconnects
+	Follow bool `json:"follow,omitempty"`
+}
+
+func (s *server) handlerGetAppLogs(w http.ResponseWriter, r *http.Request) {
+	wsConn, err := s.wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.log.Errorf("Failed to upgrade websocket connection: %v", err)
+		return
+	}
+	defer wsConn.Close()
+	conn := &wsmanager.WSManager{Conn: wsConn}
+
+	var req AppLogsRequest
+	if err := conn.ReadJSON(&req); err != nil {
+		s.log.Errorf("Failed to read app logs request: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	l := s.log.WithFields(logrus.Fields{"app": req.App, "env": req.Env})
+
+	app, err := s.state.App(r.Context(), req.App, req.Env)
+	if err != nil {
+		l.Errorf("Failed to fetch app from state: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if app == nil {
+		conn.SendFailure("App does not exist in the environment", websocket.ClosePolicyViolation)
+		return
+	}
+
+	// The client closing the connection is only noticed while reading from it,
+	// which stops following the logs.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	// errors sending events mean the client is gone, so there's no one to report them to
+	var sendErr error
+	err = s.infra.StreamAppLogs(
+		ctx, req.Env, req.App, time.Now().Add(-req.Since), req.Filter, req.Follow,
+		func(e *infrastructure.AppLogEvent) error {
+			msg := fmt.Sprintf("%s [%s] %s", e.Timestamp.Format(time.RFC3339), e.TaskId, e.Message)
+			sendErr = conn.SendTextMsg(msg)
+			return sendErr
+		},
+	)
+	if sendErr != nil {
+		return
+	}
+	if err != nil {
+		l.Errorf("Failed to fetch app logs: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if !req.Follow {
+		conn.SendClosureMsg(websocket.CloseNormalClosure)
+	}
+}
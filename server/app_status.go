@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/cloudfauj/cloudfauj/infrastructure"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// Number of most recent ECS service events & stopped tasks reported in an app's status
+const (
+	appStatusEventsLimit       = 10
+	appStatusStoppedTasksLimit = 5
+)
+
+// AppStatus describes the live state of an application as reported by ECS
+// and the load balancer.
+type AppStatus struct {
+	App         string `json:"app"`
+	Environment string `json:"environment"`
+	// Status of the ECS service, eg- ACTIVE
+	Status       string `json:"status"`
+	DesiredCount int32  `json:"desired_count"`
+	RunningCount int32  `json:"running_count"`
+	PendingCount int32  `json:"pending_count"`
+
+	// Task definition used by the service's primary deployment, as family:revision
+	TaskDefinition string `json:"task_definition"`
+	// Images run by the task definition's containers, keyed by container name
+	Images map[string]string `json:"images"`
+
+	Events       []*ServiceEvent `json:"events"`
+	StoppedTasks []*StoppedTask  `json:"stopped_tasks"`
+	// Health of the app's tasks registered with the load balancer.
+	// Nil if the app isn't exposed via a load balancer.
+	Targets []*TargetHealth `json:"targets,omitempty"`
+}
+
+type ServiceEvent struct {
+	CreatedAt time.Time `json:"created_at"`
+	Message   string    `json:"message"`
+}
+
+type StoppedTask struct {
+	Id        string    `json:"id"`
+	StoppedAt time.Time `json:"stopped_at"`
+	Reason    string    `json:"reason"`
+}
+
+type TargetHealth struct {
+	Id          string `json:"id"`
+	Port        int32  `json:"port"`
+	State       string `json:"state"`
+	Description string `json:"description,omitempty"`
+}
+
+func (s *server) handlerGetAppStatus(w http.ResponseWriter, r *http.Request) {
+	app := mux.Vars(r)["name"]
+	env := r.URL.Query().Get("env")
+	l := s.log.WithFields(logrus.Fields{"app": app, "env": env})
+
+	artifact, err := s.state.AppArtifact(r.Context(), app, env)
+	if err != nil {
+		l.Errorf("Failed to fetch app artifact from state: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// an app only runs in ECS once it has been deployed successfully
+	if artifact == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	res, err := s.appStatus(r.Context(), app, env)
+	if err != nil {
+		l.Errorf("Failed to fetch app status: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonRes, _ := json.Marshal(res)
+	_, _ = w.Write(jsonRes)
+}
+
+// appStatus fetches the live state of an application's ECS service & targets
+func (s *server) appStatus(ctx context.Context, app, env string) (*AppStatus, error) {
+	tf, err := s.infra.NewTerraform(s.appTfDir(env, app), nil)
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := s.infra.AppECSCluster(ctx, tf)
+	if err != nil {
+		return nil, err
+	}
+	service, err := s.infra.AppECSService(ctx, tf)
+	if err != nil {
+		return nil, err
+	}
+	targetGroup, err := s.infra.AppTargetGroup(ctx, tf)
+	if err != nil {
+		return nil, err
+	}
+
+	svc, err := s.infra.ECSService(ctx, service, cluster)
+	if err != nil {
+		return nil, err
+	}
+	res := &AppStatus{
+		App:          app,
+		Environment:  env,
+		Status:       aws.ToString(svc.Status),
+		DesiredCount: svc.DesiredCount,
+		RunningCount: svc.RunningCount,
+		PendingCount: svc.PendingCount,
+		Images:       make(map[string]string),
+	}
+
+	td, err := s.infra.ECSTaskDefinition(ctx, aws.ToString(svc.TaskDefinition))
+	if err != nil {
+		return nil, err
+	}
+	res.TaskDefinition = aws.ToString(td.Family) + ":" + fmt.Sprint(td.Revision)
+	for _, c := range td.ContainerDefinitions {
+		res.Images[aws.ToString(c.Name)] = aws.ToString(c.Image)
+	}
+
+	// ECS reports service events most recent first
+	for i, e := range svc.Events {
+		if i == appStatusEventsLimit {
+			break
+		}
+		res.Events = append(res.Events, &ServiceEvent{CreatedAt: aws.ToTime(e.CreatedAt), Message: aws.ToString(e.Message)})
+	}
+
+	tasks, err := s.infra.ECSStoppedTasks(ctx, cluster, service, appStatusStoppedTasksLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tasks {
+		res.StoppedTasks = append(res.StoppedTasks, &StoppedTask{
+			Id:        infrastructure.ECSTaskID(aws.ToString(t.TaskArn)),
+			StoppedAt: aws.ToTime(t.StoppedAt),
+			Reason:    aws.ToString(t.StoppedReason),
+		})
+	}
+
+	// apps deployed before their target group was exported don't report targets
+	// until they're deployed again.
+	if targetGroup != "" {
+		targets, err := s.infra.TargetHealth(ctx, targetGroup)
+		if err != nil {
+			return nil, err
+		}
+		res.Targets = []*TargetHealth{}
+		for _, t := range targets {
+			th := &TargetHealth{Id: aws.ToString(t.Target.Id), Port: aws.ToInt32(t.Target.Port)}
+			if h := t.TargetHealth; h != nil {
+				th.State = string(h.State)
+				th.Description = aws.ToString(h.Description)
+			}
+			res.Targets = append(res.Targets, th)
+		}
+	}
+	return res, nil
+}
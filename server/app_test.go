@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/cloudfauj/cloudfauj/application"
+	"github.com/cloudfauj/cloudfauj/deployment"
+	"github.com/cloudfauj/cloudfauj/environment"
+	"github.com/cloudfauj/cloudfauj/wsmanager"
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/terraform-exec/tfexec"
+)
+
+// newTestConn returns the server's end of a websocket connection whose client
+// discards everything it receives
+func newTestConn(t *testing.T) *wsmanager.WSManager {
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade connection: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	go func() {
+		for {
+			if _, _, err := client.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn := <-conns
+	t.Cleanup(func() { conn.Close() })
+	return &wsmanager.WSManager{Conn: conn}
+}
+
+func TestCheckAppCompatibleHealthCheck(t *testing.T) {
+	s := newTestServer(t)
+	env := &environment.Environment{Name: "staging"}
+
+	cases := []struct {
+		name        string
+		healthCheck *application.HealthCheck
+		domain      string
+		compatible  bool
+	}{
+		{"no healthcheck", nil, "", true},
+		{"http", &application.HealthCheck{Path: "/ping"}, "", true},
+		{"grpc without domain", &application.HealthCheck{Path: "/", Protocol: application.ProtocolGRPC}, "", false},
+		{"grpc with domain", &application.HealthCheck{Path: "/", Protocol: application.ProtocolGRPC}, "example.com", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			env.Domain = c.domain
+			app := &application.Application{Name: "api", HealthCheck: c.healthCheck}
+			msg, err := s.checkAppCompatible(context.Background(), env, app)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (msg == "") != c.compatible {
+				t.Errorf("checkAppCompatible() = %q, want compatible = %v", msg, c.compatible)
+			}
+		})
+	}
+}
+
+func TestCreateNewAppInvalidOverlays(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	env := &environment.Environment{Name: "staging", Status: environment.StatusProvisioned, VpcCidr: "10.0.0.0/16"}
+	if err := s.state.CreateEnvironment(ctx, env); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(s.appOverlaysDir(env.Name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	overlay := path.Join(s.appOverlaysDir(env.Name), "extra.tf")
+	if err := os.WriteFile(overlay, []byte(`resource "x" "y" {`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &deployment.Spec{
+		TargetEnv: env.Name,
+		App: &application.Application{
+			Name:        "api",
+			Type:        application.TypeServer,
+			Visibility:  application.VisibilityPublic,
+			HealthCheck: &application.HealthCheck{Path: "/"},
+			Resources: &application.Resources{
+				Cpu:     256,
+				Memory:  512,
+				Network: &application.Network{BindPort: 80},
+			},
+		},
+	}
+	dir := s.appTfDir(env.Name, spec.App.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// validation fails since the binary isn't terraform
+	tf, err := tfexec.NewTerraform(dir, "/bin/false")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.createNewApp(ctx, newTestConn(t), spec, env, tf, dir)
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("app directory was left behind: %v", err)
+	}
+	app, err := s.state.App(ctx, spec.App.Name, env.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app != nil {
+		t.Error("app was registered in state")
+	}
+}
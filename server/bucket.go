@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/deployment"
+	"github.com/cloudfauj/cloudfauj/infrastructure"
+	"github.com/cloudfauj/cloudfauj/wsmanager"
+	"os"
+	"path"
+)
+
+// applyAppBuckets provisions the buckets of an application, or applies changes
+// to their configuration. Buckets no longer in the app's config are retained
+// along with their objects.
+func (s *server) applyAppBuckets(ctx context.Context, conn *wsmanager.WSManager, spec *deployment.Spec) error {
+	existing, err := s.appBuckets(spec.TargetEnv, spec.App.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list app buckets: %v", err)
+	}
+	configured := make(map[string]bool)
+
+	for _, b := range spec.App.Buckets {
+		configured[b.Name] = true
+		dir := s.bucketTfDir(spec.TargetEnv, spec.App.Name, b.Name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory for bucket %s: %v", b.Name, err)
+		}
+		tfConfigs := s.infra.BucketTFConfig(&infrastructure.BucketTFConfigInput{
+			Bucket: b,
+			App:    spec.App.Name,
+			Env:    spec.TargetEnv,
+		})
+		if err := s.writeFiles(dir, tfConfigs); err != nil {
+			return fmt.Errorf("failed to write terraform configs for bucket %s: %v", b.Name, err)
+		}
+
+		tf, err := s.infra.NewTerraform(dir, conn)
+		if err != nil {
+			return err
+		}
+		conn.SendTextMsg("Provisioning bucket " + b.Name)
+		if err := s.infra.ApplyBucket(ctx, tf); err != nil {
+			return fmt.Errorf("failed to provision bucket %s: %v", b.Name, err)
+		}
+	}
+
+	for _, name := range existing {
+		if !configured[name] {
+			conn.SendTextMsg(fmt.Sprintf(
+				"Bucket %s is no longer configured, it is retained until the app is destroyed with --delete-data",
+				name,
+			))
+		}
+	}
+	return nil
+}
+
+// destroyAppBuckets deletes all buckets provisioned for an application,
+// including their objects.
+func (s *server) destroyAppBuckets(ctx context.Context, env, app string) error {
+	names, err := s.appBuckets(env, app)
+	if err != nil {
+		return fmt.Errorf("failed to list app buckets: %v", err)
+	}
+	for _, name := range names {
+		tf, err := s.infra.NewTerraform(s.bucketTfDir(env, app, name), nil)
+		if err != nil {
+			return err
+		}
+		if err := s.infra.DestroyBucket(ctx, tf); err != nil {
+			return fmt.Errorf("failed to destroy bucket %s: %v", name, err)
+		}
+		if err := os.RemoveAll(s.bucketTfDir(env, app, name)); err != nil {
+			return fmt.Errorf("failed to delete TF config of bucket %s from disk: %v", name, err)
+		}
+	}
+	return os.RemoveAll(path.Join(s.bucketsTfDir(env), app))
+}
+
+// appBuckets returns the names of all buckets provisioned for an application,
+// including those retained after being removed from its config or after the
+// app was destroyed.
+func (s *server) appBuckets(env, app string) ([]string, error) {
+	return subDirs(path.Join(s.bucketsTfDir(env), app))
+}
+
+// envContainsBuckets returns true if buckets of any app, including
+// destroyed ones, exist in an environment.
+func (s *server) envContainsBuckets(env string) (bool, error) {
+	apps, err := subDirs(s.bucketsTfDir(env))
+	return len(apps) > 0, err
+}
+
+// bucketTFStateFiles returns the TF state files of an application's buckets, keyed by name
+func (s *server) bucketTFStateFiles(spec *deployment.Spec) map[string]string {
+	res := make(map[string]string)
+	for _, b := range spec.App.Buckets {
+		res[b.Name] = s.bucketTfStateFile(spec.TargetEnv, spec.App.Name, b.Name)
+	}
+	return res
+}
+
+func (s *server) bucketsTfDir(env string) string {
+	return path.Join(s.envTfDir(env), s.config.bucketsDir)
+}
+
+func (s *server) bucketTfDir(env, app, bucket string) string {
+	return path.Join(s.bucketsTfDir(env), app, bucket)
+}
+
+func (s *server) bucketTfStateFile(env, app, bucket string) string {
+	return path.Join(s.bucketTfDir(env, app, bucket), s.config.terraformStateFile)
+}
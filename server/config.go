@@ -1,6 +1,15 @@
 package server
 
-import "path"
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// DefaultTerraformVersion is the version of Terraform used when the
+// server configuration doesn't specify one.
+const DefaultTerraformVersion = "1.0.5"
 
 // Configuration passed to a Cloudfauj server.
 // It dictates where and how the server state is organized.
@@ -29,6 +38,27 @@ type Config struct {
 	// for domains.
 	terraformDomainsDir string
 
+	// Directory inside an environment's terraform dir containing overlays
+	// to be applied to all applications in the environment.
+	appOverlaysDir string
+
+	// Directory inside an environment's terraform dir containing terraform
+	// configurations for the databases of its applications.
+	databasesDir string
+
+	// Directory inside an environment's terraform dir containing terraform
+	// configurations for the volumes of its applications.
+	volumesDir string
+
+	// Directory inside an environment's terraform dir containing terraform
+	// configurations for the buckets of its applications.
+	bucketsDir string
+
+	// Names of the files inside an environment's terraform dir holding the
+	// plan of a pending update and the configuration it was planned for.
+	envUpdatePlanFile   string
+	envUpdateConfigFile string
+
 	// Name of the main Terraform config file.
 	// The value of this is always "terraform.tf".
 	terraformConfigFile string
@@ -39,6 +69,17 @@ type Config struct {
 
 	// The terraform version the server works with
 	terraformVersion string
+
+	// Name of the Terraform binary inside base
+	terraformBinary string
+
+	// Directory inside base where a new Terraform version is staged
+	// while upgrading.
+	terraformUpgradeDir string
+
+	// IAM actions that applications can be granted via their task roles.
+	// Wildcards are allowed, eg- s3:Get* or sqs:*.
+	iamAllowedActions []string
 }
 
 // NewConfig returns a new Server Configuration
@@ -51,9 +92,17 @@ func NewConfig(dataDir string) *Config {
 		dbFilename:          "server.db",
 		terraformDir:        "infrastructure",
 		terraformDomainsDir: "_domains",
+		appOverlaysDir:      "_app_overlays",
+		databasesDir:        "_databases",
+		volumesDir:          "_volumes",
+		bucketsDir:          "_buckets",
+		envUpdatePlanFile:   "update.tfplan",
+		envUpdateConfigFile: "update.json",
 		terraformConfigFile: "terraform.tf",
 		terraformStateFile:  "terraform.tfstate",
-		terraformVersion:    "1.0.5",
+		terraformVersion:    DefaultTerraformVersion,
+		terraformBinary:     "terraform",
+		terraformUpgradeDir: "_terraform_upgrade",
 	}
 }
 
@@ -95,3 +144,57 @@ func (c *Config) TerraformDomainsDir() string {
 func (c *Config) TerraformVersion() string {
 	return c.terraformVersion
 }
+
+// SetTerraformVersion changes the version of terraform the server works with.
+func (c *Config) SetTerraformVersion(v string) {
+	c.terraformVersion = v
+}
+
+// IAMAllowedActions returns the IAM actions applications can be granted.
+func (c *Config) IAMAllowedActions() []string {
+	return c.iamAllowedActions
+}
+
+// SetIAMAllowedActions changes the IAM actions applications can be granted.
+func (c *Config) SetIAMAllowedActions(actions []string) {
+	c.iamAllowedActions = actions
+}
+
+// TerraformBinary returns the exact path of the Terraform binary used
+// by the server.
+func (c *Config) TerraformBinary() string {
+	return path.Join(c.DataDir(), c.terraformBinary)
+}
+
+// TerraformUpgradeDir returns the exact path of directory in which
+// a new version of Terraform is downloaded during an upgrade.
+func (c *Config) TerraformUpgradeDir() string {
+	return path.Join(c.DataDir(), c.terraformUpgradeDir)
+}
+
+// TerraformModuleDirs returns the exact paths of all Terraform modules
+// managed by the server, ie, all directories inside TerraformDir
+// containing the main Terraform config file.
+// Modules are returned in lexical order, so an environment always
+// appears before its applications.
+func (c *Config) TerraformModuleDirs() ([]string, error) {
+	var res []string
+
+	err := filepath.WalkDir(c.TerraformDir(), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		// skip terraform's own working data
+		if d.Name() == ".terraform" {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(path.Join(p, c.terraformConfigFile)); err == nil {
+			res = append(res, p)
+		}
+		return nil
+	})
+	return res, err
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/deployment"
+	"github.com/cloudfauj/cloudfauj/infrastructure"
+	"github.com/cloudfauj/cloudfauj/wsmanager"
+	"os"
+	"path"
+)
+
+// applyAppDatabases provisions the databases of an application, or applies
+// changes to their configuration. Databases no longer in the app's config
+// are retained along with their data.
+func (s *server) applyAppDatabases(ctx context.Context, conn *wsmanager.WSManager, spec *deployment.Spec) error {
+	existing, err := s.appDatabases(spec.TargetEnv, spec.App.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list app databases: %v", err)
+	}
+	configured := make(map[string]bool)
+
+	for _, db := range spec.App.Databases {
+		configured[db.Name] = true
+		dir := s.databaseTfDir(spec.TargetEnv, spec.App.Name, db.Name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory for database %s: %v", db.Name, err)
+		}
+		tfConfigs := s.infra.DatabaseTFConfig(&infrastructure.DatabaseTFConfigInput{
+			Database:       db,
+			App:            spec.App.Name,
+			Env:            spec.TargetEnv,
+			EnvTFStateFile: s.envTfStateFile(spec.TargetEnv),
+		})
+		if err := s.writeFiles(dir, tfConfigs); err != nil {
+			return fmt.Errorf("failed to write terraform configs for database %s: %v", db.Name, err)
+		}
+
+		tf, err := s.infra.NewTerraform(dir, conn)
+		if err != nil {
+			return err
+		}
+		conn.SendTextMsg("Provisioning database " + db.Name)
+		if err := s.infra.ApplyDatabase(ctx, tf); err != nil {
+			return fmt.Errorf("failed to provision database %s: %v", db.Name, err)
+		}
+	}
+
+	for _, name := range existing {
+		if !configured[name] {
+			conn.SendTextMsg(fmt.Sprintf(
+				"Database %s is no longer configured, it is retained until the app is destroyed with --delete-data",
+				name,
+			))
+		}
+	}
+	return nil
+}
+
+// destroyAppDatabases deletes all databases provisioned for an application,
+// including their data.
+func (s *server) destroyAppDatabases(ctx context.Context, env, app string) error {
+	names, err := s.appDatabases(env, app)
+	if err != nil {
+		return fmt.Errorf("failed to list app databases: %v", err)
+	}
+	for _, name := range names {
+		tf, err := s.infra.NewTerraform(s.databaseTfDir(env, app, name), nil)
+		if err != nil {
+			return err
+		}
+		if err := s.infra.DestroyDatabase(ctx, tf); err != nil {
+			return fmt.Errorf("failed to destroy database %s: %v", name, err)
+		}
+		if err := os.RemoveAll(s.databaseTfDir(env, app, name)); err != nil {
+			return fmt.Errorf("failed to delete TF config of database %s from disk: %v", name, err)
+		}
+	}
+	return os.RemoveAll(path.Join(s.databasesTfDir(env), app))
+}
+
+// appDatabases returns the names of all databases provisioned for an application,
+// including those retained after being removed from its config or after the
+// app was destroyed.
+func (s *server) appDatabases(env, app string) ([]string, error) {
+	return subDirs(path.Join(s.databasesTfDir(env), app))
+}
+
+// envContainsDatabases returns true if databases of any app, including
+// destroyed ones, exist in an environment.
+func (s *server) envContainsDatabases(env string) (bool, error) {
+	apps, err := subDirs(s.databasesTfDir(env))
+	return len(apps) > 0, err
+}
+
+// subDirs returns the names of all directories inside dir.
+// It returns nil if dir doesn't exist.
+func subDirs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var res []string
+	for _, e := range entries {
+		if e.IsDir() {
+			res = append(res, e.Name())
+		}
+	}
+	return res, nil
+}
+
+// databaseTFStateFiles returns the TF state files of an application's databases, keyed by name
+func (s *server) databaseTFStateFiles(spec *deployment.Spec) map[string]string {
+	res := make(map[string]string)
+	for _, db := range spec.App.Databases {
+		res[db.Name] = s.databaseTfStateFile(spec.TargetEnv, spec.App.Name, db.Name)
+	}
+	return res
+}
+
+func (s *server) databasesTfDir(env string) string {
+	return path.Join(s.envTfDir(env), s.config.databasesDir)
+}
+
+func (s *server) databaseTfDir(env, app, db string) string {
+	return path.Join(s.databasesTfDir(env), app, db)
+}
+
+func (s *server) databaseTfStateFile(env, app, db string) string {
+	return path.Join(s.databaseTfDir(env, app, db), s.config.terraformStateFile)
+}
@@ -1,8 +1,10 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	acmtypes "github.com/aws/aws-sdk-go-v2/service/acm/types"
 	"github.com/cloudfauj/cloudfauj/domain"
 	"github.com/cloudfauj/cloudfauj/wsmanager"
 	"github.com/gorilla/mux"
@@ -10,8 +12,40 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strings"
+	"time"
 )
 
+// DomainInfo describes a domain along with the live status of its infrastructure
+type DomainInfo struct {
+	*domain.Domain
+	// ID of the DNS hosted zone managing the domain's records
+	ZoneId string `json:"zone_id"`
+	// Name Server records of the hosted zone
+	NameServers       []string           `json:"name_servers"`
+	Delegation        *DelegationStatus  `json:"delegation"`
+	CertificateStatus *CertificateStatus `json:"certificate_status,omitempty"`
+}
+
+// DelegationStatus describes whether a domain's NS records, as resolved from DNS,
+// point to the domain's hosted zone.
+type DelegationStatus struct {
+	Delegated bool `json:"delegated"`
+	// NS records returned by the resolver
+	NameServers []string `json:"name_servers"`
+	// Reason the NS records couldn't be resolved
+	Error string `json:"error,omitempty"`
+}
+
+// CertificateStatus describes the TLS certificate used by a domain, as reported by ACM
+type CertificateStatus struct {
+	Arn    string `json:"arn"`
+	Status string `json:"status"`
+	// Imported certificates are not renewed by ACM
+	Imported bool      `json:"imported"`
+	NotAfter time.Time `json:"not_after,omitempty"`
+}
+
 func (s *server) handlerAddDomain(w http.ResponseWriter, r *http.Request) {
 	wsConn, err := s.wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -34,6 +68,19 @@ func (s *server) handlerAddDomain(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
+	if d.DNSService == domain.DNSServiceCloudflare && s.infra.CloudflareAPIToken == "" {
+		conn.SendFailure(
+			"Cloudflare API token must be set in the server configuration to use Cloudflare",
+			websocket.ClosePolicyViolation,
+		)
+		return
+	}
+	if c := d.Certificate; c != nil && !c.Imported() {
+		if err := s.infra.ValidateExistingCertificate(r.Context(), c.Arn, d.Name); err != nil {
+			conn.SendFailure(fmt.Sprintf("Invalid certificate: %v", err), websocket.ClosePolicyViolation)
+			return
+		}
+	}
 
 	exists, err := s.state.CheckDomainExists(r.Context(), d.Name)
 	if err != nil {
@@ -121,7 +168,42 @@ func (s *server) handlerDeleteDomain(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Abort if domain being used by any environments
+	// environments read the domain's TF state, so it can't be destroyed while in use
+	envs, err := s.state.ListDomainEnvironments(r.Context(), name)
+	if err != nil {
+		s.log.WithField("name", name).Errorf("Failed to list environments using domain: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if len(envs) > 0 {
+		conn.SendFailure(
+			fmt.Sprintf(
+				"Domain is used by environments %s, detach it from them before deleting",
+				strings.Join(envs, ", "),
+			),
+			websocket.ClosePolicyViolation,
+		)
+		return
+	}
+
+	// so do apps routing custom hostnames under the domain
+	apps, err := s.domainRoutingApps(r.Context(), name)
+	if err != nil {
+		s.log.WithField("name", name).Errorf("Failed to list apps routing hostnames of domain: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if len(apps) > 0 {
+		conn.SendFailure(
+			fmt.Sprintf(
+				"Domain has hostnames routed to apps %s, remove them from their routing before deleting",
+				strings.Join(apps, ", "),
+			),
+			websocket.ClosePolicyViolation,
+		)
+		return
+	}
+
 	conn.SendTextMsg("Destroying infrastructure")
 
 	dir := s.domainTFDir(name)
@@ -234,6 +316,68 @@ func (s *server) handlerTFApplyDomain(w http.ResponseWriter, r *http.Request) {
 	conn.SendSuccess("Done")
 }
 
+func (s *server) handlerGetDomain(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	d, err := s.state.Domain(r.Context(), name)
+	if err != nil {
+		s.log.WithField("name", name).Errorf("Failed to fetch domain from state: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if d == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	res := &DomainInfo{Domain: d}
+
+	tf, err := s.infra.NewTerraform(s.domainTFDir(name), nil)
+	if err != nil {
+		s.log.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	res.ZoneId, res.NameServers, err = s.infra.DomainZone(r.Context(), tf)
+	if err != nil {
+		s.log.WithField("name", name).Errorf("Failed to read domain hosted zone: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	res.Delegation = &DelegationStatus{}
+	res.Delegation.NameServers, res.Delegation.Delegated, err = s.infra.CheckDelegation(
+		r.Context(), name, res.NameServers,
+	)
+	if err != nil {
+		res.Delegation.Error = err.Error()
+	}
+
+	arn, err := s.infra.DomainCertificateArn(r.Context(), tf)
+	if err != nil {
+		s.log.WithField("name", name).Errorf("Failed to read domain certificate: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if arn != "" {
+		res.CertificateStatus = &CertificateStatus{Arn: arn}
+		c, err := s.infra.ACMCertificate(r.Context(), arn)
+		if err != nil {
+			// the rest of the information is still useful, so only report the failure
+			s.log.WithField("arn", arn).Errorf("Failed to fetch certificate from ACM: %v", err)
+			res.CertificateStatus.Status = "UNKNOWN"
+		} else {
+			res.CertificateStatus.Status = string(c.Status)
+			res.CertificateStatus.Imported = c.Type == acmtypes.CertificateTypeImported
+			if c.NotAfter != nil {
+				res.CertificateStatus.NotAfter = *c.NotAfter
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonRes, _ := json.Marshal(res)
+	_, _ = w.Write(jsonRes)
+}
+
 func (s *server) handlerListDomains(w http.ResponseWriter, r *http.Request) {
 	res, err := s.state.ListDomains(r.Context())
 	if err != nil {
@@ -247,6 +391,18 @@ func (s *server) handlerListDomains(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(jsonRes)
 }
 
+// domainDNSService returns the DNS service used by a domain
+func (s *server) domainDNSService(ctx context.Context, name string) (string, error) {
+	d, err := s.state.Domain(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch domain %s: %v", name, err)
+	}
+	if d == nil {
+		return "", fmt.Errorf("domain %s doesn't exist", name)
+	}
+	return d.DNSService, nil
+}
+
 func (s *server) domainTFDir(name string) string {
 	return path.Join(s.config.TerraformDomainsDir(), name)
 }
@@ -254,3 +410,40 @@ func (s *server) domainTFDir(name string) string {
 func (s *server) domainTFStateFile(name string) string {
 	return path.Join(s.domainTFDir(name), s.config.terraformStateFile)
 }
+
+// domainRoutingApps returns all applications, as <env>/<app>, that route custom
+// hostnames belonging to a domain.
+func (s *server) domainRoutingApps(ctx context.Context, domain string) ([]string, error) {
+	var res []string
+
+	envs, err := s.state.ListEnvironments(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %v", err)
+	}
+	for _, env := range envs {
+		apps, err := s.state.ListApps(ctx, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list apps in env %s: %v", env, err)
+		}
+		for _, name := range apps {
+			app, err := s.state.App(ctx, name, env)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch app %s: %v", name, err)
+			}
+			if app == nil || app.Routing == nil {
+				continue
+			}
+			domains, err := s.hostnameDomains(ctx, app.Routing.Hostnames)
+			if err != nil {
+				return nil, err
+			}
+			for _, d := range domains {
+				if d == domain {
+					res = append(res, env+"/"+name)
+					break
+				}
+			}
+		}
+	}
+	return res, nil
+}
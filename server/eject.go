@@ -0,0 +1,293 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/deployment"
+	"github.com/cloudfauj/cloudfauj/environment"
+	"github.com/gorilla/mux"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Layout of the Terraform project produced by ejecting an environment
+const (
+	ejectDomainDir = "domain"
+	ejectEnvDir    = "env"
+	ejectAppsDir   = "apps"
+	// databases are exported to <dir>/<app>/<database>
+	ejectDatabasesDir = "databases"
+	// volumes are exported to <dir>/<app>/<volume>
+	ejectVolumesDir = "volumes"
+	// buckets are exported to <dir>/<app>/<bucket>
+	ejectBucketsDir = "buckets"
+)
+
+const ejectReadme = `# %s
+This Terraform project was ejected from Cloudfauj and is no longer managed by it.
+
+Modules must be applied in the following order since each one reads the
+state of the previous ones:
+
+1. domain/ (only if the environment uses a domain)
+2. env/
+3. databases/*/*/, volumes/*/*/ and buckets/*/*/ (only if apps use them)
+4. apps/*/
+
+Every app module contains a terraform.tfvars file with the values it was last
+deployed with. Apps last deployed by a version of Cloudfauj that didn't record
+artifacts have an empty ecr_image that must be filled in before applying.
+
+If other environments still managed by Cloudfauj use the same domain, Cloudfauj
+continues to manage it and domain/ only serves as a copy of its state.
+`
+
+func (s *server) handlerEjectEnv(w http.ResponseWriter, r *http.Request) {
+	envName := mux.Vars(r)["name"]
+
+	env, err := s.state.Environment(r.Context(), envName)
+	if err != nil {
+		s.log.Errorf("Failed to fetch env: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if env == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	// ejected envs can be exported again until they're destroyed, in case the
+	// client failed to write the project
+	if env.Status != environment.StatusProvisioned && env.Status != environment.StatusUnmanaged {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	s.log.WithField("name", envName).Info("Ejecting environment")
+
+	archive, err := s.ejectEnvArchive(r, env)
+	if err != nil {
+		s.log.Errorf("Failed to export environment: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// marked before sending so that nothing changes the env in the meantime
+	ejected := env.Status == environment.StatusProvisioned
+	if ejected {
+		if err := s.state.UpdateEnvStatus(r.Context(), env.Name, environment.StatusUnmanaged); err != nil {
+			s.log.Errorf("Failed to update env status: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	// lets the client detect an archive cut short
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	if _, err := w.Write(archive); err != nil && ejected {
+		// the client may never have received the archive, so Cloudfauj must keep
+		// managing the env. The request's context is likely cancelled by now.
+		s.log.Errorf("Failed to send ejected environment: %v", err)
+		err = s.state.UpdateEnvStatus(context.Background(), env.Name, environment.StatusProvisioned)
+		if err != nil {
+			s.log.Errorf("Failed to restore status of env %s: %v", env.Name, err)
+		}
+	}
+}
+
+// ejectEnvArchive returns a gzipped tarball containing a self-contained
+// Terraform project for the environment, its domain and all its apps.
+func (s *server) ejectEnvArchive(r *http.Request, env *environment.Environment) ([]byte, error) {
+	files := map[string][]byte{"README.md": []byte(fmt.Sprintf(ejectReadme, env.Name))}
+
+	// remote state paths must be relative to the module reading them
+	envRewriter := strings.NewReplacer(
+		s.domainTFStateFile(env.Domain), path.Join("..", ejectDomainDir, s.config.terraformStateFile),
+	)
+	appRewrites := []string{
+		s.domainTFStateFile(env.Domain), path.Join("../..", ejectDomainDir, s.config.terraformStateFile),
+		s.envTfStateFile(env.Name), path.Join("../..", ejectEnvDir, s.config.terraformStateFile),
+	}
+
+	if env.DomainEnabled() {
+		err := s.exportTFModule(s.domainTFDir(env.Domain), ejectDomainDir, strings.NewReplacer(), files)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export domain: %v", err)
+		}
+	}
+	if err := s.exportTFModule(s.envTfDir(env.Name), ejectEnvDir, envRewriter, files); err != nil {
+		return nil, fmt.Errorf("failed to export environment: %v", err)
+	}
+
+	// databases retained from destroyed apps are exported too
+	dbRewriter := strings.NewReplacer(
+		s.envTfStateFile(env.Name), path.Join("../../..", ejectEnvDir, s.config.terraformStateFile),
+	)
+	dbApps, err := subDirs(s.databasesTfDir(env.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %v", err)
+	}
+	for _, app := range dbApps {
+		dbs, err := s.appDatabases(env.Name, app)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list databases of app %s: %v", app, err)
+		}
+		for _, db := range dbs {
+			dir := path.Join(ejectDatabasesDir, app, db)
+			if err := s.exportTFModule(s.databaseTfDir(env.Name, app, db), dir, dbRewriter, files); err != nil {
+				return nil, fmt.Errorf("failed to export database %s of app %s: %v", db, app, err)
+			}
+		}
+	}
+
+	// so are volumes, which share the rewriter since they sit at the same depth
+	volApps, err := subDirs(s.volumesTfDir(env.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %v", err)
+	}
+	for _, app := range volApps {
+		vols, err := s.appVolumes(env.Name, app)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list volumes of app %s: %v", app, err)
+		}
+		for _, v := range vols {
+			dir := path.Join(ejectVolumesDir, app, v)
+			if err := s.exportTFModule(s.volumeTfDir(env.Name, app, v), dir, dbRewriter, files); err != nil {
+				return nil, fmt.Errorf("failed to export volume %s of app %s: %v", v, app, err)
+			}
+		}
+	}
+
+	// and buckets, which don't read any other state
+	bucketApps, err := subDirs(s.bucketsTfDir(env.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list buckets: %v", err)
+	}
+	for _, app := range bucketApps {
+		buckets, err := s.appBuckets(env.Name, app)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list buckets of app %s: %v", app, err)
+		}
+		for _, b := range buckets {
+			dir := path.Join(ejectBucketsDir, app, b)
+			if err := s.exportTFModule(s.bucketTfDir(env.Name, app, b), dir, dbRewriter, files); err != nil {
+				return nil, fmt.Errorf("failed to export bucket %s of app %s: %v", b, app, err)
+			}
+		}
+	}
+
+	apps, err := s.state.ListApps(r.Context(), env.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list apps: %v", err)
+	}
+	for _, name := range apps {
+		app, err := s.state.App(r.Context(), name, env.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get app %s: %v", name, err)
+		}
+
+		rewrites := append([]string{}, appRewrites...)
+		for _, db := range app.Databases {
+			rewrites = append(rewrites,
+				s.databaseTfStateFile(env.Name, name, db.Name),
+				path.Join("../..", ejectDatabasesDir, name, db.Name, s.config.terraformStateFile),
+			)
+		}
+		for _, v := range app.Volumes {
+			rewrites = append(rewrites,
+				s.volumeTfStateFile(env.Name, name, v.Name),
+				path.Join("../..", ejectVolumesDir, name, v.Name, s.config.terraformStateFile),
+			)
+		}
+		for _, b := range app.Buckets {
+			rewrites = append(rewrites,
+				s.bucketTfStateFile(env.Name, name, b.Name),
+				path.Join("../..", ejectBucketsDir, name, b.Name, s.config.terraformStateFile),
+			)
+		}
+		dir := path.Join(ejectAppsDir, name)
+		if err := s.exportTFModule(s.appTfDir(env.Name, name), dir, strings.NewReplacer(rewrites...), files); err != nil {
+			return nil, fmt.Errorf("failed to export app %s: %v", name, err)
+		}
+		artifact, err := s.state.AppArtifact(r.Context(), name, env.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get artifact of app %s: %v", name, err)
+		}
+		spec := &deployment.Spec{App: app, TargetEnv: env.Name, Artifact: artifact}
+		vars, err := s.infra.AppTFVarsFile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate variables of app %s: %v", name, err)
+		}
+		files[path.Join(dir, "terraform.tfvars")] = []byte(vars)
+	}
+
+	return tarball(files)
+}
+
+// exportTFModule reads the Terraform configuration, lock and state files of
+// a module into files, under the given directory.
+// The contents of configuration files are rewritten using the given replacer.
+func (s *server) exportTFModule(
+	dir, target string, rewriter *strings.Replacer, files map[string][]byte,
+) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		n := e.Name()
+		isConfig := filepath.Ext(n) == ".tf"
+		if e.IsDir() || !(isConfig || n == s.config.terraformStateFile || n == ".terraform.lock.hcl") {
+			continue
+		}
+
+		content, err := os.ReadFile(path.Join(dir, n))
+		if err != nil {
+			return err
+		}
+		if isConfig {
+			content = []byte(rewriter.Replace(string(content)))
+		}
+		files[path.Join(target, n)] = content
+	}
+	return nil
+}
+
+// tarball returns a gzipped tar archive of the given files.
+// It takes files as input - a map with file paths as keys and
+// their respective contents as values.
+func tarball(files map[string][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	names := make([]string, 0, len(files))
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		hdr := &tar.Header{Name: n, Mode: 0644, Size: int64(len(files[n]))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(files[n]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
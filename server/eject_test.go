@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/cloudfauj/cloudfauj/environment"
+	"github.com/gorilla/mux"
+)
+
+// failingWriter is a response writer whose client has gone away
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+func TestHandlerEjectEnvStatus(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     string
+		failWrite  bool
+		wantStatus string
+	}{
+		{"ejected", environment.StatusProvisioned, false, environment.StatusUnmanaged},
+		{"archive not sent", environment.StatusProvisioned, true, environment.StatusProvisioned},
+		{"ejected again", environment.StatusUnmanaged, false, environment.StatusUnmanaged},
+		{"ejected again, archive not sent", environment.StatusUnmanaged, true, environment.StatusUnmanaged},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestServer(t)
+			env := &environment.Environment{Name: "staging", Status: c.status, VpcCidr: "10.0.0.0/16"}
+			if err := s.state.CreateEnvironment(ctx, env); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(s.envTfDir(env.Name), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path.Join(s.envTfDir(env.Name), "main.tf"), []byte("# env"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			r := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/environment/staging/eject", nil), map[string]string{"name": env.Name})
+			rec := httptest.NewRecorder()
+			var w http.ResponseWriter = rec
+			if c.failWrite {
+				w = failingWriter{rec}
+			}
+			s.handlerEjectEnv(w, r)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got response %d, want %d", rec.Code, http.StatusOK)
+			}
+			e, err := s.state.Environment(ctx, env.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Status != c.wantStatus {
+				t.Errorf("env status is %s, want %s", e.Status, c.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandlerEjectEnvConflict(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	env := &environment.Environment{Name: "staging", Status: environment.StatusUpdating}
+	if err := s.state.CreateEnvironment(ctx, env); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/environment/staging/eject", nil), map[string]string{"name": env.Name})
+	rec := httptest.NewRecorder()
+	s.handlerEjectEnv(rec, r)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("got response %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
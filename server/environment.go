@@ -1,12 +1,16 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/cloudfauj/cloudfauj/environment"
+	"github.com/cloudfauj/cloudfauj/infrastructure"
 	"github.com/cloudfauj/cloudfauj/wsmanager"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
 	"net/http"
 	"os"
 	"path"
@@ -25,6 +29,95 @@ func (s *server) handlerListEnvironments(w http.ResponseWriter, r *http.Request)
 	_, _ = w.Write(jsonRes)
 }
 
+// EnvInfo describes an environment along with the infrastructure it runs on
+type EnvInfo struct {
+	*environment.Environment
+	// DNS name of the load balancer routing traffic to the env's apps
+	AlbDNSName string   `json:"alb_dns_name,omitempty"`
+	Apps       []string `json:"apps"`
+}
+
+func (s *server) handlerGetEnv(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	env, err := s.state.Environment(r.Context(), name)
+	if err != nil {
+		s.log.WithField("name", name).Errorf("Failed to fetch env from state: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if env == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	res := &EnvInfo{Environment: env}
+
+	res.Apps, err = s.state.ListApps(r.Context(), name)
+	if err != nil {
+		s.log.WithField("name", name).Errorf("Failed to list apps in env: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// The infrastructure of an unmanaged env is no longer tracked by Cloudfauj
+	if env.LoadBalancerEnabled() && env.Status != environment.StatusUnmanaged {
+		res.AlbDNSName, err = s.envALBDNSName(r.Context(), name)
+		if err != nil {
+			// the rest of the information is still useful, so only report the failure
+			s.log.WithField("name", name).Errorf("Failed to read env load balancer: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonRes, _ := json.Marshal(res)
+	_, _ = w.Write(jsonRes)
+}
+
+func (s *server) handlerListEnvApps(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	exists, err := s.state.CheckEnvExists(r.Context(), name)
+	if err != nil {
+		s.log.WithField("name", name).Errorf("Failed to check if env exists: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	apps, err := s.state.ListApps(r.Context(), name)
+	if err != nil {
+		s.log.WithField("name", name).Errorf("Failed to list apps in env: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res := []*AppInfo{}
+	for _, a := range apps {
+		info, err := s.appInfo(r.Context(), a, name)
+		if err != nil {
+			s.log.WithFields(logrus.Fields{"app": a, "env": name}).Errorf("Failed to fetch app info: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		res = append(res, info)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonRes, _ := json.Marshal(res)
+	_, _ = w.Write(jsonRes)
+}
+
+// envALBDNSName returns the DNS name of an environment's load balancer
+// from the env's Terraform state.
+func (s *server) envALBDNSName(ctx context.Context, env string) (string, error) {
+	tf, err := s.infra.NewTerraform(s.envTfDir(env), nil)
+	if err != nil {
+		return "", err
+	}
+	return s.infra.EnvALBDNSName(ctx, tf)
+}
+
 func (s *server) handlerCreateEnv(w http.ResponseWriter, r *http.Request) {
 	wsConn, err := s.wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -34,56 +127,129 @@ func (s *server) handlerCreateEnv(w http.ResponseWriter, r *http.Request) {
 	defer wsConn.Close()
 	conn := &wsmanager.WSManager{Conn: wsConn}
 
+	env, ok := s.readNewEnv(r.Context(), conn)
+	if !ok {
+		return
+	}
+	if env.Existing != nil {
+		conn.SendFailure(
+			"Use import to create an environment from existing resources",
+			websocket.CloseInvalidFramePayloadData,
+		)
+		return
+	}
+
+	s.log.WithField("name", env.Name).Info("Creating new environment")
+	s.provisionEnv(r.Context(), conn, env)
+}
+
+func (s *server) handlerImportEnv(w http.ResponseWriter, r *http.Request) {
+	wsConn, err := s.wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.log.Errorf("Failed to upgrade websocket connection: %v", err)
+		return
+	}
+	defer wsConn.Close()
+	conn := &wsmanager.WSManager{Conn: wsConn}
+
+	env, ok := s.readNewEnv(r.Context(), conn)
+	if !ok {
+		return
+	}
+	if env.Existing == nil {
+		conn.SendFailure(
+			"Existing resources to import must be specified",
+			websocket.CloseInvalidFramePayloadData,
+		)
+		return
+	}
+
+	conn.SendTextMsg("Verifying existing resources")
+	if err := s.infra.ValidateExistingResources(r.Context(), env.Existing); err != nil {
+		conn.SendFailure(
+			fmt.Sprintf("Invalid existing resources: %v", err),
+			websocket.ClosePolicyViolation,
+		)
+		return
+	}
+
+	s.log.WithField("name", env.Name).Info("Importing new environment")
+	s.provisionEnv(r.Context(), conn, env)
+}
+
+// readNewEnv reads the configuration of a new environment from the websocket
+// connection and validates it. If the configuration is not acceptable, it
+// sends the failure to the client and returns false.
+func (s *server) readNewEnv(ctx context.Context, conn *wsmanager.WSManager) (*environment.Environment, bool) {
 	var env *environment.Environment
 	if err := conn.ReadJSON(&env); err != nil {
 		s.log.Errorf("Failed to read environment config: %v", err)
 		conn.SendFailureISE()
-		return
+		return nil, false
 	}
 	if err := env.CheckIsValid(); err != nil {
 		conn.SendFailure(
 			fmt.Sprintf("Invalid environment config: %v", err),
 			websocket.CloseInvalidFramePayloadData,
 		)
-		return
+		return nil, false
 	}
 
-	ok, err := s.state.CheckEnvExists(r.Context(), env.Name)
+	ok, err := s.state.CheckEnvExists(ctx, env.Name)
 	if err != nil {
 		s.log.Errorf("Failed to check if env exists: %v", err)
 		conn.SendFailureISE()
-		return
+		return nil, false
 	}
 	if ok {
 		conn.SendFailure("Environment already exists", websocket.ClosePolicyViolation)
-		return
+		return nil, false
 	}
 
 	if env.DomainEnabled() {
-		exists, err := s.state.CheckDomainExists(r.Context(), env.Domain)
+		exists, err := s.state.CheckDomainExists(ctx, env.Domain)
 		if err != nil {
 			s.log.Errorf("Failed to check if domain to use for env exists: %v", err)
 			conn.SendFailureISE()
-			return
+			return nil, false
 		}
 		if !exists {
 			conn.SendFailure("Specified domain does not exist in the system", websocket.ClosePolicyViolation)
-			return
+			return nil, false
 		}
 	}
+	return env, true
+}
 
-	s.log.WithField("name", env.Name).Info("Creating new environment")
+// provisionEnv registers a new environment in state, generates its Terraform
+// configuration and provisions its infrastructure.
+func (s *server) provisionEnv(ctx context.Context, conn *wsmanager.WSManager, env *environment.Environment) {
+	if env.Existing == nil {
+		if err := s.allocateVpcCIDR(ctx, env); err != nil {
+			if errors.Is(err, infrastructure.ErrCIDRUnavailable) {
+				conn.SendFailure(err.Error(), websocket.ClosePolicyViolation)
+				return
+			}
+			s.log.Errorf("Failed to allocate VPC CIDR for env: %v", err)
+			conn.SendFailureISE()
+			return
+		}
+		conn.SendTextMsg("Reserved VPC CIDR " + env.VpcCidr)
+	}
 
 	env.Status = environment.StatusProvisioning
-	if err := s.state.CreateEnvironment(r.Context(), env); err != nil {
+	if err := s.state.CreateEnvironment(ctx, env); err != nil {
 		s.log.Errorf("Failed to store env info in state: %v", err)
+		if err := s.state.ReleaseVpcCIDR(ctx, env.Name); err != nil {
+			s.log.Errorf("Failed to release env VPC CIDR: %v", err)
+		}
 		conn.SendFailureISE()
 		return
 	}
 	conn.SendTextMsg("Registered in state")
 	conn.SendTextMsg("Generating Terraform configuration")
 
-	tfConfigs, err := s.infra.EnvTFConfig(r.Context(), env, s.domainTFStateFile(env.Domain))
+	tfConfigs, err := s.infra.EnvTFConfig(ctx, env, s.domainTFStateFile(env.Domain))
 	if err != nil {
 		s.log.Errorf("Failed to generate terraform configurations for env: %v", err)
 		conn.SendFailureISE()
@@ -109,15 +275,23 @@ func (s *server) handlerCreateEnv(w http.ResponseWriter, r *http.Request) {
 		conn.SendFailureISE()
 		return
 	}
-	err = s.infra.CreateEnvironment(r.Context(), tf)
+	err = s.infra.CreateEnvironment(ctx, tf)
 	if err != nil {
 		s.log.Errorf("Failed to provision environment: %v", err)
 		conn.SendFailureISE()
 		return
 	}
+	if env.LogRetention != 0 {
+		if err := s.infra.SetLogRetention(ctx, env.Name, env.LogRetention); err != nil {
+			s.log.Errorf("Failed to set env log retention: %v", err)
+			conn.SendFailureISE()
+			return
+		}
+		conn.SendTextMsg("Log retention set to " + logRetentionDesc(env.LogRetention))
+	}
 
 	env.Status = environment.StatusProvisioned
-	if err := s.state.UpdateEnvStatus(r.Context(), env.Name, env.Status); err != nil {
+	if err := s.state.UpdateEnvStatus(ctx, env.Name, env.Status); err != nil {
 		s.log.Errorf("Failed to update env info in state: %v", err)
 		conn.SendFailureISE()
 		return
@@ -146,6 +320,10 @@ func (s *server) handlerDestroyEnv(w http.ResponseWriter, r *http.Request) {
 		conn.SendFailure("Environment does not exist", websocket.ClosePolicyViolation)
 		return
 	}
+	if env.Status == environment.StatusUnmanaged {
+		s.removeUnmanagedEnv(r.Context(), conn, env)
+		return
+	}
 	if env.Status != environment.StatusProvisioned {
 		conn.SendFailure("Environment is not in provisioned state", websocket.ClosePolicyViolation)
 		return
@@ -165,6 +343,45 @@ func (s *server) handlerDestroyEnv(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
+	hasDatabases, err := s.envContainsDatabases(env.Name)
+	if err != nil {
+		s.log.Errorf("Failed to check if env contains databases: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if hasDatabases {
+		conn.SendFailure(
+			"Environment cannot be destroyed because it contains databases retained from destroyed applications",
+			websocket.ClosePolicyViolation,
+		)
+		return
+	}
+	hasVolumes, err := s.envContainsVolumes(env.Name)
+	if err != nil {
+		s.log.Errorf("Failed to check if env contains volumes: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if hasVolumes {
+		conn.SendFailure(
+			"Environment cannot be destroyed because it contains volumes retained from destroyed applications",
+			websocket.ClosePolicyViolation,
+		)
+		return
+	}
+	hasBuckets, err := s.envContainsBuckets(env.Name)
+	if err != nil {
+		s.log.Errorf("Failed to check if env contains buckets: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if hasBuckets {
+		conn.SendFailure(
+			"Environment cannot be destroyed because it contains buckets retained from destroyed applications",
+			websocket.ClosePolicyViolation,
+		)
+		return
+	}
 
 	s.log.WithField("name", envName).Info("Destroying environment")
 
@@ -198,10 +415,113 @@ func (s *server) handlerDestroyEnv(w http.ResponseWriter, r *http.Request) {
 		conn.SendFailureISE()
 		return
 	}
+	if err := s.state.ReleaseVpcCIDR(r.Context(), envName); err != nil {
+		s.log.Errorf("Failed to release env VPC CIDR: %v", err)
+		conn.SendFailureISE()
+		return
+	}
 
 	conn.SendSuccess("Environment destroyed successfully")
 }
 
+// allocateVpcCIDR reserves a CIDR for the VPC of a new environment.
+// If the env specifies a CIDR, it is reserved as long as it doesn't collide
+// with any CIDR already in use. Otherwise, one is allocated from the pool.
+func (s *server) allocateVpcCIDR(ctx context.Context, env *environment.Environment) error {
+	// Allocation is serialized so concurrently created envs never receive
+	// overlapping CIDRs.
+	s.cidrMu.Lock()
+	defer s.cidrMu.Unlock()
+
+	reserved, err := s.state.ListVpcCIDRReservations(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list reserved CIDRs: %v", err)
+	}
+	if env.VpcCidr != "" {
+		if err := s.infra.CheckCIDRAvailable(ctx, env.VpcCidr, reserved); err != nil {
+			return err
+		}
+	} else {
+		c, err := s.infra.NextAvailableCIDR(ctx, reserved)
+		if err != nil {
+			return err
+		}
+		env.VpcCidr = c
+	}
+	return s.state.ReserveVpcCIDR(ctx, env.Name, env.VpcCidr)
+}
+
+// backfillVpcCIDRs reserves the VPC CIDRs of environments created before CIDRs
+// were recorded in state, reading them from the environments' TF state.
+func (s *server) backfillVpcCIDRs(ctx context.Context) error {
+	envs, err := s.state.ListEnvironments(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list environments: %v", err)
+	}
+	for _, name := range envs {
+		env, err := s.state.Environment(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to get environment %s: %v", name, err)
+		}
+		// imported envs use an existing VPC, which Cloudfauj never allocates
+		if env == nil || env.Existing != nil || env.VpcCidr != "" {
+			continue
+		}
+		cidr, err := s.infra.EnvVpcCIDR(s.envTfStateFile(name))
+		if err != nil {
+			return fmt.Errorf("failed to read VPC CIDR of environment %s: %v", name, err)
+		}
+		if cidr == "" {
+			s.log.Warnf("VPC CIDR of environment %s could not be found in its TF state", name)
+			continue
+		}
+		if err := s.state.ReserveVpcCIDR(ctx, name, cidr); err != nil {
+			return fmt.Errorf("failed to reserve VPC CIDR of environment %s: %v", name, err)
+		}
+		s.log.WithField("name", name).Infof("Reserved VPC CIDR %s of existing environment", cidr)
+	}
+	return nil
+}
+
+// removeUnmanagedEnv removes an ejected environment and its apps from state.
+// Its infrastructure is not destroyed since it's no longer managed by Cloudfauj.
+func (s *server) removeUnmanagedEnv(
+	ctx context.Context, conn *wsmanager.WSManager, env *environment.Environment,
+) {
+	s.log.WithField("name", env.Name).Info("Removing unmanaged environment")
+	conn.SendTextMsg("Environment is unmanaged, removing it without destroying its infrastructure")
+
+	apps, err := s.state.ListApps(ctx, env.Name)
+	if err != nil {
+		s.log.Errorf("Failed to list apps in env: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	for _, app := range apps {
+		if err := s.state.DeleteApp(ctx, app, env.Name); err != nil {
+			s.log.Errorf("Failed to delete app from state: %v", err)
+			conn.SendFailureISE()
+			return
+		}
+	}
+	if err := os.RemoveAll(s.envTfDir(env.Name)); err != nil {
+		s.log.Errorf("Failed to delete env TF config from disk: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if err := s.state.DeleteEnvironment(ctx, env.Name); err != nil {
+		s.log.Errorf("Failed to delete env from state: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if err := s.state.ReleaseVpcCIDR(ctx, env.Name); err != nil {
+		s.log.Errorf("Failed to release env VPC CIDR: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	conn.SendSuccess("Environment removed successfully")
+}
+
 func (s *server) handlerTFPlanEnv(w http.ResponseWriter, r *http.Request) {
 	wsConn, err := s.wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/cloudfauj/cloudfauj/environment"
+	"github.com/cloudfauj/cloudfauj/infrastructure"
+	"github.com/cloudfauj/cloudfauj/state"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestServer returns a server with an in-memory state & a temporary data dir
+func newTestServer(t *testing.T) *server {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection to an in-memory database opens a new one
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	st := state.New(l, db)
+	if err := st.Migrate(context.Background()); err != nil {
+		t.Fatalf("failed to migrate state: %v", err)
+	}
+	return &server{config: NewConfig(t.TempDir()), log: l, state: st, infra: &infrastructure.Infrastructure{}}
+}
+
+func TestBackfillVpcCIDRs(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+
+	envs := []*environment.Environment{
+		{Name: "legacy", Status: environment.StatusProvisioned},
+		{Name: "no_state", Status: environment.StatusProvisioned},
+		{Name: "reserved", Status: environment.StatusProvisioned},
+		{
+			Name:     "imported",
+			Status:   environment.StatusProvisioned,
+			Existing: &environment.ExistingResources{VpcId: "vpc-1", SubnetIds: []string{"subnet-1"}},
+		},
+	}
+	for _, e := range envs {
+		if err := s.state.CreateEnvironment(ctx, e); err != nil {
+			t.Fatalf("failed to create env %s: %v", e.Name, err)
+		}
+	}
+	if err := s.state.ReserveVpcCIDR(ctx, "reserved", "10.2.0.0/16"); err != nil {
+		t.Fatal(err)
+	}
+	vpcState := `{"version": 4, "resources": [
+		{"mode": "managed", "type": "aws_vpc", "name": "main_vpc", "instances": [{"attributes": {"cidr_block": "10.1.0.0/16"}}]}
+	]}`
+	for _, env := range []string{"legacy", "imported"} {
+		if err := os.MkdirAll(s.envTfDir(env), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(s.envTfStateFile(env), []byte(vpcState), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.backfillVpcCIDRs(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"legacy": "10.1.0.0/16", "no_state": "", "reserved": "10.2.0.0/16", "imported": ""}
+	for name, cidr := range want {
+		e, err := s.state.Environment(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.VpcCidr != cidr {
+			t.Errorf("env %s has VPC CIDR %q, want %q", name, e.VpcCidr, cidr)
+		}
+	}
+
+	// running it again doesn't reserve anything twice
+	if err := s.backfillVpcCIDRs(ctx); err != nil {
+		t.Errorf("unexpected error on second run: %v", err)
+	}
+}
+
+func TestApplyEnvConfig(t *testing.T) {
+	current := func() *environment.Environment {
+		return &environment.Environment{
+			Name:         "staging",
+			Network:      environment.NetworkAWS,
+			Orchestrator: environment.OrchFargate,
+			VpcCidr:      "10.1.0.0/16",
+		}
+	}
+
+	cases := []struct {
+		name    string
+		env     func(*environment.Environment)
+		config  func(*environment.Environment)
+		wantMsg bool
+	}{
+		{"log retention", nil, func(c *environment.Environment) { c.LogRetention = 30 }, false},
+		{"same VPC CIDR", nil, func(c *environment.Environment) { c.VpcCidr = "10.1.0.0/16" }, false},
+		{"name", nil, func(c *environment.Environment) { c.Name = "production" }, true},
+		{"VPC CIDR", nil, func(c *environment.Environment) { c.VpcCidr = "10.2.0.0/16" }, true},
+		{"invalid log retention", nil, func(c *environment.Environment) { c.LogRetention = 8 }, true},
+		{
+			"no reserved VPC CIDR",
+			func(e *environment.Environment) { e.VpcCidr = "" },
+			func(c *environment.Environment) { c.VpcCidr = "" },
+			true,
+		},
+		{
+			"imported",
+			func(e *environment.Environment) {
+				e.VpcCidr = ""
+				e.Existing = &environment.ExistingResources{VpcId: "vpc-1", SubnetIds: []string{"subnet-1"}}
+			},
+			func(c *environment.Environment) { c.VpcCidr = "" },
+			false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			env, config := current(), current()
+			if c.env != nil {
+				c.env(env)
+			}
+			c.config(config)
+			if msg := applyEnvConfig(env, config); (msg != "") != c.wantMsg {
+				t.Errorf("applyEnvConfig() = %q, want message = %v", msg, c.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,456 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/deployment"
+	"github.com/cloudfauj/cloudfauj/environment"
+	"github.com/cloudfauj/cloudfauj/wsmanager"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+)
+
+// EnvUpdate describes the changes to make to an existing environment
+type EnvUpdate struct {
+	// New configuration of the environment. Settings that can't be changed
+	// must either be omitted or match the current configuration.
+	Config *environment.Environment `json:"config,omitempty"`
+
+	// Domain to attach to the environment. An empty value detaches the
+	// current domain, nil leaves it unchanged.
+	Domain *string `json:"domain,omitempty"`
+
+	// Only show the changes the update would make to the environment's
+	// infrastructure, without making them. The changes are saved and an
+	// update is only applied if its changes were planned this way.
+	Plan bool `json:"plan,omitempty"`
+}
+
+func (s *server) handlerUpdateEnv(w http.ResponseWriter, r *http.Request) {
+	wsConn, err := s.wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.log.Errorf("Failed to upgrade websocket connection: %v", err)
+		return
+	}
+	defer wsConn.Close()
+	conn := &wsmanager.WSManager{Conn: wsConn}
+
+	var u EnvUpdate
+	if err := conn.ReadJSON(&u); err != nil {
+		s.log.Errorf("Failed to read environment update: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+
+	// the env's TF configuration is regenerated while planning & applying,
+	// so no other update may touch it until this one finishes.
+	s.envUpdateMu.Lock()
+	defer s.envUpdateMu.Unlock()
+
+	envName := mux.Vars(r)["name"]
+	current, err := s.state.Environment(r.Context(), envName)
+	if err != nil {
+		s.log.Errorf("Failed to fetch env: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if current == nil {
+		conn.SendFailure("Environment does not exist", websocket.ClosePolicyViolation)
+		return
+	}
+	if current.Status != environment.StatusProvisioned {
+		conn.SendFailure("Environment is not in provisioned state", websocket.ClosePolicyViolation)
+		return
+	}
+
+	env := *current
+	if u.Config != nil {
+		if msg := applyEnvConfig(&env, u.Config); msg != "" {
+			conn.SendFailure(msg, websocket.CloseInvalidFramePayloadData)
+			return
+		}
+	}
+	if u.Domain != nil {
+		env.Domain = *u.Domain
+		// apps rely on the load balancer created along with the domain,
+		// so it is retained after the domain is detached.
+		if current.DomainEnabled() && !env.DomainEnabled() {
+			env.LoadBalancer = environment.LoadBalALB
+		}
+	}
+	if env == *current {
+		conn.SendSuccess("Nothing to update")
+		return
+	}
+
+	if env.Domain != current.Domain && env.DomainEnabled() {
+		exists, err := s.state.CheckDomainExists(r.Context(), env.Domain)
+		if err != nil {
+			s.log.Errorf("Failed to check if domain to use for env exists: %v", err)
+			conn.SendFailureISE()
+			return
+		}
+		if !exists {
+			conn.SendFailure("Specified domain does not exist in the system", websocket.ClosePolicyViolation)
+			return
+		}
+	}
+
+	if u.Plan {
+		s.log.WithField("name", env.Name).Info("Planning environment update")
+		if env.LogRetention != current.LogRetention {
+			conn.SendTextMsg(fmt.Sprintf(
+				"Log retention will change from %s to %s",
+				logRetentionDesc(current.LogRetention), logRetentionDesc(env.LogRetention),
+			))
+		}
+		s.planEnvUpdate(r.Context(), conn, &env)
+		return
+	}
+	s.log.WithField("name", env.Name).Info("Updating environment")
+	s.updateEnv(r.Context(), conn, current, &env)
+}
+
+// applyEnvConfig changes the configuration of an environment to the given one.
+// It returns a message describing why the new configuration is not acceptable,
+// or an empty string if it is.
+func applyEnvConfig(env, config *environment.Environment) string {
+	if config.Name != env.Name {
+		return "Environment name cannot be changed"
+	}
+	if config.Existing != nil && !reflect.DeepEqual(config.Existing, env.Existing) {
+		return "Existing resources of an environment cannot be changed"
+	}
+	if env.Existing == nil && env.VpcCidr == "" {
+		// the server records it from the environment's TF state on startup
+		return "VPC CIDR of the environment is unknown, restart the server to record it before updating"
+	}
+	if config.VpcCidr != "" && config.VpcCidr != env.VpcCidr {
+		return "VPC CIDR of an environment cannot be changed"
+	}
+	if config.Network != env.Network || config.PrivateCompute() != env.PrivateCompute() {
+		return "Network of an environment cannot be changed"
+	}
+	if config.Orchestrator != env.Orchestrator {
+		return "Orchestrator of an environment cannot be changed"
+	}
+
+	env.Domain = config.Domain
+	env.LoadBalancer = config.LoadBalancer
+	env.NatGateways = config.NatGateways
+	env.LogRetention = config.LogRetention
+	if err := env.CheckIsValid(); err != nil {
+		return fmt.Sprintf("Invalid environment config: %v", err)
+	}
+	return ""
+}
+
+// planEnvUpdate shows the changes an update would make to an environment's
+// infrastructure and saves them to be applied by updateEnv. The environment's
+// TF configuration is restored afterwards.
+func (s *server) planEnvUpdate(ctx context.Context, conn *wsmanager.WSManager, env *environment.Environment) {
+	_, msg, err := s.envAppSpecs(ctx, env)
+	if err != nil {
+		s.log.Errorf("Failed to fetch apps in env: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if msg != "" {
+		conn.SendFailure(msg, websocket.ClosePolicyViolation)
+		return
+	}
+
+	// deployments are refused while the env's TF configuration is regenerated
+	if err := s.state.UpdateEnvStatus(ctx, env.Name, environment.StatusUpdating); err != nil {
+		s.log.Errorf("Failed to update env status: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	defer func() {
+		if err := s.state.UpdateEnvStatus(ctx, env.Name, environment.StatusProvisioned); err != nil {
+			s.log.Errorf("Failed to update env status: %v", err)
+		}
+	}()
+	if err := s.discardEnvUpdatePlan(env.Name); err != nil {
+		s.log.Errorf("Failed to discard previous plan of env update: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+
+	dir := s.envTfDir(env.Name)
+	backup, err := s.generatedTFConfig(dir)
+	if err != nil {
+		s.log.Errorf("Failed to back up terraform configs for env: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	defer func() {
+		if err := s.regenerateTFConfig(dir, backup); err != nil {
+			s.log.Errorf("Failed to restore terraform configs for env: %v", err)
+		}
+	}()
+
+	tfConfigs, err := s.infra.EnvTFConfig(ctx, env, s.domainTFStateFile(env.Domain))
+	if err != nil {
+		s.log.Errorf("Failed to generate terraform configurations for env: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if err := s.regenerateTFConfig(dir, tfConfigs); err != nil {
+		s.log.Errorf("Failed to regenerate terraform configs for env: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	tf, err := s.infra.NewTerraform(dir, conn)
+	if err != nil {
+		s.log.Error(err)
+		conn.SendFailureISE()
+		return
+	}
+	if err := s.infra.PlanEnvUpdate(ctx, tf, s.envUpdatePlanFile(env.Name)); err != nil {
+		s.log.Errorf("Failed to plan environment update: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	config, _ := json.Marshal(env)
+	if err := os.WriteFile(s.envUpdateConfigFile(env.Name), config, 0666); err != nil {
+		s.log.Errorf("Failed to save env update config: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	conn.SendSuccess("Applications in the environment are reapplied after the update")
+}
+
+// updateEnv changes the infrastructure of an existing environment to match its
+// updated configuration, then reapplies all its applications so they pick up the change.
+func (s *server) updateEnv(
+	ctx context.Context, conn *wsmanager.WSManager, current, env *environment.Environment,
+) {
+	specs, msg, err := s.envAppSpecs(ctx, env)
+	if err != nil {
+		s.log.Errorf("Failed to fetch apps in env: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if msg != "" {
+		conn.SendFailure(msg, websocket.ClosePolicyViolation)
+		return
+	}
+
+	// only the changes shown to & confirmed by the user are applied
+	planned, err := s.envUpdatePlanConfig(env.Name)
+	if err != nil {
+		s.log.Errorf("Failed to read env update plan: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if planned == nil || !reflect.DeepEqual(planned, env) {
+		conn.SendFailure(
+			"This update hasn't been planned, plan it before applying",
+			websocket.ClosePolicyViolation,
+		)
+		return
+	}
+	// a plan can only be applied once, whether or not it succeeds
+	defer func() {
+		if err := s.discardEnvUpdatePlan(env.Name); err != nil {
+			s.log.Errorf("Failed to discard plan of env update: %v", err)
+		}
+	}()
+
+	if err := s.state.UpdateEnvStatus(ctx, env.Name, environment.StatusUpdating); err != nil {
+		s.log.Errorf("Failed to update env status: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	// the environment is usable again even if the update fails midway,
+	// since re-running it converges the infrastructure.
+	defer func() {
+		if err := s.state.UpdateEnvStatus(ctx, env.Name, environment.StatusProvisioned); err != nil {
+			s.log.Errorf("Failed to update env status: %v", err)
+		}
+	}()
+
+	// Apps stop using the env's load balancer or HTTPS listener before they're
+	// removed. In all other cases, apps are reapplied once the env is updated.
+	appsFirst := (current.DomainEnabled() && !env.DomainEnabled()) ||
+		(current.LoadBalancerEnabled() && !env.LoadBalancerEnabled())
+	if appsFirst {
+		if !s.reapplyApps(ctx, conn, env, specs) {
+			return
+		}
+	}
+
+	conn.SendTextMsg("Applying environment changes")
+	tfConfigs, err := s.infra.EnvTFConfig(ctx, env, s.domainTFStateFile(env.Domain))
+	if err != nil {
+		s.log.Errorf("Failed to generate terraform configurations for env: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	dir := s.envTfDir(env.Name)
+	if err := s.regenerateTFConfig(dir, tfConfigs); err != nil {
+		s.log.Errorf("Failed to regenerate terraform configs for env: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	tf, err := s.infra.NewTerraform(dir, conn)
+	if err != nil {
+		s.log.Error(err)
+		conn.SendFailureISE()
+		return
+	}
+	if err := s.infra.ApplyEnvPlan(ctx, tf, s.envUpdatePlanFile(env.Name)); err != nil {
+		s.log.Errorf("Failed to apply environment changes: %v", err)
+		conn.SendFailure(
+			"Failed to apply the planned changes, the environment may have changed since they were planned. Run the update again.",
+			websocket.CloseInternalServerErr,
+		)
+		return
+	}
+	if env.LogRetention != current.LogRetention {
+		if err := s.infra.SetLogRetention(ctx, env.Name, env.LogRetention); err != nil {
+			s.log.Errorf("Failed to set env log retention: %v", err)
+			conn.SendFailureISE()
+			return
+		}
+		conn.SendTextMsg("Log retention set to " + logRetentionDesc(env.LogRetention))
+	}
+	if err := s.state.UpdateEnvironment(ctx, env); err != nil {
+		s.log.Errorf("Failed to update env in state: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+
+	if !appsFirst {
+		if !s.reapplyApps(ctx, conn, env, specs) {
+			return
+		}
+	}
+	conn.SendSuccess("Successfully updated " + env.Name)
+}
+
+// envAppSpecs returns the deployment specs of all apps in an environment
+// with their last successfully deployed artifacts. Apps without a successful
+// deployment are skipped. If any app is not compatible with the environment's
+// configuration or its tasks don't fit Fargate, a message describing why is returned.
+func (s *server) envAppSpecs(
+	ctx context.Context, env *environment.Environment,
+) ([]*deployment.Spec, string, error) {
+	var res []*deployment.Spec
+
+	apps, err := s.state.ListApps(ctx, env.Name)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, name := range apps {
+		app, err := s.state.App(ctx, name, env.Name)
+		if err != nil {
+			return nil, "", err
+		}
+		msg, err := s.checkAppCompatible(ctx, env, app)
+		if err != nil || msg != "" {
+			return nil, fmt.Sprintf("App %s: %s", name, msg), err
+		}
+		// specs stored before task sizes were validated may not fit Fargate
+		if _, _, err := app.TaskSize(); err != nil {
+			return nil, fmt.Sprintf("App %s: %v. Deploy it with resources Fargate supports first.", name, err), nil
+		}
+
+		artifact, err := s.state.AppArtifact(ctx, name, env.Name)
+		if err != nil {
+			return nil, "", err
+		}
+		if artifact == "" {
+			continue
+		}
+		res = append(res, &deployment.Spec{App: app, TargetEnv: env.Name, Artifact: artifact})
+	}
+	return res, "", nil
+}
+
+// reapplyApps regenerates the TF configuration of the given apps for the
+// environment's configuration and applies it. It returns false if any app
+// failed, after sending the failure to the client.
+func (s *server) reapplyApps(
+	ctx context.Context, conn *wsmanager.WSManager, env *environment.Environment, specs []*deployment.Spec,
+) bool {
+	for _, spec := range specs {
+		conn.SendTextMsg("Applying changes to app " + spec.App.Name)
+
+		dir := s.appTfDir(env.Name, spec.App.Name)
+		if err := s.regenerateAppTFConfig(ctx, spec, env, dir); err != nil {
+			s.log.Errorf("Failed to regenerate terraform configs for app: %v", err)
+			conn.SendFailureISE()
+			return false
+		}
+		tf, err := s.infra.NewTerraform(dir, conn)
+		if err != nil {
+			s.log.Error(err)
+			conn.SendFailureISE()
+			return false
+		}
+		if err := s.infra.ModifyApplication(ctx, spec, tf); err != nil {
+			s.log.WithField("app", spec.App.Name).Errorf("Failed to apply app changes: %v", err)
+			conn.SendFailureISE()
+			return false
+		}
+	}
+	return true
+}
+
+// logRetentionDesc describes the log retention of an environment
+func logRetentionDesc(days int) string {
+	if days == 0 {
+		return "forever"
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+// envUpdatePlanConfig returns the configuration the pending update of an
+// environment was planned for, or nil if no update is pending.
+func (s *server) envUpdatePlanConfig(env string) (*environment.Environment, error) {
+	data, err := os.ReadFile(s.envUpdateConfigFile(env))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if _, err := os.Stat(s.envUpdatePlanFile(env)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var res environment.Environment
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// discardEnvUpdatePlan deletes the plan of the pending update of an environment
+func (s *server) discardEnvUpdatePlan(env string) error {
+	for _, f := range []string{s.envUpdatePlanFile(env), s.envUpdateConfigFile(env)} {
+		if err := os.Remove(f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *server) envUpdatePlanFile(env string) string {
+	return path.Join(s.envTfDir(env), s.config.envUpdatePlanFile)
+}
+
+func (s *server) envUpdateConfigFile(env string) string {
+	return path.Join(s.envTfDir(env), s.config.envUpdateConfigFile)
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/application"
+	"github.com/cloudfauj/cloudfauj/infrastructure"
+	"regexp"
+	"strings"
+)
+
+// checkAppIAM ensures that an application is only granted IAM actions allowed
+// by the server configuration. Actions denied by the app's statements are
+// always permitted. It returns a message describing the first disallowed
+// action, or an empty string if all are allowed.
+func (s *server) checkAppIAM(ctx context.Context, app *application.Application) (string, error) {
+	if app.IAM == nil {
+		return "", nil
+	}
+	allowed := s.config.IAMAllowedActions()
+
+	for _, st := range app.IAM.Statements {
+		if !st.Allows() {
+			continue
+		}
+		for _, a := range st.Actions {
+			if !iamActionAllowed(a, allowed) {
+				return fmt.Sprintf("IAM action %s is not allowed by the server", a), nil
+			}
+		}
+	}
+	for _, p := range app.IAM.Policies {
+		actions, err := s.infra.ManagedPolicyActions(ctx, p)
+		if err != nil {
+			if errors.Is(err, infrastructure.ErrPolicyNotFound) {
+				return "IAM policy " + p + " does not exist", nil
+			}
+			return "", err
+		}
+		for _, a := range actions {
+			if !iamActionAllowed(a, allowed) {
+				return fmt.Sprintf("IAM policy %s grants action %s, which is not allowed by the server", p, a), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// iamActionAllowed returns true if an action matches any of the allowed patterns.
+// Wildcards in the action itself are treated literally, so s3:Get* is only allowed
+// by patterns like s3:Get* or s3:*, not by s3:GetObject. Matching is case-insensitive
+// like IAM's.
+func iamActionAllowed(action string, allowed []string) bool {
+	for _, p := range allowed {
+		if iamPatternRegex(p).MatchString(action) {
+			return true
+		}
+	}
+	return false
+}
+
+func iamPatternRegex(pattern string) *regexp.Regexp {
+	// ? matches a single character of an action, but not a wildcard in it
+	r := strings.NewReplacer(`\*`, ".*", `\?`, "[^*?]").Replace(regexp.QuoteMeta(pattern))
+	return regexp.MustCompile("(?i)^" + r + "$")
+}
@@ -0,0 +1,60 @@
+package server
+
+import "testing"
+
+func TestIAMPatternRegex(t *testing.T) {
+	cases := []struct {
+		pattern, action string
+		match           bool
+	}{
+		{"s3:GetObject", "s3:GetObject", true},
+		{"s3:GetObject", "s3:getobject", true},
+		{"s3:GetObject", "s3:GetObjectAcl", false},
+		{"s3:Get*", "s3:GetObject", true},
+		{"s3:Get*", "s3:Get*", true},
+		{"s3:Get*", "s3:PutObject", false},
+		{"s3:*", "s3:*", true},
+		{"s3:*", "sqs:SendMessage", false},
+		{"*", "dynamodb:Query", true},
+		{"s3:?etObject", "s3:GetObject", true},
+		{"s3:?etObject", "s3:*etObject", false},
+		{"s3:?etObject", "s3:etObject", false},
+		// regex metacharacters in patterns are matched literally
+		{"s3:Get.bject", "s3:GetObject", false},
+		{"s3:Get(Object)", "s3:Get(Object)", true},
+	}
+	for _, c := range cases {
+		if got := iamPatternRegex(c.pattern).MatchString(c.action); got != c.match {
+			t.Errorf("pattern %s matches %s = %v, want %v", c.pattern, c.action, got, c.match)
+		}
+	}
+}
+
+func TestIAMActionAllowed(t *testing.T) {
+	allowed := []string{"s3:Get*", "s3:PutObject", "sqs:*"}
+
+	cases := []struct {
+		action  string
+		allowed bool
+	}{
+		{"s3:GetObject", true},
+		{"S3:GETOBJECT", true},
+		{"s3:Get*", true},
+		{"s3:PutObject", true},
+		{"s3:Put*", false},
+		{"s3:*", false},
+		{"s3:DeleteObject", false},
+		{"sqs:SendMessage", true},
+		{"sqs:*", true},
+		{"*", false},
+		{"sns:Publish", false},
+	}
+	for _, c := range cases {
+		if got := iamActionAllowed(c.action, allowed); got != c.allowed {
+			t.Errorf("iamActionAllowed(%s) = %v, want %v", c.action, got, c.allowed)
+		}
+	}
+	if iamActionAllowed("s3:GetObject", nil) {
+		t.Error("action allowed by an empty allowlist")
+	}
+}
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/environment"
+	"github.com/cloudfauj/cloudfauj/infrastructure"
+	"github.com/cloudfauj/cloudfauj/wsmanager"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+func (s *server) handlerAddEnvOverlay(w http.ResponseWriter, r *http.Request) {
+	wsConn, err := s.wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.log.Errorf("Failed to upgrade websocket connection: %v", err)
+		return
+	}
+	defer wsConn.Close()
+	conn := &wsmanager.WSManager{Conn: wsConn}
+
+	envName := mux.Vars(r)["name"]
+
+	var o *environment.Overlay
+	if err := conn.ReadJSON(&o); err != nil {
+		s.log.Errorf("Failed to read overlay: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if err := o.CheckIsValid(); err != nil {
+		conn.SendFailure(
+			fmt.Sprintf("Invalid overlay: %v", err),
+			websocket.CloseInvalidFramePayloadData,
+		)
+		return
+	}
+	if infrastructure.IsGeneratedTFFile(o.Name) {
+		conn.SendFailure(
+			o.Name+" is reserved for configuration generated by Cloudfauj",
+			websocket.ClosePolicyViolation,
+		)
+		return
+	}
+
+	env, err := s.state.Environment(r.Context(), envName)
+	if err != nil {
+		s.log.Errorf("Failed to fetch env: %v", err)
+		conn.SendFailureISE()
+		return
+	}
+	if env == nil {
+		conn.SendFailure("Environment does not exist", websocket.ClosePolicyViolation)
+		return
+	}
+	if env.Status != environment.StatusProvisioned {
+		conn.SendFailure("Environment is not in provisioned state", websocket.ClosePolicyViolation)
+		return
+	}
+
+	// Determine all Terraform modules the overlay needs to be installed in
+	targets := map[string]string{env.Name: s.envTfDir(env.Name)}
+	if o.Scope == environment.OverlayScopeApps {
+		apps, err := s.state.ListApps(r.Context(), env.Name)
+		if err != nil {
+			s.log.Errorf("Failed to list apps in env: %v", err)
+			conn.SendFailureISE()
+			return
+		}
+		targets = make(map[string]string)
+		for _, app := range apps {
+			targets[app] = s.appTfDir(env.Name, app)
+		}
+		if len(targets) == 0 {
+			conn.SendTextMsg("Environment has no applications yet, overlay will be validated on their first deployment")
+		}
+	}
+
+	s.log.WithField("env", env.Name).Info("Adding Terraform overlay " + o.Name)
+
+	// Install the overlay in every target module, validating each one.
+	// If any of them fails, roll back all installations made so far.
+	var restores []func() error
+	rollback := func() {
+		for _, restore := range restores {
+			if err := restore(); err != nil {
+				s.log.Errorf("Failed to roll back overlay: %v", err)
+			}
+		}
+	}
+	for target, dir := range targets {
+		restore, err := s.writeOverlay(dir, o)
+		if err != nil {
+			s.log.Errorf("Failed to write overlay: %v", err)
+			rollback()
+			conn.SendFailureISE()
+			return
+		}
+		restores = append(restores, restore)
+
+		conn.SendTextMsg("Validating overlay against " + target)
+		tf, err := s.infra.NewTerraform(dir, conn)
+		if err != nil {
+			s.log.Error(err)
+			rollback()
+			conn.SendFailureISE()
+			return
+		}
+		if err := s.infra.ValidateTFConfig(r.Context(), tf); err != nil {
+			rollback()
+			conn.SendFailure(
+				fmt.Sprintf("Overlay rejected for %s: %v", target, err),
+				websocket.ClosePolicyViolation,
+			)
+			return
+		}
+	}
+
+	if o.Scope == environment.OverlayScopeEnv {
+		conn.SendSuccess("Overlay added, run tf apply over the environment to apply it")
+		return
+	}
+
+	// Store app overlays so they are installed in apps created in future
+	if err := os.MkdirAll(s.appOverlaysDir(env.Name), 0755); err != nil {
+		s.log.Errorf("Failed to create app overlays directory: %v", err)
+		rollback()
+		conn.SendFailureISE()
+		return
+	}
+	if err := s.writeFiles(s.appOverlaysDir(env.Name), map[string]string{o.Name: o.Content}); err != nil {
+		s.log.Errorf("Failed to store app overlay: %v", err)
+		rollback()
+		conn.SendFailureISE()
+		return
+	}
+	conn.SendSuccess("Overlay added, it will be applied to apps on their next deployment")
+}
+
+func (s *server) handlerListEnvOverlays(w http.ResponseWriter, r *http.Request) {
+	envName := mux.Vars(r)["name"]
+
+	exists, err := s.state.CheckEnvExists(r.Context(), envName)
+	if err != nil {
+		s.log.Errorf("Failed to check if env exists: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	res := []*environment.Overlay{}
+	scopes := map[string]string{
+		environment.OverlayScopeEnv:  s.envTfDir(envName),
+		environment.OverlayScopeApps: s.appOverlaysDir(envName),
+	}
+	for scope, dir := range scopes {
+		names, err := s.overlayFiles(dir)
+		if err != nil {
+			s.log.Errorf("Failed to read overlays: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for _, n := range names {
+			res = append(res, &environment.Overlay{Name: n, Scope: scope})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jsonRes, _ := json.Marshal(res)
+	_, _ = w.Write(jsonRes)
+}
+
+func (s *server) handlerDeleteEnvOverlay(w http.ResponseWriter, r *http.Request) {
+	envName := mux.Vars(r)["name"]
+	name := mux.Vars(r)["file"]
+	scope := r.URL.Query().Get("scope")
+
+	if environment.CheckOverlayName(name) != nil || infrastructure.IsGeneratedTFFile(name) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	exists, err := s.state.CheckEnvExists(r.Context(), envName)
+	if err != nil {
+		s.log.Errorf("Failed to check if env exists: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	files := []string{path.Join(s.envTfDir(envName), name)}
+	if scope == environment.OverlayScopeApps {
+		apps, err := s.state.ListApps(r.Context(), envName)
+		if err != nil {
+			s.log.Errorf("Failed to list apps in env: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		files = []string{path.Join(s.appOverlaysDir(envName), name)}
+		for _, app := range apps {
+			files = append(files, path.Join(s.appTfDir(envName, app), name))
+		}
+	}
+
+	// The overlay must exist in the main location for its scope
+	if _, err := os.Stat(files[0]); errors.Is(err, fs.ErrNotExist) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			s.log.Errorf("Failed to delete overlay: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.log.WithField("env", envName).Info("Deleted Terraform overlay " + name)
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeOverlay writes an overlay file inside a Terraform module directory.
+// It returns a function that restores the file to its previous state.
+func (s *server) writeOverlay(dir string, o *environment.Overlay) (func() error, error) {
+	f := path.Join(dir, o.Name)
+
+	prev, err := os.ReadFile(f)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	existed := err == nil
+	restore := func() error {
+		if existed {
+			return os.WriteFile(f, prev, 0666)
+		}
+		return os.Remove(f)
+	}
+
+	if err := os.WriteFile(f, []byte(o.Content), 0666); err != nil {
+		return nil, err
+	}
+	return restore, nil
+}
+
+// overlayFiles returns the names of all overlays present in a directory.
+// Any file that is not generated by Cloudfauj is considered an overlay.
+func (s *server) overlayFiles(dir string) ([]string, error) {
+	var res []string
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return res, nil
+		}
+		return res, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".tf" || infrastructure.IsGeneratedTFFile(e.Name()) {
+			continue
+		}
+		res = append(res, e.Name())
+	}
+	return res, nil
+}
+
+// appOverlays returns all overlays to be installed in the applications of
+// an environment, keyed by their file names.
+func (s *server) appOverlays(env string) (map[string]string, error) {
+	res := make(map[string]string)
+
+	names, err := s.overlayFiles(s.appOverlaysDir(env))
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		content, err := os.ReadFile(path.Join(s.appOverlaysDir(env), n))
+		if err != nil {
+			return nil, err
+		}
+		res[n] = string(content)
+	}
+	return res, nil
+}
+
+func (s *server) appOverlaysDir(env string) string {
+	return path.Join(s.envTfDir(env), s.config.appOverlaysDir)
+}
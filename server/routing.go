@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/application"
+	"github.com/cloudfauj/cloudfauj/environment"
+	"strings"
+)
+
+// checkAppRouting ensures that an application's custom routing can be set up
+// in the target environment. It returns a message describing why the routing
+// is not acceptable, or an empty string if it is.
+func (s *server) checkAppRouting(
+	ctx context.Context, env *environment.Environment, app *application.Application,
+) (string, error) {
+	if app.Routing == nil {
+		return "", nil
+	}
+	if !env.LoadBalancerEnabled() {
+		return "Custom routing requires the environment to have a load balancer", nil
+	}
+	if env.DomainEnabled() && len(app.Routing.Hostnames) == 0 {
+		return "Paths can only be routed on custom hostnames in a domain-enabled environment", nil
+	}
+	if !env.DomainEnabled() && len(app.Routing.Hostnames) > 0 {
+		return "Hostnames can only be routed in a domain-enabled environment", nil
+	}
+
+	domains, err := s.hostnameDomains(ctx, app.Routing.Hostnames)
+	if err != nil {
+		return "", err
+	}
+	for _, h := range app.Routing.Hostnames {
+		if domains[h] == "" {
+			return fmt.Sprintf("Hostname %s does not belong to any domain in the system", h), nil
+		}
+	}
+
+	routes := append(app.Routing.Routes(), defaultAppRoute(env, app.Name))
+	first, last := priorityRange(app.Routing)
+
+	apps, err := s.state.ListApps(ctx, env.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to list apps in env: %v", err)
+	}
+	for _, name := range apps {
+		if name == app.Name {
+			continue
+		}
+		other, err := s.state.App(ctx, name, env.Name)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch app %s: %v", name, err)
+		}
+
+		claimed := []application.Route{defaultAppRoute(env, name)}
+		if other.Routing != nil {
+			claimed = append(claimed, other.Routing.Routes()...)
+
+			otherFirst, otherLast := priorityRange(other.Routing)
+			if first > 0 && otherFirst > 0 && first <= otherLast && otherFirst <= last {
+				return fmt.Sprintf(
+					"Listener rule priorities %d-%d overlap with those of app %s", first, last, name,
+				), nil
+			}
+		}
+		for _, r := range routes {
+			for _, c := range claimed {
+				if r.Conflicts(c) {
+					return fmt.Sprintf("Route %s conflicts with route %s of app %s", r, c, name), nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// hostnameDomainInfo returns the TF state file & DNS service of the domain
+// each given hostname belongs to.
+func (s *server) hostnameDomainInfo(
+	ctx context.Context, hostnames []string,
+) (map[string]string, map[string]string, error) {
+	domains, err := s.hostnameDomains(ctx, hostnames)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, services := make(map[string]string), make(map[string]string)
+	for h, d := range domains {
+		files[h] = s.domainTFStateFile(d)
+		if services[h], err = s.domainDNSService(ctx, d); err != nil {
+			return nil, nil, err
+		}
+	}
+	return files, services, nil
+}
+
+// hostnameDomains returns the domain each given hostname belongs to.
+// If a hostname belongs to multiple domains, the most specific one is chosen.
+// Hostnames not belonging to any domain in the system are mapped to an empty string.
+func (s *server) hostnameDomains(ctx context.Context, hostnames []string) (map[string]string, error) {
+	res := make(map[string]string)
+	if len(hostnames) == 0 {
+		return res, nil
+	}
+
+	domains, err := s.state.ListDomains(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %v", err)
+	}
+	for _, h := range hostnames {
+		res[h] = ""
+		for _, d := range domains {
+			if (h == d || strings.HasSuffix(h, "."+d)) && len(d) > len(res[h]) {
+				res[h] = d
+			}
+		}
+	}
+	return res, nil
+}
+
+// defaultAppRoute returns the route an application is always reachable at
+// in an environment with a load balancer.
+func defaultAppRoute(env *environment.Environment, app string) application.Route {
+	if env.DomainEnabled() {
+		return application.Route{Host: env.Name + "-" + app + "." + env.Domain}
+	}
+	return application.Route{Path: "/" + app}
+}
+
+// priorityRange returns the first & last listener rule priorities used by
+// an application's custom routes. Both are 0 if priorities are auto-assigned.
+func priorityRange(r *application.Routing) (int, int) {
+	if r.Priority == 0 {
+		return 0, 0
+	}
+	return r.Priority, r.Priority + len(r.Routes()) - 1
+}
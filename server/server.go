@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"github.com/cloudfauj/cloudfauj/infrastructure"
 	"github.com/cloudfauj/cloudfauj/state"
 	"github.com/gorilla/mux"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"sync"
 )
 
 const ApiV1Prefix = "/v1"
@@ -26,6 +28,11 @@ type server struct {
 	state      state.State
 	wsUpgrader *websocket.Upgrader
 	*mux.Router
+
+	// cidrMu serializes VPC CIDR allocation
+	cidrMu sync.Mutex
+	// envUpdateMu serializes planning & applying environment updates
+	envUpdateMu sync.Mutex
 }
 
 func New(c *Config, l *logrus.Logger, s state.State, i *infrastructure.Infrastructure) http.Handler {
@@ -41,6 +48,16 @@ func New(c *Config, l *logrus.Logger, s state.State, i *infrastructure.Infrastru
 	return srv
 }
 
+// BackfillState records information in state that older versions of the server
+// didn't, from the TF state of the resources they created. It must run before
+// the server starts handling requests.
+func BackfillState(
+	ctx context.Context, c *Config, l *logrus.Logger, s state.State, i *infrastructure.Infrastructure,
+) error {
+	srv := &server{config: c, log: l, infra: i, state: s}
+	return srv.backfillVpcCIDRs(ctx)
+}
+
 func setupV1Routes(s *server) {
 	r := s.Router.PathPrefix(ApiV1Prefix).Subrouter()
 
@@ -50,8 +67,12 @@ func setupV1Routes(s *server) {
 	r.HandleFunc("/domains", s.handlerListDomains).Methods(http.MethodGet)
 
 	ar := r.PathPrefix("/app").Subrouter()
-	ar.HandleFunc("/{name}", s.handlerDestroyApp).Methods(http.MethodDelete)
 	ar.HandleFunc("/deploy", s.handlerDeployApp)
+	ar.HandleFunc("/logs", s.handlerGetAppLogs)
+	ar.HandleFunc("/exec", s.handlerExecApp)
+	ar.HandleFunc("/{name}", s.handlerGetApp).Methods(http.MethodGet)
+	ar.HandleFunc("/{name}", s.handlerDestroyApp).Methods(http.MethodDelete)
+	ar.HandleFunc("/{name}/status", s.handlerGetAppStatus).Methods(http.MethodGet)
 
 	dr := r.PathPrefix("/deployment").Subrouter()
 	dr.HandleFunc("/{id}", s.handlerGetDeployment).Methods(http.MethodGet)
@@ -62,12 +83,21 @@ func setupV1Routes(s *server) {
 	//  since they're same except for TF action.
 	er := r.PathPrefix("/environment").Subrouter()
 	er.HandleFunc("/create", s.handlerCreateEnv)
+	er.HandleFunc("/import", s.handlerImportEnv)
+	er.HandleFunc("/{name}", s.handlerGetEnv).Methods(http.MethodGet)
+	er.HandleFunc("/{name}/apps", s.handlerListEnvApps).Methods(http.MethodGet)
 	er.HandleFunc("/{name}/destroy", s.handlerDestroyEnv)
+	er.HandleFunc("/{name}/update", s.handlerUpdateEnv)
 	er.HandleFunc("/{name}/plan", s.handlerTFPlanEnv)
 	er.HandleFunc("/{name}/apply", s.handlerTFApplyEnv)
+	er.HandleFunc("/{name}/eject", s.handlerEjectEnv).Methods(http.MethodPost)
+	er.HandleFunc("/{name}/overlays", s.handlerListEnvOverlays).Methods(http.MethodGet)
+	er.HandleFunc("/{name}/overlay/add", s.handlerAddEnvOverlay)
+	er.HandleFunc("/{name}/overlay/{file}", s.handlerDeleteEnvOverlay).Methods(http.MethodDelete)
 
 	dmr := r.PathPrefix("/domain").Subrouter()
 	dmr.HandleFunc("/add", s.handlerAddDomain)
+	dmr.HandleFunc("/{name}", s.handlerGetDomain).Methods(http.MethodGet)
 	dmr.HandleFunc("/{name}/delete", s.handlerDeleteDomain)
 	dmr.HandleFunc("/{name}/plan", s.handlerTFPlanDomain)
 	dmr.HandleFunc("/{name}/apply", s.handlerTFApplyDomain)
@@ -80,10 +110,15 @@ func (s *server) handlerGetHealthcheck(w http.ResponseWriter, r *http.Request) {
 // writeFiles writes a set of files inside a target directory.
 // It takes files as input - a map with filenames as keys and
 // their respective contents as values.
+// Files containing secrets are only readable by the server.
 func (s *server) writeFiles(dir string, files map[string]string) error {
 	for fName, data := range files {
 		filepath := path.Join(dir, fName)
-		if err := os.WriteFile(filepath, []byte(data), 0666); err != nil {
+		perm := os.FileMode(0666)
+		if infrastructure.IsSensitiveFile(fName) {
+			perm = 0600
+		}
+		if err := os.WriteFile(filepath, []byte(data), perm); err != nil {
 			return err
 		}
 	}
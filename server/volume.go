@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudfauj/cloudfauj/deployment"
+	"github.com/cloudfauj/cloudfauj/infrastructure"
+	"github.com/cloudfauj/cloudfauj/wsmanager"
+	"os"
+	"path"
+)
+
+// applyAppVolumes provisions the volumes of an application, or applies changes
+// to their configuration. Volumes no longer in the app's config are retained
+// along with their data.
+func (s *server) applyAppVolumes(ctx context.Context, conn *wsmanager.WSManager, spec *deployment.Spec) error {
+	existing, err := s.appVolumes(spec.TargetEnv, spec.App.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list app volumes: %v", err)
+	}
+	configured := make(map[string]bool)
+
+	for _, v := range spec.App.Volumes {
+		configured[v.Name] = true
+		dir := s.volumeTfDir(spec.TargetEnv, spec.App.Name, v.Name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory for volume %s: %v", v.Name, err)
+		}
+		tfConfigs := s.infra.VolumeTFConfig(&infrastructure.VolumeTFConfigInput{
+			Volume:         v,
+			App:            spec.App.Name,
+			Env:            spec.TargetEnv,
+			EnvTFStateFile: s.envTfStateFile(spec.TargetEnv),
+		})
+		if err := s.writeFiles(dir, tfConfigs); err != nil {
+			return fmt.Errorf("failed to write terraform configs for volume %s: %v", v.Name, err)
+		}
+
+		tf, err := s.infra.NewTerraform(dir, conn)
+		if err != nil {
+			return err
+		}
+		conn.SendTextMsg("Provisioning volume " + v.Name)
+		if err := s.infra.ApplyVolume(ctx, tf); err != nil {
+			return fmt.Errorf("failed to provision volume %s: %v", v.Name, err)
+		}
+	}
+
+	for _, name := range existing {
+		if !configured[name] {
+			conn.SendTextMsg(fmt.Sprintf(
+				"Volume %s is no longer configured, it is retained until the app is destroyed with --delete-data",
+				name,
+			))
+		}
+	}
+	return nil
+}
+
+// destroyAppVolumes deletes all volumes provisioned for an application,
+// including their data.
+func (s *server) destroyAppVolumes(ctx context.Context, env, app string) error {
+	names, err := s.appVolumes(env, app)
+	if err != nil {
+		return fmt.Errorf("failed to list app volumes: %v", err)
+	}
+	for _, name := range names {
+		tf, err := s.infra.NewTerraform(s.volumeTfDir(env, app, name), nil)
+		if err != nil {
+			return err
+		}
+		if err := s.infra.DestroyVolume(ctx, tf); err != nil {
+			return fmt.Errorf("failed to destroy volume %s: %v", name, err)
+		}
+		if err := os.RemoveAll(s.volumeTfDir(env, app, name)); err != nil {
+			return fmt.Errorf("failed to delete TF config of volume %s from disk: %v", name, err)
+		}
+	}
+	return os.RemoveAll(path.Join(s.volumesTfDir(env), app))
+}
+
+// appVolumes returns the names of all volumes provisioned for an application,
+// including those retained after being removed from its config or after the
+// app was destroyed.
+func (s *server) appVolumes(env, app string) ([]string, error) {
+	return subDirs(path.Join(s.volumesTfDir(env), app))
+}
+
+// envContainsVolumes returns true if volumes of any app, including
+// destroyed ones, exist in an environment.
+func (s *server) envContainsVolumes(env string) (bool, error) {
+	apps, err := subDirs(s.volumesTfDir(env))
+	return len(apps) > 0, err
+}
+
+// volumeTFStateFiles returns the TF state files of an application's volumes, keyed by name
+func (s *server) volumeTFStateFiles(spec *deployment.Spec) map[string]string {
+	res := make(map[string]string)
+	for _, v := range spec.App.Volumes {
+		res[v.Name] = s.volumeTfStateFile(spec.TargetEnv, spec.App.Name, v.Name)
+	}
+	return res
+}
+
+func (s *server) volumesTfDir(env string) string {
+	return path.Join(s.envTfDir(env), s.config.volumesDir)
+}
+
+func (s *server) volumeTfDir(env, app, volume string) string {
+	return path.Join(s.volumesTfDir(env), app, volume)
+}
+
+func (s *server) volumeTfStateFile(env, app, volume string) string {
+	return path.Join(s.volumeTfDir(env, app, volume), s.config.terraformStateFile)
+}
@@ -3,7 +3,9 @@ package state
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"github.com/cloudfauj/cloudfauj/application"
+	"strings"
 )
 
 const sqlCreateAppTable = `CREATE TABLE IF NOT EXISTS applications (
@@ -16,20 +18,36 @@ const sqlCreateAppTable = `CREATE TABLE IF NOT EXISTS applications (
 	cpu INT NOT NULL,
 	memory INT NOT NULL,
 	bind_port INT NOT NULL,
+	ephemeral_storage INTEGER NOT NULL DEFAULT 0,
+	artifact VARCHAR(500) NOT NULL DEFAULT '',
+	routing TEXT NOT NULL DEFAULT '',
+	health_check TEXT NOT NULL DEFAULT '',
+	target_group TEXT NOT NULL DEFAULT '',
+	container_health_check TEXT NOT NULL DEFAULT '',
+	iam TEXT NOT NULL DEFAULT '',
+	databases TEXT NOT NULL DEFAULT '',
+	buckets TEXT NOT NULL DEFAULT '',
+	queues TEXT NOT NULL DEFAULT '',
+	volumes TEXT NOT NULL DEFAULT '',
+	sidecars TEXT NOT NULL DEFAULT '',
 	UNIQUE(name, env)
 )`
 
 func (s *state) CreateApp(ctx context.Context, app *application.Application, env string) error {
-	q := `INSERT INTO applications(
-	name, env, type, visibility, health_path, cpu, memory, bind_port
-) VALUES(?, ?, ?, ?, ?, ?, ?, ?)`
+	cols := appJSONColumns(app)
+	q := fmt.Sprintf(`INSERT INTO applications(
+	name, env, type, visibility, health_path, cpu, memory, bind_port, ephemeral_storage, %s
+) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?%s)`, cols.names(", "), strings.Repeat(", ?", len(cols)))
 
 	stmt, err := s.db.PrepareContext(ctx, q)
 	if err != nil {
 		return err
 	}
-	_, err = stmt.ExecContext(
-		ctx,
+	values, err := cols.marshal()
+	if err != nil {
+		return err
+	}
+	args := []interface{}{
 		app.Name,
 		env,
 		app.Type,
@@ -38,7 +56,9 @@ func (s *state) CreateApp(ctx context.Context, app *application.Application, env
 		app.Resources.Cpu,
 		app.Resources.Memory,
 		app.Resources.Network.BindPort,
-	)
+		app.Resources.EphemeralStorage,
+	}
+	_, err = stmt.ExecContext(ctx, append(args, values...)...)
 	if err != nil {
 		return err
 	}
@@ -46,31 +66,38 @@ func (s *state) CreateApp(ctx context.Context, app *application.Application, env
 }
 
 func (s *state) UpdateApp(ctx context.Context, app *application.Application, env string) error {
-	q := `UPDATE applications
+	cols := appJSONColumns(app)
+	q := fmt.Sprintf(`UPDATE applications
 SET
 	type = ?,
 	visibility = ?,
 	health_path = ?,
 	cpu = ?,
 	memory = ?,
-	bind_port = ?
-WHERE name = ? AND env = ?`
+	bind_port = ?,
+	ephemeral_storage = ?,
+	%s = ?
+WHERE name = ? AND env = ?`, cols.names(" = ?,\n\t"))
 
 	stmt, err := s.db.PrepareContext(ctx, q)
 	if err != nil {
 		return err
 	}
-	_, err = stmt.ExecContext(
-		ctx,
+	values, err := cols.marshal()
+	if err != nil {
+		return err
+	}
+	args := []interface{}{
 		app.Type,
 		app.Visibility,
 		app.HealthCheck.Path,
 		app.Resources.Cpu,
 		app.Resources.Memory,
 		app.Resources.Network.BindPort,
-		app.Name,
-		env,
-	)
+		app.Resources.EphemeralStorage,
+	}
+	args = append(append(args, values...), app.Name, env)
+	_, err = stmt.ExecContext(ctx, args...)
 	if err != nil {
 		return err
 	}
@@ -86,9 +113,13 @@ func (s *state) App(ctx context.Context, name, env string) (*application.Applica
 		HealthCheck: &application.HealthCheck{},
 		Resources:   &application.Resources{Network: &application.Network{}},
 	}
-	err := s.db.QueryRowContext(
-		ctx, "SELECT * FROM applications WHERE name = ? AND env = ?", name, env,
-	).Scan(
+	cols := appJSONColumns(a)
+	q := fmt.Sprintf(`SELECT
+	id, name, env, type, visibility, health_path, cpu, memory, bind_port, ephemeral_storage, %s
+FROM applications WHERE name = ? AND env = ?`, cols.names(", "))
+
+	values := make([]string, len(cols))
+	dest := []interface{}{
 		&id,
 		&a.Name,
 		&e,
@@ -98,7 +129,13 @@ func (s *state) App(ctx context.Context, name, env string) (*application.Applica
 		&a.Resources.Cpu,
 		&a.Resources.Memory,
 		&a.Resources.Network.BindPort,
-	)
+		&a.Resources.EphemeralStorage,
+	}
+	for j := range values {
+		dest = append(dest, &values[j])
+	}
+
+	err := s.db.QueryRowContext(ctx, q, name, env).Scan(dest...)
 	if err != nil {
 		// return nil response without any error if no such app found
 		if err == sql.ErrNoRows {
@@ -106,9 +143,77 @@ func (s *state) App(ctx context.Context, name, env string) (*application.Applica
 		}
 		return nil, err
 	}
+	if err := cols.unmarshal(values); err != nil {
+		return nil, err
+	}
 	return a, nil
 }
 
+// appJSONColumns returns the TEXT columns holding an application's settings
+// as JSON. Settings not stored in a column of their own are added here.
+func appJSONColumns(a *application.Application) jsonColumns {
+	return jsonColumns{
+		{"routing", &a.Routing},
+		// health_check holds all settings including the path, for apps
+		// deployed before it was introduced only health_path is populated
+		{"health_check", a.HealthCheck},
+		{"target_group", &a.TargetGroup},
+		{"container_health_check", &a.ContainerHealthCheck},
+		{"iam", &a.IAM},
+		{"databases", &a.Databases},
+		{"buckets", &a.Buckets},
+		{"queues", &a.Queues},
+		{"volumes", &a.Volumes},
+		{"sidecars", &a.Sidecars},
+	}
+}
+
+// AppArtifact returns the artifact last deployed successfully for an application
+func (s *state) AppArtifact(ctx context.Context, name, env string) (string, error) {
+	var res string
+	err := s.db.QueryRowContext(
+		ctx, "SELECT artifact FROM applications WHERE name = ? AND env = ?", name, env,
+	).Scan(&res)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return res, err
+}
+
+func (s *state) UpdateAppArtifact(ctx context.Context, name, env, artifact string) error {
+	q := "UPDATE applications SET artifact = ? WHERE name = ? AND env = ?"
+	stmt, err := s.db.PrepareContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, artifact, name, env)
+	return err
+}
+
+// ListApps returns names of all applications in the given environment
+func (s *state) ListApps(ctx context.Context, env string) ([]string, error) {
+	var res []string
+
+	rows, err := s.db.QueryContext(ctx, "SELECT name FROM applications WHERE env = ?", env)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return res, err
+		}
+		res = append(res, name)
+	}
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
 func (s *state) DeleteApp(ctx context.Context, name, env string) error {
 	_, err := s.db.ExecContext(ctx, "DELETE FROM applications WHERE name = ? AND env = ?", name, env)
 	return err
@@ -0,0 +1,41 @@
+package state
+
+import (
+	"context"
+)
+
+const sqlCreateVpcCIDRTable = `CREATE TABLE IF NOT EXISTS vpc_cidr_reservations (
+	cidr VARCHAR(50) NOT NULL PRIMARY KEY,
+	env VARCHAR(100) NOT NULL UNIQUE
+)`
+
+func (s *state) ReserveVpcCIDR(ctx context.Context, env, cidr string) error {
+	_, err := s.db.ExecContext(
+		ctx, "INSERT INTO vpc_cidr_reservations(cidr, env) VALUES(?, ?)", cidr, env,
+	)
+	return err
+}
+
+func (s *state) ReleaseVpcCIDR(ctx context.Context, env string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM vpc_cidr_reservations WHERE env = ?", env)
+	return err
+}
+
+func (s *state) ListVpcCIDRReservations(ctx context.Context) ([]string, error) {
+	var res []string
+
+	rows, err := s.db.QueryContext(ctx, "SELECT cidr FROM vpc_cidr_reservations")
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return res, err
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
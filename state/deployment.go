@@ -53,6 +53,25 @@ func (s *state) ListDeployments(ctx context.Context, status string) ([]*deployme
 	return res, err
 }
 
+// LatestAppDeployment returns the most recent deployment of an application
+// in an environment, irrespective of its status.
+func (s *state) LatestAppDeployment(ctx context.Context, app, env string) (*deployment.Deployment, error) {
+	var d deployment.Deployment
+
+	err := s.db.QueryRowContext(
+		ctx, "SELECT * FROM deployments WHERE app = ? AND env = ? ORDER BY id DESC LIMIT 1", app, env,
+	).Scan(
+		&d.Id, &d.App, &d.Environment, &d.Status,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
 // CreateDeployment creates a new deployment in state and returns its unique ID
 func (s *state) CreateDeployment(ctx context.Context, dep *deployment.Deployment) (int64, error) {
 	q := "INSERT INTO deployments(app, env, status) VALUES(?, ?, ?)"
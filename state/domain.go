@@ -34,6 +34,21 @@ func (s *state) CheckDomainExists(ctx context.Context, name string) (bool, error
 	return true, nil
 }
 
+// Domain returns the domain with the given name or nil if it doesn't exist
+func (s *state) Domain(ctx context.Context, name string) (*domain.Domain, error) {
+	d := &domain.Domain{}
+	err := s.db.QueryRowContext(
+		ctx, "SELECT name, dns_service, certificate_authority FROM domains WHERE name = ?", name,
+	).Scan(&d.Name, &d.DNSService, &d.CertificateAuthority)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
 func (s *state) DeleteDomain(ctx context.Context, name string) error {
 	_, err := s.db.ExecContext(ctx, "DELETE FROM domains WHERE name = ?", name)
 	return err
@@ -12,7 +12,11 @@ const sqlCreateEnvTable = `CREATE TABLE IF NOT EXISTS environments (
 	network VARCHAR(40) NOT NULL,
 	orchestrator VARCHAR(100) NOT NULL,
 	domain VARCHAR(800),
-	load_balancer VARCHAR(100)
+	load_balancer VARCHAR(100),
+	existing TEXT NOT NULL DEFAULT '',
+	network_mode VARCHAR(20) NOT NULL DEFAULT '',
+	nat_gateways VARCHAR(20) NOT NULL DEFAULT '',
+	log_retention INTEGER NOT NULL DEFAULT 0
 )`
 
 func (s *state) CheckEnvExists(ctx context.Context, name string) (bool, error) {
@@ -29,14 +33,20 @@ func (s *state) CheckEnvExists(ctx context.Context, name string) (bool, error) {
 
 func (s *state) CreateEnvironment(ctx context.Context, e *environment.Environment) error {
 	q := `INSERT INTO environments(
-	name, status, network, orchestrator, domain, load_balancer
-) VALUES(?, ?, ?, ?, ?, ?)`
+	name, status, network, orchestrator, domain, load_balancer, existing,
+	network_mode, nat_gateways, log_retention
+) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	stmt, err := s.db.PrepareContext(ctx, q)
 	if err != nil {
 		return err
 	}
+	existing, err := marshalJSONColumn(e.Existing)
+	if err != nil {
+		return err
+	}
 	_, err = stmt.ExecContext(
-		ctx, e.Name, e.Status, e.Network, e.Orchestrator, e.Domain, e.LoadBalancer,
+		ctx, e.Name, e.Status, e.Network, e.Orchestrator, e.Domain, e.LoadBalancer, existing,
+		e.NetworkMode, e.NatGateways, e.LogRetention,
 	)
 	if err != nil {
 		return err
@@ -44,6 +54,30 @@ func (s *state) CreateEnvironment(ctx context.Context, e *environment.Environmen
 	return nil
 }
 
+// UpdateEnvironment stores the changed configuration of an existing environment.
+// The name, status & existing resources of an environment never change.
+func (s *state) UpdateEnvironment(ctx context.Context, e *environment.Environment) error {
+	q := `UPDATE environments
+SET
+	network = ?,
+	orchestrator = ?,
+	domain = ?,
+	load_balancer = ?,
+	network_mode = ?,
+	nat_gateways = ?,
+	log_retention = ?
+WHERE name = ?`
+	stmt, err := s.db.PrepareContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(
+		ctx, e.Network, e.Orchestrator, e.Domain, e.LoadBalancer, e.NetworkMode, e.NatGateways,
+		e.LogRetention, e.Name,
+	)
+	return err
+}
+
 func (s *state) UpdateEnvStatus(ctx context.Context, name, status string) error {
 	q := "UPDATE environments SET status = ? WHERE name = ?"
 	stmt, err := s.db.PrepareContext(ctx, q)
@@ -80,13 +114,44 @@ func (s *state) ListEnvironments(ctx context.Context) ([]string, error) {
 	return res, nil
 }
 
+// ListDomainEnvironments returns names of all environments using the given domain
+func (s *state) ListDomainEnvironments(ctx context.Context, domain string) ([]string, error) {
+	var res []string
+
+	rows, err := s.db.QueryContext(ctx, "SELECT name FROM environments WHERE domain = ?", domain)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return res, err
+		}
+		res = append(res, name)
+	}
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
 func (s *state) Environment(ctx context.Context, name string) (*environment.Environment, error) {
-	var e environment.Environment
+	var (
+		e        environment.Environment
+		existing string
+	)
+	q := `SELECT
+	e.name, e.status, e.network, e.orchestrator, e.domain, e.load_balancer, e.existing,
+	e.network_mode, e.nat_gateways, e.log_retention, COALESCE(r.cidr, '')
+FROM environments e LEFT JOIN vpc_cidr_reservations r ON r.env = e.name
+WHERE e.name = ?`
 
-	err := s.db.QueryRowContext(
-		ctx, "SELECT * FROM environments WHERE name = ?", name,
-	).Scan(
-		&e.Name, &e.Status, &e.Network, &e.Orchestrator, &e.Domain, &e.LoadBalancer,
+	err := s.db.QueryRowContext(ctx, q, name).Scan(
+		&e.Name, &e.Status, &e.Network, &e.Orchestrator, &e.Domain, &e.LoadBalancer, &existing,
+		&e.NetworkMode, &e.NatGateways, &e.LogRetention, &e.VpcCidr,
 	)
 	if err != nil {
 		// return nil response without any error if no such env found
@@ -95,6 +160,9 @@ func (s *state) Environment(ctx context.Context, name string) (*environment.Envi
 		}
 		return nil, err
 	}
+	if err := unmarshalJSONColumn(existing, &e.Existing); err != nil {
+		return nil, err
+	}
 
 	return &e, nil
 }
@@ -18,5 +18,48 @@ func (s *state) Migrate(ctx context.Context) error {
 	if _, err := s.db.ExecContext(ctx, sqlCreateDomainTable); err != nil {
 		return fmt.Errorf("failed to create domains table: %v", err)
 	}
+	if _, err := s.db.ExecContext(ctx, sqlCreateVpcCIDRTable); err != nil {
+		return fmt.Errorf("failed to create vpc_cidr_reservations table: %v", err)
+	}
+	for _, c := range addedColumns {
+		if err := s.addColumn(ctx, c.table, c.name, c.definition); err != nil {
+			return fmt.Errorf("failed to add %s column to %s table: %v", c.name, c.table, err)
+		}
+	}
 	return nil
 }
+
+// addedColumns lists the columns added to tables after they were first released.
+// The CREATE TABLE statements already contain them, these are only needed
+// to migrate databases created by older versions of the server.
+var addedColumns = []struct{ table, name, definition string }{
+	{"applications", "artifact", "VARCHAR(500) NOT NULL DEFAULT ''"},
+	{"applications", "routing", "TEXT NOT NULL DEFAULT ''"},
+	{"applications", "health_check", "TEXT NOT NULL DEFAULT ''"},
+	{"applications", "target_group", "TEXT NOT NULL DEFAULT ''"},
+	{"applications", "container_health_check", "TEXT NOT NULL DEFAULT ''"},
+	{"applications", "iam", "TEXT NOT NULL DEFAULT ''"},
+	{"applications", "databases", "TEXT NOT NULL DEFAULT ''"},
+	{"applications", "buckets", "TEXT NOT NULL DEFAULT ''"},
+	{"applications", "queues", "TEXT NOT NULL DEFAULT ''"},
+	{"applications", "volumes", "TEXT NOT NULL DEFAULT ''"},
+	{"applications", "sidecars", "TEXT NOT NULL DEFAULT ''"},
+	{"applications", "ephemeral_storage", "INTEGER NOT NULL DEFAULT 0"},
+	{"environments", "existing", "TEXT NOT NULL DEFAULT ''"},
+	{"environments", "network_mode", "VARCHAR(20) NOT NULL DEFAULT ''"},
+	{"environments", "nat_gateways", "VARCHAR(20) NOT NULL DEFAULT ''"},
+	{"environments", "log_retention", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// addColumn adds a column to a table unless the table already contains it.
+func (s *state) addColumn(ctx context.Context, table, column, definition string) error {
+	var exists bool
+	err := s.db.QueryRowContext(
+		ctx, "SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?", table, column,
+	).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
@@ -3,11 +3,14 @@ package state
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"github.com/cloudfauj/cloudfauj/application"
 	"github.com/cloudfauj/cloudfauj/deployment"
 	"github.com/cloudfauj/cloudfauj/domain"
 	"github.com/cloudfauj/cloudfauj/environment"
 	"github.com/sirupsen/logrus"
+	"strings"
 )
 
 // State manages all structured data persisted on disk for Cloudfauj Server
@@ -17,8 +20,10 @@ type State interface {
 
 	CheckEnvExists(context.Context, string) (bool, error)
 	CreateEnvironment(context.Context, *environment.Environment) error
+	UpdateEnvironment(context.Context, *environment.Environment) error
 	UpdateEnvStatus(context.Context, string, string) error
 	ListEnvironments(context.Context) ([]string, error)
+	ListDomainEnvironments(context.Context, string) ([]string, error)
 	Environment(context.Context, string) (*environment.Environment, error)
 	DeleteEnvironment(context.Context, string) error
 	// CheckEnvContainsApps returns true if the given environment contains even a single application
@@ -26,6 +31,7 @@ type State interface {
 
 	Deployment(context.Context, string) (*deployment.Deployment, error)
 	ListDeployments(context.Context, string) ([]*deployment.Deployment, error)
+	LatestAppDeployment(context.Context, string, string) (*deployment.Deployment, error)
 	CreateDeployment(context.Context, *deployment.Deployment) (int64, error)
 	UpdateDeploymentStatus(context.Context, string, string) error
 
@@ -33,12 +39,22 @@ type State interface {
 	CreateApp(context.Context, *application.Application, string) error
 	UpdateApp(context.Context, *application.Application, string) error
 	App(context.Context, string, string) (*application.Application, error)
+	ListApps(context.Context, string) ([]string, error)
+	AppArtifact(context.Context, string, string) (string, error)
+	UpdateAppArtifact(context.Context, string, string, string) error
 	DeleteApp(context.Context, string, string) error
 
 	AddDomain(context.Context, *domain.Domain) error
 	CheckDomainExists(context.Context, string) (bool, error)
+	Domain(context.Context, string) (*domain.Domain, error)
 	DeleteDomain(context.Context, string) error
 	ListDomains(context.Context) ([]string, error)
+
+	// ReserveVpcCIDR records a CIDR as allocated to an environment's VPC.
+	// It fails if the CIDR is already reserved or the env already has a reservation.
+	ReserveVpcCIDR(context.Context, string, string) error
+	ReleaseVpcCIDR(context.Context, string) error
+	ListVpcCIDRReservations(context.Context) ([]string, error)
 }
 
 type state struct {
@@ -49,3 +65,60 @@ type state struct {
 func New(l *logrus.Logger, db *sql.DB) State {
 	return &state{log: l, db: db}
 }
+
+// marshalJSONColumn returns the JSON encoding of a value to be stored in a
+// TEXT column. A nil value is stored as an empty string.
+func marshalJSONColumn(v interface{}) (string, error) {
+	res, err := json.Marshal(v)
+	if err != nil || string(res) == "null" {
+		return "", err
+	}
+	return string(res), nil
+}
+
+// unmarshalJSONColumn decodes the JSON stored in a TEXT column into v.
+// An empty column leaves v untouched.
+func unmarshalJSONColumn(data string, v interface{}) error {
+	if data == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(data), v)
+}
+
+// jsonColumns is a list of TEXT columns, each holding a value as JSON
+type jsonColumns []struct {
+	name string
+	// pointer to the value stored in the column
+	value interface{}
+}
+
+func (c jsonColumns) names(sep string) string {
+	res := make([]string, len(c))
+	for i, col := range c {
+		res[i] = col.name
+	}
+	return strings.Join(res, sep)
+}
+
+// marshal returns the JSON encoded values of all columns
+func (c jsonColumns) marshal() ([]interface{}, error) {
+	res := make([]interface{}, len(c))
+	for i, col := range c {
+		v, err := marshalJSONColumn(col.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %v", col.name, err)
+		}
+		res[i] = v
+	}
+	return res, nil
+}
+
+// unmarshal decodes the JSON data of all columns into their values
+func (c jsonColumns) unmarshal(data []string) error {
+	for i, col := range c {
+		if err := unmarshalJSONColumn(data[i], col.value); err != nil {
+			return fmt.Errorf("failed to decode %s: %v", col.name, err)
+		}
+	}
+	return nil
+}